@@ -0,0 +1,98 @@
+package starlight
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.starlark.net/syntax"
+)
+
+// APIVar is the name of the global variable a script may set, at the top level,
+// to the version of the API it was written against, e.g.
+//
+//	starlight_api = "v2"
+const APIVar = "starlight_api"
+
+// DefineAPI defines a named version of the globals made available to scripts
+// run by the cache.  Scripts choose a version by setting APIVar to a string
+// literal; scripts that don't get the default version, if one has been set
+// with SetDefaultAPI.  This lets the host change the Go API exposed to scripts
+// without breaking scripts written against an older version.
+//
+// Versions only apply to scripts run with Run, not modules loaded with load().
+// Since scripts are compiled against the globals of their version, redefining
+// a version in use requires calling Reset or Forget.
+func (c *Cache) DefineAPI(version string, globals map[string]interface{}) {
+	c.mu.Lock()
+	c.apis[version] = globals
+	c.mu.Unlock()
+}
+
+// SetDefaultAPI sets the API version used by scripts that don't declare one.
+// The version must have been defined with DefineAPI.
+func (c *Cache) SetDefaultAPI(version string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.apis[version]; !ok {
+		return fmt.Errorf("unknown API version %s", strconv.Quote(version))
+	}
+	c.defaultAPI = version
+	return nil
+}
+
+func (c *Cache) api(version string) map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.apis[version]
+}
+
+// withAPI returns globals merged over the globals of the given API version.
+func (c *Cache) withAPI(version string, globals map[string]interface{}) map[string]interface{} {
+	api := c.api(version)
+	if len(api) == 0 {
+		return globals
+	}
+	merged := make(map[string]interface{}, len(api)+len(globals))
+	for k, v := range api {
+		merged[k] = v
+	}
+	for k, v := range globals {
+		merged[k] = v
+	}
+	return merged
+}
+
+// scriptAPI returns the API version declared by f, or the default version if
+// it doesn't declare one.
+func (c *Cache) scriptAPI(f *syntax.File) (string, error) {
+	c.mu.Lock()
+	version, defined := c.defaultAPI, len(c.apis) > 0
+	c.mu.Unlock()
+	for _, stmt := range f.Stmts {
+		assign, ok := stmt.(*syntax.AssignStmt)
+		if !ok || assign.Op != syntax.EQ {
+			continue
+		}
+		id, ok := assign.LHS.(*syntax.Ident)
+		if !ok || id.Name != APIVar {
+			continue
+		}
+		if !defined {
+			// the host doesn't use versions, so this is just a variable.
+			return "", nil
+		}
+		lit, ok := assign.RHS.(*syntax.Literal)
+		if !ok || lit.Token != syntax.STRING {
+			return "", fmt.Errorf("%s: %s must be set to a string literal", assign.OpPos, APIVar)
+		}
+		version = lit.Value.(string)
+		c.mu.Lock()
+		_, ok = c.apis[version]
+		c.mu.Unlock()
+		if !ok {
+			return "", fmt.Errorf("%s: unknown API version %s", assign.OpPos, strconv.Quote(version))
+		}
+		break
+	}
+	return version, nil
+}
@@ -0,0 +1,87 @@
+package starlight
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPIVersions(t *testing.T) {
+	dir, cleanup := makeScript(t, "v1.star", `output = greet("bob")`)
+	defer cleanup()
+	writeScript(t, dir, "v2.star", `
+starlight_api = "v2"
+output = greet("bob", "hi")
+`)
+
+	s := New(dir)
+	s.DefineAPI("v1", map[string]interface{}{
+		"greet": func(name string) string { return "hello " + name },
+	})
+	s.DefineAPI("v2", map[string]interface{}{
+		"greet": func(name, greeting string) string { return greeting + " " + name },
+	})
+	if err := s.SetDefaultAPI("v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := s.Run("v1.star", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v["output"] != "hello bob" {
+		t.Fatalf(`expected "hello bob" but got %q`, v["output"])
+	}
+
+	v, err = s.Run("v2.star", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v["output"] != "hi bob" {
+		t.Fatalf(`expected "hi bob" but got %q`, v["output"])
+	}
+}
+
+func TestUnknownAPIVersion(t *testing.T) {
+	dir, cleanup := makeScript(t, "v3.star", `
+starlight_api = "v3"
+output = 1
+`)
+	defer cleanup()
+
+	s := New(dir)
+	s.DefineAPI("v1", nil)
+	_, err := s.Run("v3.star", nil)
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	expected := `v3.star:2:15: unknown API version "v3"`
+	if err.Error() != expected {
+		t.Fatalf("expected error %q, got %q", expected, err)
+	}
+	if err := s.SetDefaultAPI("v2"); err == nil {
+		t.Fatal("expected error setting undefined default API")
+	}
+}
+
+func TestNoAPIVersions(t *testing.T) {
+	dir, cleanup := makeScript(t, "foo.star", `
+starlight_api = "v1"
+output = input
+`)
+	defer cleanup()
+
+	v, err := New(dir).Run("foo.star", map[string]interface{}{"input": "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v["output"] != "hi" || v[APIVar] != "v1" {
+		t.Fatalf("unexpected output %#v", v)
+	}
+}
+
+func writeScript(t *testing.T, dir, name, data string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,9 +6,14 @@ import (
 	"sync/atomic"
 	"unsafe"
 
+	"github.com/starlight-go/starlight/convert"
 	"go.starlark.net/starlark"
 )
 
+// maxStepsKey is the thread local holding the step limit of a run, so that
+// the modules it loads are limited too.
+const maxStepsKey = "starlight.maxSteps"
+
 // The following code is copied from the starlark-go repo,
 // https://go.starlark.net/starlark and is Copyright 2017 the Bazel authors,
 // with a BSD 3-clause license (see the LICENSE file in that repo).
@@ -22,6 +27,8 @@ type cache struct {
 	cache    map[string]*entry
 	globals  starlark.StringDict
 	readFile func(s string) ([]byte, error)
+	// print is used by loaded modules, or fmt.Println if nil.
+	print func(thread *starlark.Thread, msg string)
 }
 
 type entry struct {
@@ -31,8 +38,10 @@ type entry struct {
 	ready   chan struct{}
 }
 
-func (c *cache) Load(module string) (starlark.StringDict, error) {
-	return c.get(new(cycleChecker), module)
+// Load loads the module for thread, which may be nil.  The module runs with
+// the thread's context and what's left of its step limit.
+func (c *cache) Load(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	return c.get(new(cycleChecker), thread, module)
 }
 
 func (c *cache) remove(module string) {
@@ -48,7 +57,7 @@ func (c *cache) reset() {
 }
 
 // get loads and returns an entry (if not already loaded).
-func (c *cache) get(cc *cycleChecker, module string) (starlark.StringDict, error) {
+func (c *cache) get(cc *cycleChecker, thread *starlark.Thread, module string) (starlark.StringDict, error) {
 	c.cacheMu.Lock()
 	e := c.cache[module]
 	if e != nil {
@@ -71,8 +80,17 @@ func (c *cache) get(cc *cycleChecker, module string) (starlark.StringDict, error
 		c.cacheMu.Unlock()
 
 		e.setOwner(cc)
-		e.globals, e.err = c.doLoad(cc, module)
+		var limited bool
+		e.globals, limited, e.err = c.doLoad(cc, thread, module)
 		e.setOwner(nil)
+		if limited {
+			// the module didn't fail by itself, so let later runs retry it.
+			c.cacheMu.Lock()
+			if c.cache[module] == e {
+				delete(c.cache, module)
+			}
+			c.cacheMu.Unlock()
+		}
 
 		// Broadcast that the entry is now ready.
 		close(e.ready)
@@ -80,19 +98,43 @@ func (c *cache) get(cc *cycleChecker, module string) (starlark.StringDict, error
 	return e.globals, e.err
 }
 
-func (c *cache) doLoad(cc *cycleChecker, module string) (starlark.StringDict, error) {
+// doLoad runs the module on a new thread, with the context and the rest of
+// the step limit of the loading thread, parent.  It reports whether the module
+// was stopped by those limits.
+func (c *cache) doLoad(cc *cycleChecker, parent *starlark.Thread, module string) (starlark.StringDict, bool, error) {
+	print := c.print
+	if print == nil {
+		print = func(_ *starlark.Thread, msg string) { fmt.Println(msg) }
+	}
 	thread := &starlark.Thread{
-		Print: func(_ *starlark.Thread, msg string) { fmt.Println(msg) },
-		Load: func(_ *starlark.Thread, module string) (starlark.StringDict, error) {
+		Name:  module,
+		Print: print,
+		Load: func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
 			// Tunnel the cycle-checker state for this "thread of loading".
-			return c.get(cc, module)
+			return c.get(cc, thread, module)
 		},
 	}
+	ctx := convert.ThreadContext(parent)
+	var maxSteps uint64
+	if parent != nil {
+		if max, ok := parent.Local(maxStepsKey).(uint64); ok {
+			// the module gets what's left of the run's steps.
+			maxSteps = 1
+			if used := parent.ExecutionSteps(); used < max {
+				maxSteps = max - used
+			}
+			thread.SetMaxExecutionSteps(maxSteps)
+			thread.SetLocal(maxStepsKey, maxSteps)
+		}
+	}
+	defer watch(ctx, thread)()
 	b, err := c.readFile(module)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	return starlark.ExecFile(thread, module, b, c.globals)
+	globals, err := starlark.ExecFile(thread, module, b, c.globals)
+	limited := err != nil && (ctx.Err() != nil || (maxSteps > 0 && thread.ExecutionSteps() >= maxSteps))
+	return globals, limited, err
 }
 
 // -- concurrent cycle checking --
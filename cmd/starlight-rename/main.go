@@ -0,0 +1,83 @@
+// Command starlight-rename rewrites starlight scripts to follow renamed Go
+// fields and functions.
+//
+// Usage:
+//
+//	starlight-rename -r old=new [-r old=new ...] [-w] file.star ...
+//
+// Renames use the key forms described in the rewrite package, e.g.
+// -r greet=hello renames the global greet, -r contact.Name=FullName renames the
+// Name attribute of the global contact, and -r .Name=FullName renames every
+// attribute called Name.  Rewritten scripts are written to stdout, or back to
+// their files with -w.  References that can't be rewritten safely are listed on
+// stderr, and make the command exit with status 1.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/starlight-go/starlight/rewrite"
+)
+
+type renameFlag rewrite.Renames
+
+func (r renameFlag) String() string {
+	pairs := make([]string, 0, len(r))
+	for k, v := range r {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (r renameFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 || i == len(s)-1 {
+		return fmt.Errorf("rename must be of the form old=new, but was %q", s)
+	}
+	r[s[:i]] = s[i+1:]
+	return nil
+}
+
+func main() {
+	renames := rewrite.Renames{}
+	flag.Var(renameFlag(renames), "r", "rename of the form old=new (may be repeated)")
+	write := flag.Bool("w", false, "write results back to the source files")
+	flag.Parse()
+	if len(renames) == 0 || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ambiguous := false
+	for _, filename := range flag.Args() {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		out, sites, err := rewrite.Source(filename, src, renames)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		for _, s := range sites {
+			fmt.Fprintln(os.Stderr, s)
+			ambiguous = true
+		}
+		if *write {
+			if err := ioutil.WriteFile(filename, out, 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			continue
+		}
+		os.Stdout.Write(out)
+	}
+	if ambiguous {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,74 @@
+package convert
+
+import (
+	"math/big"
+	"reflect"
+
+	"go.starlark.net/starlark"
+)
+
+var (
+	bigIntType = reflect.TypeOf(big.Int{})
+	bigRatType = reflect.TypeOf(big.Rat{})
+)
+
+// toBigValue converts big.Int and big.Rat values (and non-nil pointers to
+// them) to starlark numbers.  Ints are exact.  Rats are exact if they are
+// integers, and otherwise become the nearest float, since starlark has no
+// rational numbers.  It returns false for other values.
+func toBigValue(val reflect.Value) (starlark.Value, bool) {
+	if !val.IsValid() {
+		return nil, false
+	}
+	if val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	switch val.Type() {
+	case bigIntType:
+		return starlark.MakeBigInt(bigAddr(val).Interface().(*big.Int)), true
+	case bigRatType:
+		r := bigAddr(val).Interface().(*big.Rat)
+		if r.IsInt() {
+			return starlark.MakeBigInt(r.Num()), true
+		}
+		f, _ := r.Float64()
+		return starlark.Float(f), true
+	}
+	return nil, false
+}
+
+// bigAddr returns a pointer to the big number val, copying it if it isn't
+// addressable, since the methods of big numbers have pointer receivers.
+func bigAddr(val reflect.Value) reflect.Value {
+	if !val.CanAddr() {
+		cp := reflect.New(val.Type()).Elem()
+		cp.Set(val)
+		val = cp
+	}
+	return val.Addr()
+}
+
+// toBig converts starlark numbers to *big.Int and *big.Rat values, when t is
+// one of those types.  Floats are converted to rats exactly.  It returns false
+// for other values and types.
+func toBig(v starlark.Value, t reflect.Type) (reflect.Value, bool) {
+	if t.Kind() != reflect.Ptr {
+		return reflect.Value{}, false
+	}
+	switch t.Elem() {
+	case bigIntType:
+		if i, ok := v.(starlark.Int); ok {
+			return reflect.ValueOf(i.BigInt()), true
+		}
+	case bigRatType:
+		switch v := v.(type) {
+		case starlark.Int:
+			return reflect.ValueOf(new(big.Rat).SetInt(v.BigInt())), true
+		case starlark.Float:
+			if r := new(big.Rat).SetFloat64(float64(v)); r != nil {
+				return reflect.ValueOf(r), true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,59 @@
+package convert_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+type ledger struct {
+	Balance *big.Int
+	Rate    *big.Rat
+}
+
+func TestBigNumbers(t *testing.T) {
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	l := &ledger{Balance: huge, Rate: big.NewRat(1, 4)}
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"l":      l,
+		"half":   big.NewRat(1, 2),
+		"double": func(i *big.Int) *big.Int { return new(big.Int).Lsh(i, 1) },
+		"inv":    func(r *big.Rat) *big.Rat { return new(big.Rat).Inv(r) },
+	}
+	code := []byte(`
+assert.Eq(l.Balance, 123456789012345678901234567890)
+assert.Eq(double(l.Balance), 246913578024691357802469135780)
+assert.Eq(l.Rate, 0.25)
+assert.Eq(half, 0.5)
+assert.Eq(inv(4), 0.25)
+assert.Eq(inv(0.5), 2)
+l.Balance = l.Balance * 1000
+l.Rate = 3
+big = 1 << 100
+`)
+	out, err := starlight.Eval(code, globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Balance.String() != "123456789012345678901234567890000" {
+		t.Errorf("unexpected balance %v", l.Balance)
+	}
+	if l.Rate.Cmp(big.NewRat(3, 1)) != 0 {
+		t.Errorf("unexpected rate %v", l.Rate)
+	}
+	expected := new(big.Int).Lsh(big.NewInt(1), 100)
+	if b, ok := out["big"].(*big.Int); !ok || b.Cmp(expected) != 0 {
+		t.Errorf("expected 2**100 as a *big.Int, got %#v", out["big"])
+	}
+}
+
+func TestFromValueBigInt(t *testing.T) {
+	v := starlark.MakeInt(1).Lsh(100)
+	if _, ok := convert.FromValue(v).(*big.Int); !ok {
+		t.Fatalf("expected *big.Int, got %T", convert.FromValue(v))
+	}
+}
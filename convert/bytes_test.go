@@ -0,0 +1,51 @@
+package convert_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+type blob struct {
+	Data []byte
+}
+
+func TestBytes(t *testing.T) {
+	b := &blob{Data: []byte("hi\x00")}
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"b":      b,
+		"upper":  bytes.ToUpper,
+	}
+	code := []byte(`
+assert.Eq(type(b.Data), "bytes")
+assert.Eq(b.Data, b"hi\x00")
+assert.Eq(len(b.Data), 3)
+assert.Eq(upper(b"abc"), b"ABC")
+b.Data = b"bye"
+out = b.Data
+`)
+	out, err := starlight.Eval(code, globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b.Data) != "bye" {
+		t.Errorf("expected the field to be set to bye, got %q", b.Data)
+	}
+	if got, ok := out["out"].([]byte); !ok || string(got) != "bye" {
+		t.Errorf("expected out to be []byte(\"bye\"), got %#v", out["out"])
+	}
+}
+
+func TestBytesAsString(t *testing.T) {
+	v, err := convert.ToValueWithOptions([]byte("hi"), convert.BytesAsString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != starlark.String("hi") {
+		t.Fatalf("expected string hi, got %s %v", v.Type(), v)
+	}
+}
@@ -0,0 +1,228 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// NewGoChan wraps the given channel so that scripts can send and receive on it,
+// which lets scripts take part in Go pipelines.  Channels are not converted by
+// ToValue, since a script blocking on a channel can stall its host, so hosts
+// must opt in by wrapping them explicitly.  This function will panic if ch is
+// not a channel.
+//
+// The wrapped channel has these methods, which fail if the channel's direction
+// doesn't allow them:
+//
+//	send(v)              converts v to the channel's element type and sends it.
+//	recv(timeout=None)   receives a value and returns the tuple (value, ok).
+//	                     ok is False if the channel is closed, or if the
+//	                     timeout in seconds expires first.
+//	close()              closes the channel.
+//
+// Channels that can receive are returned as a GoRecvChan, so that scripts can
+// write "for x in ch" to receive values until the channel is closed.
+// Send-only channels are returned as a GoChan, which isn't iterable.
+//
+// Blocking sends and receives stop with an error when the context of the run
+// is done (see ThreadContext).  If the channel was converted WithThread,
+// iteration also fails the script when the context is done.
+func NewGoChan(ch interface{}) starlark.Value {
+	v := reflect.ValueOf(ch)
+	if v.Kind() != reflect.Chan {
+		panic(fmt.Errorf("NewGoChan expects a channel, but got %T", ch))
+	}
+	return wrapChan(&GoChan{v: v})
+}
+
+// GoChan is a wrapper around a Go channel to let scripts send and receive on
+// it.
+type GoChan struct {
+	v    reflect.Value
+	opts *options
+}
+
+// GoRecvChan is a GoChan for a channel that can receive, so that scripts can
+// loop over it.
+type GoRecvChan struct {
+	*GoChan
+}
+
+var _ starlark.Iterable = (*GoRecvChan)(nil)
+
+// wrapChan returns g as a GoRecvChan if its channel can receive.
+func wrapChan(g *GoChan) starlark.Value {
+	if g.v.Type().ChanDir()&reflect.RecvDir != 0 {
+		return &GoRecvChan{GoChan: g}
+	}
+	return g
+}
+
+var chanMethods = []string{"close", "recv", "send"}
+
+// Attr returns the channel method with the given name.
+func (g *GoChan) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "send":
+		return starlark.NewBuiltin(name, g.send), nil
+	case "recv":
+		return starlark.NewBuiltin(name, g.recv), nil
+	case "close":
+		return starlark.NewBuiltin(name, g.close), nil
+	}
+	return nil, nil
+}
+
+// AttrNames returns the names of the channel's methods.
+func (g *GoChan) AttrNames() []string {
+	return append([]string(nil), chanMethods...)
+}
+
+func (g *GoChan) send(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (v starlark.Value, err error) {
+	var arg starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &arg); err != nil {
+		return nil, err
+	}
+	if g.v.Type().ChanDir()&reflect.SendDir == 0 {
+		return nil, fmt.Errorf("%s: can't send on receive-only channel", fn.Name())
+	}
+	// converting to the element type or sending on a closed channel panics.
+	defer func() {
+		if r := recover(); r != nil {
+			v, err = nil, fmt.Errorf("%s: %v", fn.Name(), r)
+		}
+	}()
+	val := conv(arg, g.v.Type().Elem())
+	ctx := ThreadContext(thread)
+	chosen, _, _ := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: g.v, Send: val},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	})
+	if chosen == 1 {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), ctx.Err())
+	}
+	return starlark.None, nil
+}
+
+func (g *GoChan) recv(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var timeout starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "timeout?", &timeout); err != nil {
+		return nil, err
+	}
+	if g.v.Type().ChanDir()&reflect.RecvDir == 0 {
+		return nil, fmt.Errorf("%s: can't receive on send-only channel", fn.Name())
+	}
+	ctx := ThreadContext(thread)
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: g.v},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+	if timeout != starlark.None {
+		secs, ok := starlark.AsFloat(timeout)
+		if !ok {
+			return nil, fmt.Errorf("%s: timeout must be a number, got %s", fn.Name(), timeout.Type())
+		}
+		t := time.NewTimer(time.Duration(secs * float64(time.Second)))
+		defer t.Stop()
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(t.C)})
+	}
+	chosen, val, ok := reflect.Select(cases)
+	switch chosen {
+	case 1:
+		return nil, fmt.Errorf("%s: %v", fn.Name(), ctx.Err())
+	case 2:
+		return starlark.Tuple{starlark.None, starlark.False}, nil
+	}
+	if !ok {
+		return starlark.Tuple{starlark.None, starlark.False}, nil
+	}
+	v, err := toValue(val, g.opts.child())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.Tuple{v, starlark.True}, nil
+}
+
+func (g *GoChan) close(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (v starlark.Value, err error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	if g.v.Type().ChanDir()&reflect.SendDir == 0 {
+		return nil, fmt.Errorf("%s: can't close receive-only channel", fn.Name())
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			v, err = nil, fmt.Errorf("%s: %v", fn.Name(), r)
+		}
+	}()
+	g.v.Close()
+	return starlark.None, nil
+}
+
+// Iterate returns an iterator that receives from the channel until it is
+// closed.
+func (g *GoRecvChan) Iterate() starlark.Iterator {
+	it := &chanIterator{g: g.GoChan}
+	if g.opts != nil && g.opts.thread != nil {
+		it.done = ThreadContext(g.opts.thread).Done()
+	}
+	return it
+}
+
+type chanIterator struct {
+	g *GoChan
+	// done stops the iteration when the run's context is done.
+	done <-chan struct{}
+}
+
+func (it *chanIterator) Next(p *starlark.Value) bool {
+	chosen, val, ok := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: it.g.v},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(it.done)},
+	})
+	if chosen == 1 {
+		// a loop cut short by cancellation must not look like a closed
+		// channel, so the script fails.
+		ctx := ThreadContext(it.g.opts.thread)
+		it.g.opts.failIteration(fmt.Errorf("iterating %s: %v", it.g.Type(), ctx.Err()))
+		return false
+	}
+	if !ok {
+		return false
+	}
+	v, err := toValue(val, it.g.opts.child())
+	if err != nil {
+		panic(err)
+	}
+	*p = v
+	return true
+}
+
+func (it *chanIterator) Done() {}
+
+// String returns the string representation of the value.
+func (g *GoChan) String() string {
+	return fmt.Sprint(g.v.Interface())
+}
+
+// Type returns a short string describing the value's type.
+func (g *GoChan) Type() string {
+	return fmt.Sprintf("go.chan<%T>", g.v.Interface())
+}
+
+// Freeze is a no-op, channels are safe for concurrent use.
+func (g *GoChan) Freeze() {}
+
+// Truth returns the truth value of an object.
+func (g *GoChan) Truth() starlark.Bool {
+	return starlark.Bool(!g.v.IsNil())
+}
+
+// Hash returns a function of x such that Equals(x, y) => Hash(x) == Hash(y).
+func (g *GoChan) Hash() (uint32, error) {
+	return 0, errors.New("go.chan is not hashable")
+}
@@ -0,0 +1,145 @@
+package convert_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+func TestChanSendRecv(t *testing.T) {
+	in := make(chan int, 3)
+	out := make(chan string, 3)
+	in <- 1
+	in <- 2
+	close(in)
+	globals := map[string]interface{}{
+		"input":  convert.NewGoChan((<-chan int)(in)),
+		"output": convert.NewGoChan(out),
+	}
+	_, err := starlight.Eval([]byte(`
+def pump():
+    for i in range(10):
+        v, ok = input.recv()
+        if not ok:
+            break
+        output.send(str(v * 10))
+    output.close()
+
+pump()
+`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for s := range out {
+		got = append(got, s)
+	}
+	assert := &assert{t: t}
+	assert.Eq([]string{"10", "20"}, got)
+}
+
+func TestChanRecvTimeout(t *testing.T) {
+	ch := make(chan int)
+	globals := map[string]interface{}{"ch": convert.NewGoChan(ch)}
+	res, err := starlight.Eval([]byte(`v, ok = ch.recv(timeout=0.01)`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["ok"] != false {
+		t.Fatalf("expected ok to be false, got %#v", res["ok"])
+	}
+}
+
+func TestChanErrors(t *testing.T) {
+	closed := make(chan int, 1)
+	close(closed)
+	globals := map[string]interface{}{
+		"recvOnly": convert.NewGoChan((<-chan int)(make(chan int))),
+		"ints":     convert.NewGoChan(make(chan int, 1)),
+		"closed":   convert.NewGoChan(closed),
+	}
+	tests := []fail{
+		{`recvOnly.send(1)`, "send: can't send on receive-only channel"},
+		{`recvOnly.close()`, "close: can't close receive-only channel"},
+		{`ints.send("a")`, "send: reflect.Value.Convert: value of type string cannot be converted to type int"},
+		{`closed.send(1)`, "send: send on closed channel"},
+		{`closed.close()`, "close: close of closed channel"},
+	}
+	expectFails(t, tests, globals)
+}
+
+func TestChanSendCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	globals := map[string]interface{}{"ch": convert.NewGoChan(make(chan int))}
+	_, err := starlight.EvalContext(ctx, []byte(`ch.send(1)`), globals, nil)
+	if err == nil || !strings.Contains(err.Error(), "send: context canceled") {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+}
+
+func TestChanIterate(t *testing.T) {
+	in := make(chan int, 3)
+	in <- 1
+	in <- 2
+	close(in)
+	out := make(chan int, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	thread := &starlark.Thread{}
+	convert.SetThreadContext(thread, ctx)
+	globals, err := convert.MakeStringDictWithOptions(map[string]interface{}{
+		"input":  (<-chan int)(in),
+		"output": (chan<- int)(out),
+	}, convert.Channels(), convert.WithThread(thread))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := `
+def pump():
+    total = 0
+    for v in input:
+        total += v * 10
+    output.send(total)
+
+pump()
+`
+	if _, err := starlark.ExecFile(thread, "pump.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-out; got != 30 {
+		t.Fatalf("expected 30, got %v", got)
+	}
+
+	_, err = convert.ToValue(in)
+	expectErr(t, err, "type chan int is not a supported starlark type")
+
+	// iteration fails the script when the run is cancelled, so that it can't
+	// be mistaken for a closed channel.
+	blocked := make(chan int)
+	globals["blocked"], err = convert.ToValueWithOptions(blocked, convert.Channels(), convert.WithThread(thread))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	code = `
+def drain():
+    for v in blocked:
+        pass
+
+drain()
+`
+	_, err = starlark.ExecFile(thread, "drain.star", code, globals)
+	if err == nil || !strings.Contains(err.Error(), "iterating go.chan<chan int>: context canceled") {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+
+	// send-only channels can't be iterated over.
+	_, err = starlark.ExecFile(&starlark.Thread{}, "send.star", "[v for v in output]", globals)
+	expectErr(t, err, "go.chan<chan<- int> value is not iterable")
+}
@@ -0,0 +1,171 @@
+package convert
+
+import (
+	"reflect"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+var intType = reflect.TypeOf(0)
+
+// GoCollection is a GoStruct for a struct that acts as a collection, so that
+// scripts can use len(x), x[i] and for loops on it.  Structs with a Len() int
+// method and an At(i int) method that returns the i'th element are
+// collections.  If the struct also has an All method that returns an iterator
+// function (see NewGoSeq), loops use it, and otherwise they call At for each
+// index.
+type GoCollection struct {
+	*GoStruct
+}
+
+// GoIterableStruct is a GoStruct for a struct with an All method that returns
+// an iterator function (see NewGoSeq), but no Len and At methods, so that
+// scripts can loop over it.
+type GoIterableStruct struct {
+	*GoStruct
+}
+
+var (
+	_ starlark.Indexable   = (*GoCollection)(nil)
+	_ starlark.Sequence    = (*GoCollection)(nil)
+	_ starlark.HasSetField = (*GoCollection)(nil)
+	_ starlark.Iterable    = (*GoIterableStruct)(nil)
+	_ starlark.HasSetField = (*GoIterableStruct)(nil)
+)
+
+// GoCallable is a GoStruct for a struct with the method named by the
+// CallMethod option, so that scripts can call it.
+type GoCallable struct {
+	*GoStruct
+}
+
+var _ starlark.Callable = (*GoCallable)(nil)
+
+// wrapStruct returns g as a GoCallable, GoCollection or GoIterableStruct if it
+// has their methods, and otherwise returns g.
+func wrapStruct(g *GoStruct) starlark.Value {
+	recv := g.receiver()
+	if name := g.opts.callName(); name != "" && recv.MethodByName(name).IsValid() {
+		return &GoCallable{GoStruct: g}
+	}
+	if lenMethod(recv).IsValid() && atMethod(recv).IsValid() {
+		return &GoCollection{GoStruct: g}
+	}
+	if _, ok := allMethod(recv); ok {
+		return &GoIterableStruct{GoStruct: g}
+	}
+	return g
+}
+
+// lenMethod returns the Len() int method of v, if it has one.
+func lenMethod(v reflect.Value) reflect.Value {
+	m := v.MethodByName("Len")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 || m.Type().Out(0) != intType {
+		return reflect.Value{}
+	}
+	return m
+}
+
+// atMethod returns the At(int) method of v, if it has one that returns a
+// single value.
+func atMethod(v reflect.Value) reflect.Value {
+	m := v.MethodByName("At")
+	if !m.IsValid() || m.Type().NumIn() != 1 || m.Type().In(0) != intType || m.Type().NumOut() != 1 {
+		return reflect.Value{}
+	}
+	return m
+}
+
+// allMethod returns the All method of v, if it has one that returns an
+// iterator function.
+func allMethod(v reflect.Value) (reflect.Value, bool) {
+	m := v.MethodByName("All")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 || !isSeq(m.Type().Out(0)) {
+		return reflect.Value{}, false
+	}
+	return m, true
+}
+
+// iterateAll loops over the iterator function returned by the All method.
+func iterateAll(all reflect.Value, o *options) starlark.Iterator {
+	return (&GoSeq{v: all.Call(nil)[0], opts: o}).Iterate()
+}
+
+// Len returns the length of the collection, from its Len method.
+func (g *GoCollection) Len() int {
+	return int(lenMethod(g.receiver()).Call(nil)[0].Int())
+}
+
+// Index returns the i'th element of the collection, from its At method.
+func (g *GoCollection) Index(i int) starlark.Value {
+	v, err := toValue(atMethod(g.receiver()).Call([]reflect.Value{reflect.ValueOf(i)})[0], g.opts.nested(g.frozen))
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Iterate returns an iterator over the collection's elements.
+func (g *GoCollection) Iterate() starlark.Iterator {
+	if all, ok := allMethod(g.receiver()); ok {
+		return iterateAll(all, g.opts.nested(g.frozen))
+	}
+	return &collectionIterator{g: g}
+}
+
+// Truth returns whether the collection has elements.
+func (g *GoCollection) Truth() starlark.Bool {
+	return g.Len() > 0
+}
+
+// CompareSameType compares the structs as GoStruct does.
+func (g *GoCollection) CompareSameType(op syntax.Token, y starlark.Value, depth int) (bool, error) {
+	return g.GoStruct.CompareSameType(op, y.(*GoCollection).GoStruct, depth)
+}
+
+// Iterate returns an iterator over the iterator function returned by the
+// struct's All method.
+func (g *GoIterableStruct) Iterate() starlark.Iterator {
+	all, _ := allMethod(g.receiver())
+	return iterateAll(all, g.opts.nested(g.frozen))
+}
+
+// CompareSameType compares the structs as GoStruct does.
+func (g *GoIterableStruct) CompareSameType(op syntax.Token, y starlark.Value, depth int) (bool, error) {
+	return g.GoStruct.CompareSameType(op, y.(*GoIterableStruct).GoStruct, depth)
+}
+
+// Name returns the name of the struct's type.
+func (g *GoCallable) Name() string {
+	return reflect.Indirect(g.v).Type().Name()
+}
+
+// CallInternal calls the struct's call method with the arguments, converted
+// as for MakeStarFn.
+func (g *GoCallable) CallInternal(thread *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	name := g.opts.callName()
+	fn := makeStarFn(name, g.receiver().MethodByName(name), g.opts.nested(g.frozen))
+	return fn.CallInternal(thread, args, kwargs)
+}
+
+// CompareSameType compares the structs as GoStruct does.
+func (g *GoCallable) CompareSameType(op syntax.Token, y starlark.Value, depth int) (bool, error) {
+	return g.GoStruct.CompareSameType(op, y.(*GoCallable).GoStruct, depth)
+}
+
+type collectionIterator struct {
+	g *GoCollection
+	i int
+}
+
+func (it *collectionIterator) Next(p *starlark.Value) bool {
+	if it.i >= it.g.Len() {
+		return false
+	}
+	*p = it.g.Index(it.i)
+	it.i++
+	return true
+}
+
+func (it *collectionIterator) Done() {}
@@ -1,12 +1,18 @@
 package convert
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
+	"runtime/debug"
+	"strings"
+	"time"
 
+	startime "go.starlark.net/lib/time"
 	"go.starlark.net/resolve"
 	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
 )
 
 func init() {
@@ -20,12 +26,21 @@ func init() {
 // ToValue attempts to convert the given value to a starlark.Value.  It supports
 // all int, uint, and float numeric types, plus strings and bools.  It supports
 // structs, maps, slices, and functions that use the aforementioned.  Any
-// starlark.Value is passed through as-is.
+// starlark.Value is passed through as-is, and values that implement Marshaler
+// are converted by their StarlarkValue method.  Nil pointers and interfaces,
+// and nil itself, are converted to None (see StrictNil).
+//
+// Struct fields, map values and slice elements of interface{} type are
+// converted according to the value they hold.  Those of other interface types,
+// such as io.Reader, are wrapped in a GoInterface that exposes the interface's
+// methods, whatever the type of the value they hold.  Struct fields tagged
+// `starlark:",set"` are converted to sets, as MakeSetFrom does, and scripts can
+// assign sets to them.
 func ToValue(v interface{}) (starlark.Value, error) {
 	if val, ok := v.(starlark.Value); ok {
 		return val, nil
 	}
-	return toValue(reflect.ValueOf(v))
+	return toValue(reflect.ValueOf(v), nil)
 }
 
 func hasMethods(val reflect.Value) bool {
@@ -38,10 +53,65 @@ func hasMethods(val reflect.Value) bool {
 	return false
 }
 
-func toValue(val reflect.Value) (starlark.Value, error) {
+// isNil reports whether val is a nil pointer, interface, map, slice, func or
+// channel.
+func isNil(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return val.IsNil()
+	}
+	return false
+}
+
+func toValue(val reflect.Value, o *options) (starlark.Value, error) {
+	if !val.IsValid() || ((val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface) && val.IsNil()) {
+		if o.isStrictNil() {
+			if !val.IsValid() {
+				return nil, errors.New("can't convert nil value")
+			}
+			return nil, fmt.Errorf("can't convert nil %s", val.Type())
+		}
+		return starlark.None, nil
+	}
+	if val.Kind() == reflect.Interface && val.NumMethod() == 0 {
+		// an empty interface says nothing about its value, so convert the
+		// value it holds.
+		return toValue(val.Elem(), o)
+	}
+	if val.IsValid() && val.CanInterface() {
+		// go values that are already starlark values, such as Decimal.
+		if v, ok := val.Interface().(starlark.Value); ok && !isNil(val) {
+			return v, nil
+		}
+	}
+	if err := o.checkLimits(val); err != nil {
+		return nil, err
+	}
+	o, err := o.checkContents(val)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok, err := toRegistered(val, o); ok {
+		return v, err
+	}
+	if v, ok, err := toMarshaled(val); ok {
+		return v, err
+	}
+	if v, ok := toTimeValue(val); ok {
+		return v, nil
+	}
+	if v, ok := toBigValue(val); ok {
+		return v, nil
+	}
+	if v, ok, err := toText(val, o); ok {
+		return v, err
+	}
+	if v, ok, err := toJSON(val, o); ok {
+		return v, err
+	}
 	if hasMethods(val) {
 		// this handles all basic types with methods (numbers, strings, bools)
-		ifc, ok := makeGoInterface(val)
+		ifc, ok := makeGoInterface(val, o)
 		if ok {
 			return ifc, nil
 		}
@@ -62,62 +132,181 @@ func toValue(val reflect.Value) (starlark.Value, error) {
 	case reflect.Float32, reflect.Float64:
 		return starlark.Float(val.Float()), nil
 	case reflect.Func:
-		return makeStarFn("fn", val), nil
+		return deprecateFn(makeStarFn("fn", val, o), val, o), nil
 	case reflect.Map:
-		return &GoMap{v: val}, nil
+		return &GoMap{v: val, opts: o, frozen: o.isFrozen()}, nil
 	case reflect.String:
 		return starlark.String(val.String()), nil
 	case reflect.Slice, reflect.Array:
-		return &GoSlice{v: val}, nil
+		if val.Kind() == reflect.Slice && val.Type().Elem().Kind() == reflect.Uint8 {
+			// byte slices are binary data, not lists of numbers.
+			if o.bytesAsString() {
+				return starlark.String(val.Bytes()), nil
+			}
+			return starlark.Bytes(val.Bytes()), nil
+		}
+		if val.Kind() == reflect.Ptr {
+			// writes go through the pointer.
+			val = val.Elem()
+		}
+		return &GoSlice{v: addressable(val), opts: o, frozen: o.isFrozen()}, nil
 	case reflect.Struct:
-		return &GoStruct{v: val}, nil
+		if o.starlarkStructs() {
+			return starlarkStruct(val, o)
+		}
+		if o.structDicts() {
+			return structDict(val, o)
+		}
+		return wrapStruct(&GoStruct{v: val, opts: o, frozen: o.isFrozen()}), nil
 	case reflect.Interface:
-		return &GoInterface{v: val}, nil
+		return &GoInterface{v: val, opts: o}, nil
+	case reflect.Chan:
+		if o.channels() && val.Kind() == reflect.Chan {
+			return wrapChan(&GoChan{v: val, opts: o}), nil
+		}
 	}
 
+	if o.stringers() && val.CanInterface() {
+		if s, ok := val.Interface().(fmt.Stringer); ok {
+			return starlark.String(s.String()), nil
+		}
+	}
 	return nil, fmt.Errorf("type %T is not a supported starlark type", val.Interface())
 }
 
-// FromValue converts a starlark value to a go value.
+// ScriptType returns the type, in python type hint syntax, of the starlark
+// values that values of the Go type t are converted to with the given options,
+// if convert gives t special treatment rather than converting it by kind:
+// time.Time becomes time, []byte becomes bytes (or str with BytesAsString),
+// and types with converters or marshalers become Any, or str with
+// TextMarshalers.  It's for tools that describe converted values to script
+// authors.
+func ScriptType(t reflect.Type, opts ...Option) (string, bool) {
+	o := makeOptions(opts)
+	if _, ok := o.converter(t); ok {
+		return "Any", true
+	}
+	registry.RLock()
+	_, ok := registry.to[t]
+	registry.RUnlock()
+	if ok || t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return "Any", true
+	}
+	elem := t
+	if t.Kind() == reflect.Ptr {
+		elem = t.Elem()
+	}
+	switch elem {
+	case timeType:
+		return "time", true
+	case durationType:
+		return "duration", true
+	case bigIntType:
+		return "int", true
+	case bigRatType:
+		return "int | float", true
+	}
+	if o.textMarshal() && t.Implements(textMarshalerType) {
+		return "str", true
+	}
+	if o.jsonMarshal() && t.Implements(jsonMarshalerType) {
+		return "Any", true
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		if o.bytesAsString() {
+			return "str", true
+		}
+		return "bytes", true
+	}
+	return "", false
+}
+
+// FromValue converts a starlark value to a go value.  None becomes nil.  Ints
+// become int64, or uint64 or *big.Int if they are too large for an int64.  It
+// panics if v can't be converted (see FromValueErr).
 func FromValue(v starlark.Value) interface{} {
+	ret, err := fromValue(v)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// FromValueErr is like FromValue, but returns an error instead of panicking if v
+// can't be converted, e.g. because a dict has keys (such as tuples) that
+// convert to Go values that can't be map keys.
+func FromValueErr(v starlark.Value) (interface{}, error) {
+	ret, err := fromValue(v)
+	if err != nil {
+		return nil, fmt.Errorf("can't convert %s to a go value: %v", v.Type(), err)
+	}
+	return ret, nil
+}
+
+func fromValue(v starlark.Value) (interface{}, error) {
 	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
 	case starlark.Bool:
-		return bool(v)
+		return bool(v), nil
 	case starlark.Int:
 		// starlark ints can be signed or unsigned
 		if i, ok := v.Int64(); ok {
-			return i
+			return i, nil
 		}
 		if i, ok := v.Uint64(); ok {
-			return i
+			return i, nil
 		}
-		// buh... maybe > maxint64?  Dunno
-		panic(fmt.Errorf("can't convert starlark.Int %q to int", v))
+		return v.BigInt(), nil
 	case starlark.Float:
-		return float64(v)
+		return float64(v), nil
 	case starlark.String:
-		return string(v)
+		return string(v), nil
+	case starlark.Bytes:
+		return []byte(v), nil
 	case *starlark.List:
-		return FromList(v)
+		return fromList(v)
 	case starlark.Tuple:
-		return FromTuple(v)
+		return fromTuple(v)
 	case *starlark.Dict:
-		return FromDict(v)
+		return fromDict(v)
 	case *starlark.Set:
-		return FromSet(v)
+		return fromSet(v)
+	case *starlarkstruct.Struct:
+		return fromStarlarkStruct(v)
 	case *GoStruct:
-		return v.v.Interface()
+		return v.v.Interface(), nil
+	case *GoCollection:
+		return v.v.Interface(), nil
+	case *GoIterableStruct:
+		return v.v.Interface(), nil
+	case *GoCallable:
+		return v.v.Interface(), nil
 	case *GoInterface:
-		return v.v.Interface()
+		return v.v.Interface(), nil
 	case *GoMap:
-		return v.v.Interface()
+		return v.v.Interface(), nil
 	case *GoSlice:
-		return v.v.Interface()
+		return v.v.Interface(), nil
+	case *GoChan:
+		return v.v.Interface(), nil
+	case *GoRecvChan:
+		return v.v.Interface(), nil
+	case *GoSeq:
+		return v.v.Interface(), nil
+	case startime.Time:
+		return time.Time(v), nil
+	case startime.Duration:
+		return time.Duration(v), nil
+	case *GoReader:
+		return v.r, nil
+	case *GoWriter:
+		return v.w, nil
 	default:
 		// dunno, hope it's a custom type that the receiver knows how to deal
 		// with. This can happen with custom-written go types that implement
 		// starlark.Value.
-		return v
+		return v, nil
 	}
 }
 
@@ -140,69 +329,282 @@ func MakeStringDict(m map[string]interface{}) (starlark.StringDict, error) {
 func FromStringDict(m starlark.StringDict) map[string]interface{} {
 	ret := make(map[string]interface{}, len(m))
 	for k, v := range m {
-		ret[k] = FromValue(v)
+		if val, err := fromValue(v); err == nil {
+			ret[k] = val
+		}
 	}
 	return ret
 }
 
+// ToValues converts each of vals as ToValue does, with the given options shared
+// by all the values, e.g. to convert the arguments of a call.
+func ToValues(vals []interface{}, opts ...Option) ([]starlark.Value, error) {
+	o := makeOptions(opts)
+	ret := make([]starlark.Value, len(vals))
+	for i, v := range vals {
+		if sv, ok := v.(starlark.Value); ok {
+			ret[i] = sv
+			continue
+		}
+		sv, err := toValue(reflect.ValueOf(v), o)
+		if err != nil {
+			return nil, fmt.Errorf("value %d: %v", i, err)
+		}
+		ret[i] = sv
+	}
+	return ret, nil
+}
+
+// FromValues converts each of vals as FromValueErr does, e.g. to convert the
+// results of a call.  vals may be a starlark.Tuple.  It takes the options the
+// values were converted with by ToValues, so that calls mirror each other, but
+// converting starlark values to Go has no options yet, so they don't change the
+// result.
+func FromValues(vals []starlark.Value, opts ...Option) ([]interface{}, error) {
+	ret := make([]interface{}, len(vals))
+	for i, v := range vals {
+		gv, err := FromValueErr(v)
+		if err != nil {
+			return nil, fmt.Errorf("value %d: %v", i, err)
+		}
+		ret[i] = gv
+	}
+	return ret, nil
+}
+
 // FromTuple converts a starlark.Tuple into a []interface{}.
 func FromTuple(v starlark.Tuple) []interface{} {
+	ret, err := fromTuple(v)
+	if err != nil {
+		panic(err)
+	}
+	return ret.([]interface{})
+}
+
+func fromTuple(v starlark.Tuple) (interface{}, error) {
 	ret := make([]interface{}, len(v))
 	for i := range v {
-		ret[i] = FromValue(v[i])
+		val, err := fromValue(v[i])
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = val
 	}
-	return ret
+	return ret, nil
 }
 
 // FromList creates a go slice from the given starlark list.
 func FromList(l *starlark.List) []interface{} {
+	ret, err := fromList(l)
+	if err != nil {
+		panic(err)
+	}
+	return ret.([]interface{})
+}
+
+func fromList(l *starlark.List) (interface{}, error) {
 	ret := make([]interface{}, 0, l.Len())
 	var v starlark.Value
 	i := l.Iterate()
 	defer i.Done()
 	for i.Next(&v) {
-		val := FromValue(v)
+		val, err := fromValue(v)
+		if err != nil {
+			return nil, err
+		}
 		ret = append(ret, val)
 	}
-	return ret
+	return ret, nil
 }
 
 // MakeDict makes a Dict from the given map.  The acceptable keys and values are
-// the same as ToValue.
+// the same as ToValue.  The dict is a copy, so changes scripts make to it don't
+// reach the map; use NewGoMap (or ToValue, which wraps maps the same way) to
+// let scripts read and write the map itself.
 func MakeDict(v interface{}) (starlark.Value, error) {
-	return makeDict(reflect.ValueOf(v))
+	return makeDict(reflect.ValueOf(v), nil)
 }
 
-func makeDict(val reflect.Value) (starlark.Value, error) {
+func makeDict(val reflect.Value, o *options) (starlark.Value, error) {
 	if val.Kind() != reflect.Map {
 		panic(fmt.Errorf("can't make map of %T", val.Interface()))
 	}
+	if err := o.checkLimits(val); err != nil {
+		return nil, err
+	}
 	dict := starlark.Dict{}
-	for _, k := range val.MapKeys() {
-		key, err := toValue(k)
+	for _, k := range mapKeys(val, o) {
+		key, err := toValue(k, o.child())
 		if err != nil {
 			return nil, err
 		}
 
-		val, err := toValue(val.MapIndex(k))
+		val, err := toValue(val.MapIndex(k), o.child())
 		if err != nil {
 			return nil, err
 		}
-		dict.SetKey(key, val)
+		if err := dict.SetKey(key, val); err != nil {
+			return nil, err
+		}
 	}
 	return &dict, nil
 }
 
+// structDict converts the struct, or pointer to struct, val to a dict of its
+// exported fields.  Structs that point back to themselves, directly or
+// through the structs they point to, can't be converted, since the dicts would
+// never end.
+func structDict(val reflect.Value, o *options) (starlark.Value, error) {
+	if val.Kind() == reflect.Ptr {
+		key := visit{val.Type(), val.Pointer()}
+		for p := o.parentStructs(); p != nil; p = p.parent {
+			if p.visit == key {
+				return nil, fmt.Errorf("can't convert %s: it refers to itself", val.Type())
+			}
+		}
+		c := options{}
+		if o != nil {
+			c = *o
+		}
+		c.parents = &structPath{visit: key, parent: c.parents}
+		o = &c
+		val = val.Elem()
+	}
+	t := val.Type()
+	dict := starlark.NewDict(t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, ok := o.fieldName(f)
+		if !ok || (o.omitEmpty(f) && val.Field(i).IsZero()) {
+			continue
+		}
+		v, err := fieldValue(f, val.Field(i), o.child())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if err := dict.SetKey(starlark.String(name), v); err != nil {
+			return nil, err
+		}
+	}
+	if o.isFrozen() {
+		dict.Freeze()
+	}
+	return dict, nil
+}
+
+// fieldValue converts the value v of the struct field f, as a set if the field
+// is tagged `starlark:",set"`.
+func fieldValue(f reflect.StructField, v reflect.Value, o *options) (starlark.Value, error) {
+	if hasTagOption(f, "set") && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+		return makeSet(v, o)
+	}
+	return toValue(v, o)
+}
+
+// starlarkStruct converts the struct, or pointer to struct, val to a
+// starlarkstruct.Struct of its exported fields.
+func starlarkStruct(val reflect.Value, o *options) (starlark.Value, error) {
+	d, err := structDict(val, o)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(starlark.StringDict, d.(*starlark.Dict).Len())
+	for _, item := range d.(*starlark.Dict).Items() {
+		fields[string(item[0].(starlark.String))] = item[1]
+	}
+	s := starlarkstruct.FromStringDict(starlarkstruct.Default, fields)
+	if o.isFrozen() {
+		s.Freeze()
+	}
+	return s, nil
+}
+
+// FromStarlarkStruct converts a starlarkstruct.Struct to a
+// map[string]interface{} of its fields, converted with FromValue.
+func FromStarlarkStruct(s *starlarkstruct.Struct) map[string]interface{} {
+	ret, err := fromStarlarkStruct(s)
+	if err != nil {
+		panic(err)
+	}
+	return ret.(map[string]interface{})
+}
+
+func fromStarlarkStruct(s *starlarkstruct.Struct) (interface{}, error) {
+	ret := make(map[string]interface{}, len(s.AttrNames()))
+	for _, name := range s.AttrNames() {
+		// the names come from the struct, so there's always a field.
+		v, _ := s.Attr(name)
+		val, err := fromValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		ret[name] = val
+	}
+	return ret, nil
+}
+
 // FromDict converts a starlark.Dict to a map[interface{}]interface{}
 func FromDict(m *starlark.Dict) map[interface{}]interface{} {
+	ret, err := fromDict(m)
+	if err != nil {
+		panic(err)
+	}
+	return ret.(map[interface{}]interface{})
+}
+
+func fromDict(m *starlark.Dict) (interface{}, error) {
 	ret := make(map[interface{}]interface{}, m.Len())
 	for _, k := range m.Keys() {
-		key := FromValue(k)
+		key, err := mapKey(k)
+		if err != nil {
+			return nil, err
+		}
 		// should never be not found or unhashable, so ignore err and found.
 		val, _, _ := m.Get(k)
 		ret[key] = val
 	}
-	return ret
+	return ret, nil
+}
+
+// mapKey converts the dict key or set element k to a go value that can be a
+// map key, since e.g. tuples convert to slices, which can't.
+func mapKey(k starlark.Value) (interface{}, error) {
+	key, err := fromValue(k)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil && !reflect.ValueOf(key).Comparable() {
+		return nil, fmt.Errorf("%s key converts to unhashable type %T", k.Type(), key)
+	}
+	return key, nil
+}
+
+// FromStringKeyedDict converts a starlark.Dict whose keys are all strings to a
+// map[string]interface{}, which JSON encoders and templates accept, converting
+// the values with FromValue.  It returns an error listing any keys that aren't
+// strings.
+func FromStringKeyedDict(m *starlark.Dict) (map[string]interface{}, error) {
+	ret := make(map[string]interface{}, m.Len())
+	var bad []string
+	for _, item := range m.Items() {
+		k, ok := item[0].(starlark.String)
+		if !ok {
+			bad = append(bad, item[0].String())
+			continue
+		}
+		val, err := fromValue(item[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+		ret[string(k)] = val
+	}
+	if len(bad) > 0 {
+		return nil, fmt.Errorf("dict has non-string keys: %s", strings.Join(bad, ", "))
+	}
+	return ret, nil
 }
 
 // MakeSet makes a Set from the given map.  The acceptable keys
@@ -221,17 +623,83 @@ func MakeSet(s map[interface{}]bool) (*starlark.Set, error) {
 	return &set, nil
 }
 
+// MakeSetFrom makes a Set from the given map or slice, or pointer to one.  The
+// keys of maps with bool values are in the set if their value is true, and the
+// keys of maps with struct{} values, such as map[string]struct{}, are all in
+// the set.  The elements of slices and arrays are all in the set.  The
+// acceptable keys and elements are the same as ToValue.
+func MakeSetFrom(s interface{}) (*starlark.Set, error) {
+	return makeSet(reflect.ValueOf(s), nil)
+}
+
+func makeSet(val reflect.Value, o *options) (*starlark.Set, error) {
+	if !val.IsValid() {
+		return nil, errors.New("can't make set of nil")
+	}
+	if val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil, fmt.Errorf("can't make set of nil %s", val.Type())
+		}
+		val = val.Elem()
+	}
+	if err := o.checkLimits(val); err != nil {
+		return nil, err
+	}
+	var elems []reflect.Value
+	switch {
+	case val.Kind() == reflect.Slice || val.Kind() == reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			elems = append(elems, val.Index(i))
+		}
+	case !isSetMap(val.Type()):
+		return nil, fmt.Errorf("can't make set of %s", val.Type())
+	case val.Type().Elem().Kind() == reflect.Bool:
+		for _, k := range mapKeys(val, o) {
+			if val.MapIndex(k).Bool() {
+				elems = append(elems, k)
+			}
+		}
+	default:
+		elems = mapKeys(val, o)
+	}
+	set := starlark.NewSet(len(elems))
+	for _, e := range elems {
+		v, err := toValue(e, o.child())
+		if err != nil {
+			return nil, err
+		}
+		if err := set.Insert(v); err != nil {
+			return nil, err
+		}
+	}
+	if o.isFrozen() {
+		set.Freeze()
+	}
+	return set, nil
+}
+
 // FromSet converts a starlark.Set to a map[interface{}]bool
 func FromSet(s *starlark.Set) map[interface{}]bool {
+	ret, err := fromSet(s)
+	if err != nil {
+		panic(err)
+	}
+	return ret.(map[interface{}]bool)
+}
+
+func fromSet(s *starlark.Set) (interface{}, error) {
 	ret := make(map[interface{}]bool, s.Len())
 	var v starlark.Value
 	i := s.Iterate()
 	defer i.Done()
 	for i.Next(&v) {
-		val := FromValue(v)
+		val, err := mapKey(v)
+		if err != nil {
+			return nil, err
+		}
 		ret[val] = true
 	}
-	return ret
+	return ret, nil
 }
 
 // Kwarg is a single instance of a python foo=bar style named argument.
@@ -259,7 +727,21 @@ func FromKwargs(kwargs []starlark.Tuple) ([]Kwarg, error) {
 	return args, nil
 }
 
-var errType = reflect.TypeOf((*error)(nil)).Elem()
+var (
+	errType           = reflect.TypeOf((*error)(nil)).Elem()
+	starlarkValueType = reflect.TypeOf((*starlark.Value)(nil)).Elem()
+	threadType        = reflect.TypeOf((*starlark.Thread)(nil))
+)
+
+// threadParams returns 1 if the function type t's first parameter is a
+// *starlark.Thread, which is passed the calling thread instead of an argument,
+// and 0 otherwise.
+func threadParams(t reflect.Type) int {
+	if t.NumIn() > 0 && t.In(0) == threadType {
+		return 1
+	}
+	return 0
+}
 
 // MakeStarFn creates a wrapper around the given function that can be called from
 // a starlark script.  Argument support is the same as ToValue. If the last value
@@ -267,56 +749,555 @@ var errType = reflect.TypeOf((*error)(nil)).Elem()
 // the starlark function.  If there are no other errors, the function will return
 // None.  If there's exactly one other value, the function will return the
 // starlark equivalent of that value.  If there is more than one return value,
-// they'll be returned as a tuple.  MakeStarFn will panic if you pass it
-// something other than a function.
+// they'll be returned as a tuple, unless MakeStarFnWithOptions configures
+// otherwise with Results.  MakeStarFn will panic if you pass it something
+// other than a function.
+//
+// If the function's last parameter is a struct, or a pointer to a struct,
+// scripts can pass its fields as keyword arguments instead, named as the
+// fields of wrapped structs are, e.g. fetch(url, Timeout=5) for
+// func(url string, opts FetchOptions).  Fields without a keyword argument are
+// left as the zero value.
+//
+// If the function's first parameter is a *starlark.Thread, it's passed the
+// calling thread rather than an argument, e.g. to read thread locals, report
+// the script's position, or call back into starlark.
+//
+// Parameters of starlark types, such as starlark.Value, starlark.Callable or
+// *starlark.Dict, are passed the script's values as they are, rather than
+// converted to Go values.
+//
+// Pointer parameters are passed the address of wrapped values that have one,
+// such as a field of a struct held by pointer, so that the function can change
+// them, and otherwise a pointer to a new value converted from the argument,
+// e.g. a struct decoded from a dict.  Interface parameters are passed such
+// addresses too, if the type's pointer methods implement the interface.
+//
+// Results that are receive-only channels or iterator functions (see NewGoSeq)
+// are returned as lazy iterables, so that scripts can write "for x in
+// stream()" without the function collecting its results first.  Loops over a
+// channel stop when the run's context is done (see ThreadContext).
+//
+// If the function panics, the script fails with a *PanicError, rather than the
+// panic crashing the host.
 func MakeStarFn(name string, gofn interface{}) *starlark.Builtin {
 	v := reflect.ValueOf(gofn)
 	if v.Kind() != reflect.Func {
 		panic(errors.New("fn is not a function"))
 	}
-	return makeStarFn(name, v)
+	return deprecateFn(makeStarFn(name, v, nil), v, nil)
+}
+
+// MakeNamedStarFn is like MakeStarFn, but scripts can also pass arguments by
+// keyword, using paramNames as the names of the function's parameters, in
+// order, e.g. MakeNamedStarFn("resize", resize, "width", "height") lets
+// scripts call resize(height=2, width=1).  Parameters after the named ones can
+// only be passed positionally.  MakeNamedStarFn will panic if there are more
+// names than the function has parameters, not counting a variadic one.
+//
+// As in python, a "*" among the names makes the parameters after it
+// keyword-only, so that e.g. MakeNamedStarFn("render", render, "text", "*",
+// "bold", "italic") lets scripts call render("hi", bold=True) but not the
+// ambiguous render("hi", True, False).  Extra positional arguments of a
+// variadic function go to its variadic parameter, as with def f(a, *args, b).
+func MakeNamedStarFn(name string, gofn interface{}, paramNames ...string) *starlark.Builtin {
+	return MakeStarFnWithDefaults(name, gofn, paramNames)
+}
+
+// MakeStarFnWithDefaults is like MakeNamedStarFn, but scripts can leave out
+// the function's last len(defaults) parameters, which then get the given
+// values, as with the optional parameters of starlark.UnpackArgs.  For
+// example, MakeStarFnWithDefaults("fetch", fetch, []string{"url", "retries"}, 3)
+// lets scripts call fetch(url) as well as fetch(url, retries=5).  paramNames
+// may be nil, so that arguments can only be passed positionally.  The
+// defaults are converted as by ToValue and frozen, and MakeStarFnWithDefaults
+// will panic if they can't be passed as their parameters.
+//
+// The arguments are unpacked with starlark.UnpackArgs before they're
+// converted, so scripts get the calling conventions and error messages of
+// starlark's own builtins, e.g. "fetch: missing argument for url".
+// Parameters without names are called arg0, arg1 and so on in the messages.
+func MakeStarFnWithDefaults(name string, gofn interface{}, paramNames []string, defaults ...interface{}) *starlark.Builtin {
+	v := reflect.ValueOf(gofn)
+	if v.Kind() != reflect.Func {
+		panic(errors.New("fn is not a function"))
+	}
+	skip := threadParams(v.Type())
+	p := params{numIn: v.Type().NumIn() - skip, variadic: v.Type().IsVariadic(), kwOnly: -1}
+	if p.variadic {
+		p.numIn--
+	}
+	if i := indexOf(paramNames, "*"); i >= 0 {
+		if indexOf(paramNames[i+1:], "*") >= 0 {
+			panic(errors.New(`more than one "*" in parameter names`))
+		}
+		p.kwOnly = i
+		paramNames = append(paramNames[:i:i], paramNames[i+1:]...)
+	}
+	p.names = paramNames
+	p.fields = !p.variadic && p.numIn > 0 && isStructType(v.Type().In(skip+p.numIn-1))
+	if len(paramNames) > p.numIn {
+		panic(fmt.Errorf("%d parameter names given for a function with %d parameters", len(paramNames), p.numIn))
+	}
+	if len(defaults) > p.numIn {
+		panic(fmt.Errorf("%d defaults given for a function with %d parameters", len(defaults), p.numIn))
+	}
+	for i, d := range defaults {
+		val, err := ToValue(d)
+		if err != nil {
+			panic(fmt.Errorf("default %d: %v", i, err))
+		}
+		t := v.Type().In(skip + p.numIn - len(defaults) + i)
+		if _, ok, err := goValue(val, t); err != nil || !ok {
+			panic(fmt.Errorf("default %d: can't pass %T as %v", i, d, t))
+		}
+		// every call shares the default, so scripts can't change it.
+		val.Freeze()
+		p.defaults = append(p.defaults, val)
+	}
+	fn := deprecateFn(makeStarFn(name, v, nil), v, nil)
+	return starlark.NewBuiltin(name, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		args, kwargs, err := p.args(name, args, kwargs)
+		if err != nil {
+			return nil, err
+		}
+		return fn.CallInternal(thread, args, kwargs)
+	})
+}
+
+// params describes the parameters of a function made by
+// MakeStarFnWithDefaults: the names of the first len(names) of its numIn
+// parameters, not counting a variadic one, the defaults of the last
+// len(defaults), the index of the first keyword-only parameter, or -1, and
+// whether the last is a struct whose fields scripts can pass as keyword
+// arguments.
+type params struct {
+	names    []string
+	defaults []starlark.Value
+	numIn    int
+	kwOnly   int
+	variadic bool
+	fields   bool
+}
+
+// args unpacks the arguments of a call to the function named fnName with
+// starlark.UnpackArgs.  It returns the positional arguments to call the Go
+// function with, with the keyword arguments that name parameters and the
+// defaults of the parameters left out put in place, and the other keyword
+// arguments, which may set the fields of a trailing struct parameter.
+func (p *params) args(fnName string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Tuple, []starlark.Tuple, error) {
+	var named, rest []starlark.Tuple
+	for _, kv := range kwargs {
+		switch {
+		case indexOf(p.names, string(kv[0].(starlark.String))) >= 0:
+			named = append(named, kv)
+		case p.fields:
+			rest = append(rest, kv)
+		default:
+			// unnamed parameters can't be passed by keyword.
+			return nil, nil, fmt.Errorf("%s: unexpected keyword argument %s", fnName, kv[0])
+		}
+	}
+	var extra starlark.Tuple
+	positional := p.numIn
+	if p.kwOnly >= 0 {
+		positional = p.kwOnly
+	}
+	if len(args) > positional {
+		switch {
+		case p.variadic:
+			args, extra = args[:positional], args[positional:]
+		case p.kwOnly >= 0:
+			return nil, nil, fmt.Errorf("%s: got %d positional arguments, want at most %d (%s must be passed by keyword)", fnName, len(args), positional, p.name(positional))
+		}
+	}
+	firstDefault := p.numIn - len(p.defaults)
+	structKwargs := len(rest) > 0 && len(args) < p.numIn
+	slots := make([]starlark.Value, p.numIn, p.numIn+len(extra))
+	pairs := make([]interface{}, 0, 2*p.numIn)
+	for i := range slots {
+		name := p.name(i)
+		if i >= firstDefault || (structKwargs && i == p.numIn-1) {
+			name += "?"
+		}
+		pairs = append(pairs, name, &slots[i])
+	}
+	if err := starlark.UnpackArgs(fnName, args, named, pairs...); err != nil {
+		return nil, nil, err
+	}
+	for i := len(args); i < p.numIn; i++ {
+		if slots[i] != nil {
+			continue
+		}
+		if structKwargs && i == p.numIn-1 {
+			// the other keyword arguments are the fields of this struct
+			// parameter.
+			return slots[:i], rest, nil
+		}
+		slots[i] = p.defaults[i-firstDefault]
+	}
+	return append(slots, extra...), rest, nil
 }
 
-func makeStarFn(name string, gofn reflect.Value) *starlark.Builtin {
-	if gofn.Type().IsVariadic() {
-		return makeVariadicStarFn(name, gofn)
+// name returns the name of the i'th parameter in error messages.
+func (p *params) name(i int) string {
+	if i < len(p.names) {
+		return p.names[i]
+	}
+	return fmt.Sprintf("arg%d", i)
+}
+
+// indexOf returns the index of s in list, or -1 if it's not there.
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// BindMethods returns a builtin for each exported method of recv, bound to
+// recv, keyed by method name, e.g. to expose a service object's methods as
+// globals.  If recv is not a pointer, methods with pointer receivers are
+// included too, bound to a copy of recv.
+func BindMethods(recv interface{}) starlark.StringDict {
+	return bindMethods(reflect.ValueOf(recv), nil)
+}
+
+// MakeStarMethods returns a module called name with the methods of recv as its
+// members, bound as by BindMethods, so that e.g. a Go service client can be
+// added to a script's globals as client and called as client.GetUser(id).
+// The options apply to the methods' arguments and results, and the Naming
+// option names the members as it does the methods of structs, e.g.
+// client.get_user(id) with Naming(SnakeCase).
+func MakeStarMethods(name string, recv interface{}, opts ...Option) *starlarkstruct.Module {
+	return &starlarkstruct.Module{Name: name, Members: bindMethods(reflect.ValueOf(recv), makeOptions(opts))}
+}
+
+// bindMethods returns a builtin for each exported method of v, keyed by the
+// name scripts call it.
+func bindMethods(v reflect.Value, o *options) starlark.StringDict {
+	if !v.IsValid() {
+		return starlark.StringDict{}
+	}
+	if v.Kind() != reflect.Ptr {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		v = p
+	}
+	ret := make(starlark.StringDict, v.NumMethod())
+	for i := 0; i < v.NumMethod(); i++ {
+		name := o.methodName(v.Type().Method(i).Name)
+		ret[name] = makeStarFn(name, v.Method(i), o)
+	}
+	return ret
+}
+
+func makeStarFn(name string, gofn reflect.Value, o *options) *starlark.Builtin {
+	p := planFn(gofn.Type())
+	if p.variadic != nil {
+		return makeVariadicStarFn(name, gofn, p, o)
 	}
 	return starlark.NewBuiltin(name, func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-		if len(args) != gofn.Type().NumIn() {
-			return starlark.None, fmt.Errorf("expected %d args but got %d", gofn.Type().NumIn(), len(args))
-		}
-		vals := FromTuple(args)
-		rvs := make([]reflect.Value, 0, len(vals))
-		for i, v := range vals {
-			val := reflect.ValueOf(v)
-			argT := gofn.Type().In(i)
-			if !val.Type().AssignableTo(argT) {
-				if !val.Type().ConvertibleTo(argT) {
-					return starlark.None, fmt.Errorf("arg %d expected type %v got %v", i, argT, val.Type())
-				}
-				val = val.Convert(argT)
+		numIn := len(p.params)
+		if len(kwargs) > 0 {
+			if len(args) != numIn-1 || !p.fields {
+				return starlark.None, fmt.Errorf("unexpected keyword argument %s", kwargs[0][0])
+			}
+		} else if len(args) != numIn {
+			return starlark.None, fmt.Errorf("expected %d args but got %d", numIn, len(args))
+		}
+		rvs := make([]reflect.Value, 0, p.skip+numIn)
+		if p.skip > 0 {
+			rvs = append(rvs, reflect.ValueOf(thread))
+		}
+		for i, arg := range args {
+			val, err := p.params[i].convert(i, arg)
+			if err != nil {
+				return starlark.None, err
 			}
 			rvs = append(rvs, val)
 		}
-		out := gofn.Call(rvs)
-		return makeOut(out)
+		if len(kwargs) > 0 {
+			val, err := kwargsValue(p.params[numIn-1].t, kwargs, o)
+			if err != nil {
+				return starlark.None, err
+			}
+			rvs = append(rvs, val)
+		}
+		out, err := callGo(thread, name, gofn, rvs, o)
+		if err != nil {
+			return starlark.None, err
+		}
+		if p.streams {
+			return makeOut(out, o.withThread(thread))
+		}
+		return makeOut(out, o)
 	})
 }
 
-func makeOut(out []reflect.Value) (starlark.Value, error) {
+// fnPlan is how to convert the arguments of a Go function, worked out once
+// when it's wrapped rather than on every call.
+type fnPlan struct {
+	// skip is 1 if the function is passed the calling thread.
+	skip int
+	// params are the parameters scripts pass, not counting a variadic one.
+	params []param
+	// variadic is the element of the variadic parameter, if there is one.
+	variadic *param
+	// fields reports whether the last parameter is a struct whose fields
+	// scripts can pass as keyword arguments.
+	fields bool
+	// streams reports whether a result is a receive-only channel or an
+	// iterator function, which need the calling thread to stop iterating when
+	// the run is cancelled, and to fail the script if the iterator panics.
+	streams bool
+}
+
+// param converts the arguments passed for a parameter of type t.
+type param struct {
+	t    reflect.Type
+	fast func(starlark.Value) (reflect.Value, bool)
+}
+
+// planFn works out how to convert the arguments of functions of type t.
+func planFn(t reflect.Type) *fnPlan {
+	p := &fnPlan{skip: threadParams(t)}
+	numIn := t.NumIn()
+	if t.IsVariadic() {
+		numIn--
+		p.variadic = &param{t: t.In(numIn).Elem(), fast: fastConverter(t.In(numIn).Elem())}
+	}
+	for i := p.skip; i < numIn; i++ {
+		p.params = append(p.params, param{t: t.In(i), fast: fastConverter(t.In(i))})
+	}
+	p.fields = p.variadic == nil && len(p.params) > 0 && isStructType(p.params[len(p.params)-1].t)
+	for i := 0; i < t.NumOut(); i++ {
+		p.streams = p.streams || isRecvChan(t.Out(i)) || isSeq(t.Out(i))
+	}
+	return p
+}
+
+// convert converts arg, the i'th argument, to the parameter's type.
+func (p *param) convert(i int, arg starlark.Value) (reflect.Value, error) {
+	if p.fast != nil && !hasReverseConverter(p.t) {
+		if val, ok := p.fast(arg); ok {
+			return val, nil
+		}
+	}
+	val, ok, err := goValue(arg, p.t)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("arg %d: %v", i, err)
+	}
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("arg %d: expected %v, got %s", i, p.t, arg.Type())
+	}
+	return val, nil
+}
+
+var (
+	stringType  = reflect.TypeOf("")
+	int64Type   = reflect.TypeOf(int64(0))
+	float64Type = reflect.TypeOf(float64(0))
+)
+
+// fastConverter returns a function that converts the starlark values that
+// correspond exactly to t, a predeclared type, without going through goValue.
+// It returns false for other values, which goValue converts or reports.
+func fastConverter(t reflect.Type) func(starlark.Value) (reflect.Value, bool) {
+	switch t {
+	case stringType:
+		return func(v starlark.Value) (reflect.Value, bool) {
+			s, ok := v.(starlark.String)
+			return reflect.ValueOf(string(s)), ok
+		}
+	case boolType:
+		return func(v starlark.Value) (reflect.Value, bool) {
+			b, ok := v.(starlark.Bool)
+			return reflect.ValueOf(bool(b)), ok
+		}
+	case intType, int64Type:
+		return func(v starlark.Value) (reflect.Value, bool) {
+			i, ok := v.(starlark.Int)
+			if !ok {
+				return reflect.Value{}, false
+			}
+			n, ok := i.Int64()
+			if !ok || reflect.Zero(t).OverflowInt(n) {
+				return reflect.Value{}, false
+			}
+			return reflect.ValueOf(n).Convert(t), true
+		}
+	case float64Type:
+		return func(v starlark.Value) (reflect.Value, bool) {
+			f, ok := v.(starlark.Float)
+			return reflect.ValueOf(float64(f)), ok
+		}
+	}
+	return nil
+}
+
+// PanicError is the error returned to a script when a Go function it called
+// panics, so that the panic fails the script instead of crashing its host.
+type PanicError struct {
+	// Func is the name of the function.
+	Func string
+	// Value is the value the function panicked with.
+	Value interface{}
+	// Stack is the Go stack where the function panicked, if it was converted
+	// with the PanicStacks option.
+	Stack []byte
+}
+
+// Error returns the function's name and panic value, and its stack if there is
+// one.
+func (e *PanicError) Error() string {
+	if len(e.Stack) > 0 {
+		return fmt.Sprintf("%s panicked: %v\n%s", e.Func, e.Value, e.Stack)
+	}
+	return fmt.Sprintf("%s panicked: %v", e.Func, e.Value)
+}
+
+// callGo calls gofn with args for the thread, with the deadline set by the
+// CallTimeout option, if any.  If the deadline passes or the run is cancelled
+// before gofn returns, callGo cancels the thread and returns an error.  It
+// doesn't wait for functions that don't take the thread, which are left to
+// finish in the background, but functions that take the thread may call back
+// into starlark with it, so they're called on the calling goroutine, and
+// must stop when the thread's context is done.
+func callGo(thread *starlark.Thread, name string, gofn reflect.Value, args []reflect.Value, o *options) ([]reflect.Value, error) {
+	d := o.callTimeout()
+	if d <= 0 || thread == nil {
+		return recoverCall(name, gofn, args, o)
+	}
+	parent := ThreadContext(thread)
+	ctx, cancel := context.WithTimeout(parent, d)
+	defer cancel()
+	// gofn can read the deadline with ThreadContext, e.g. to pass it to an
+	// RPC.
+	SetThreadContext(thread, ctx)
+	defer SetThreadContext(thread, parent)
+	var out []reflect.Value
+	var err error
+	if threadParams(gofn.Type()) > 0 {
+		out, err = recoverCall(name, gofn, args, o)
+	} else {
+		type result struct {
+			out []reflect.Value
+			err error
+		}
+		done := make(chan result, 1)
+		go func() {
+			out, err := recoverCall(name, gofn, args, o)
+			done <- result{out, err}
+		}()
+		select {
+		case r := <-done:
+			out, err = r.out, r.err
+		case <-ctx.Done():
+		}
+	}
+	if ctx.Err() == nil {
+		return out, err
+	}
+	err = fmt.Errorf("%s: %v", name, ctx.Err())
+	if parent.Err() == nil {
+		err = fmt.Errorf("%s: timed out after %v", name, d)
+	}
+	thread.Cancel(err.Error())
+	return nil, err
+}
+
+// recoverCall calls gofn with args, returning a PanicError if it panics.
+func recoverCall(name string, gofn reflect.Value, args []reflect.Value, o *options) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			pe := &PanicError{Func: name, Value: r}
+			if o.panicStacks() {
+				pe.Stack = debug.Stack()
+			}
+			out, err = nil, pe
+		}
+	}()
+	return gofn.Call(args), nil
+}
+
+// allocField returns the field of the struct v with the given index,
+// allocating the nil embedded pointers it's promoted through.  Embedded
+// pointers to unexported types can't be allocated.
+func allocField(v reflect.Value, index []int) (reflect.Value, error) {
+	for _, i := range index[:len(index)-1] {
+		name := v.Type().Field(i).Name
+		v = v.Field(i)
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("embedded %s is nil", name)
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+	}
+	return v.Field(index[len(index)-1]), nil
+}
+
+// isStructType reports whether t is a struct or pointer to a struct.
+func isStructType(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct || (t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct)
+}
+
+// kwargsValue makes a value of the struct type t, or pointer to struct type t,
+// with the fields named by kwargs set to their values.
+func kwargsValue(t reflect.Type, kwargs []starlark.Tuple, o *options) (reflect.Value, error) {
+	st := t
+	if t.Kind() == reflect.Ptr {
+		st = t.Elem()
+	}
+	ptr := reflect.New(st)
+	for _, kv := range kwargs {
+		name := string(kv[0].(starlark.String))
+		f, ok := o.fieldByName(st, name)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unexpected keyword argument %s", kv[0])
+		}
+		field, err := allocField(ptr.Elem(), f.Index)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%s: %v", name, err)
+		}
+		val, ok, err := goValue(kv[1], f.Type)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%s: %v", name, err)
+		}
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("%s: expected %v, got %s", name, f.Type, kv[1].Type())
+		}
+		field.Set(val)
+	}
+	if t.Kind() == reflect.Ptr {
+		return ptr, nil
+	}
+	return ptr.Elem(), nil
+}
+
+func makeOut(out []reflect.Value, o *options) (starlark.Value, error) {
 	if len(out) == 0 {
 		return starlark.None, nil
 	}
 	last := out[len(out)-1]
 	var err error
-	if last.Type() == errType {
+	if last.Type() == errType && o.results() != RawResults {
 		if v := last.Interface(); v != nil {
 			err = v.(error)
 		}
 		out = out[:len(out)-1]
 	}
-	if len(out) == 1 {
-		v, err2 := toValue(out[0])
+	if len(out) == 0 {
+		return starlark.None, err
+	}
+	if len(out) == 1 || o.results() == FirstResult {
+		v, err2 := resultValue(out[0], o)
 		if err2 != nil {
 			return starlark.None, err2
 		}
@@ -325,51 +1306,91 @@ func makeOut(out []reflect.Value) (starlark.Value, error) {
 	res := make([]starlark.Value, 0, len(out))
 	// tuple-up multple values
 	for i := range out {
-		val, err := toValue(out[i])
+		val, err := resultValue(out[i], o)
 		if err != nil {
 			return starlark.None, err
 		}
 		res = append(res, val)
 	}
-	return starlark.Tuple(res), nil
+	switch o.results() {
+	case ListResults:
+		return starlark.NewList(res), err
+	case DictResults:
+		d := starlark.NewDict(len(res))
+		for i, v := range res {
+			if err := d.SetKey(starlark.String(o.resultName(i)), v); err != nil {
+				return starlark.None, err
+			}
+		}
+		return d, err
+	}
+	return starlark.Tuple(res), err
 }
 
-func makeVariadicStarFn(name string, gofn reflect.Value) *starlark.Builtin {
+// resultValue converts a result of a Go function.  With RawResults, errors
+// are returned to scripts as their message, or None.  Receive-only channels
+// and iterator functions become lazy iterables, so that functions can stream
+// their results to scripts.
+func resultValue(v reflect.Value, o *options) (starlark.Value, error) {
+	switch {
+	case v.Type() == errType && o.results() == RawResults:
+		if v.IsNil() {
+			return starlark.None, nil
+		}
+		return starlark.String(v.Interface().(error).Error()), nil
+	case isRecvChan(v.Type()) || isSeq(v.Type()):
+		if val, ok, err := toRegistered(v, o); ok {
+			return val, err
+		}
+		if v.IsNil() {
+			return starlark.None, nil
+		}
+		if v.Kind() == reflect.Chan {
+			return wrapChan(&GoChan{v: v, opts: o}), nil
+		}
+		return &GoSeq{v: v, opts: o}, nil
+	}
+	return toValue(v, o)
+}
+
+// isRecvChan reports whether t is a receive-only channel.
+func isRecvChan(t reflect.Type) bool {
+	return t.Kind() == reflect.Chan && t.ChanDir() == reflect.RecvDir
+}
+
+func makeVariadicStarFn(name string, gofn reflect.Value, p *fnPlan, o *options) *starlark.Builtin {
 	return starlark.NewBuiltin(name, func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-		minArgs := gofn.Type().NumIn() - 1
+		minArgs := len(p.params)
+		if len(kwargs) > 0 {
+			return starlark.None, fmt.Errorf("unexpected keyword argument %s", kwargs[0][0])
+		}
 		if len(args) < minArgs {
 			return starlark.None, fmt.Errorf("expected at least %d args but got %d", minArgs, len(args))
 		}
-		vals := FromTuple(args)
-		rvs := make([]reflect.Value, 0, len(args))
-
-		// grab all the non-variadics first
-		for i := 0; i < minArgs; i++ {
-			val := reflect.ValueOf(vals[i])
-			argT := gofn.Type().In(i)
-			if !val.Type().AssignableTo(argT) {
-				if !val.Type().ConvertibleTo(argT) {
-					return starlark.None, fmt.Errorf("arg %d expected type %v got %v", i, argT, val.Type())
-				}
-				val = val.Convert(argT)
-			}
-			rvs = append(rvs, val)
+		rvs := make([]reflect.Value, 0, p.skip+len(args))
+		if p.skip > 0 {
+			rvs = append(rvs, reflect.ValueOf(thread))
 		}
-		// last "in" type by definition must be a slice of something. We need to
-		// know what something so we can convert things as needed.
-		vtype := gofn.Type().In(gofn.Type().NumIn() - 1).Elem()
-		// the rest of the args need to be batched into a slice for the variadic
-		for i := minArgs; i < len(vals); i++ {
-			val := reflect.ValueOf(vals[i])
-			if !val.Type().AssignableTo(vtype) {
-				if !val.Type().ConvertibleTo(vtype) {
-					return starlark.None, fmt.Errorf("arg %d expected type %v got %v", i, vtype, val.Type())
-				}
-				val = val.Convert(vtype)
+		for i, arg := range args {
+			// the args after the non-variadics are batched into a slice
+			// for the variadic.
+			param := p.variadic
+			if i < minArgs {
+				param = &p.params[i]
+			}
+			val, err := param.convert(i, arg)
+			if err != nil {
+				return starlark.None, err
 			}
 			rvs = append(rvs, val)
 		}
-		out := gofn.Call(rvs)
-		return makeOut(out)
+		out, err := callGo(thread, name, gofn, rvs, o)
+		if err != nil {
+			return starlark.None, err
+		}
+		if p.streams {
+			return makeOut(out, o.withThread(thread))
+		}
+		return makeOut(out, o)
 	})
 }
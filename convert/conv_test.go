@@ -2,6 +2,7 @@ package convert
 
 import (
 	"fmt"
+	"math/big"
 	"reflect"
 	"testing"
 
@@ -11,7 +12,7 @@ import (
 func TestKwargs(t *testing.T) {
 	// Mental note: starlark numbers pop out as int64s
 	data := []byte(`
-func("a", 1, foo=1, foo=2)
+func("a", 1, foo=1, bar=2)
 `)
 
 	thread := &starlark.Thread{
@@ -43,7 +44,7 @@ func("a", 1, foo=1, foo=2)
 	if len(expArgs) != len(goargs) {
 		t.Fatalf("expected %d args, but got %d", len(expArgs), len(goargs))
 	}
-	expKwargs := []Kwarg{{Name: "foo", Value: int64(1)}, {Name: "foo", Value: int64(2)}}
+	expKwargs := []Kwarg{{Name: "foo", Value: int64(1)}, {Name: "bar", Value: int64(2)}}
 
 	if !reflect.DeepEqual(expArgs, goargs) {
 		t.Errorf("expected args %#v, got args %#v", expArgs, goargs)
@@ -159,7 +160,7 @@ func TestStructAttrNames(t *testing.T) {
 	c := &contact{}
 	s := NewStruct(c)
 	names := s.AttrNames()
-	expected := []string{"Name", "age", "Foo", "Bar"}
+	expected := []string{"Name", "Foo", "Bar", "to_dict"}
 	for _, s := range names {
 		if !contains(expected, s) {
 			t.Errorf("output contains extra value %q", s)
@@ -181,3 +182,145 @@ func contains(list []string, s string) bool {
 	}
 	return false
 }
+
+func TestFromValueErr(t *testing.T) {
+	d := starlark.NewDict(1)
+	d.SetKey(starlark.Tuple{starlark.MakeInt(1)}, starlark.True)
+	if _, err := FromValueErr(d); err == nil || err.Error() != "can't convert dict to a go value: tuple key converts to unhashable type []interface {}" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	s := starlark.NewSet(1)
+	s.Insert(starlark.Tuple{starlark.MakeInt(1)})
+	l := starlark.NewList([]starlark.Value{s})
+	if _, err := FromValueErr(l); err == nil || err.Error() != "can't convert list to a go value: tuple key converts to unhashable type []interface {}" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	v, err := FromValueErr(starlark.MakeInt(1).Lsh(70))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(*big.Int); !ok {
+		t.Fatalf("expected *big.Int, got %T", v)
+	}
+}
+
+func TestFromStringKeyedDict(t *testing.T) {
+	d := starlark.NewDict(2)
+	d.SetKey(starlark.String("a"), starlark.MakeInt(1))
+	d.SetKey(starlark.String("b"), starlark.NewList([]starlark.Value{starlark.String("x")}))
+	m, err := FromStringKeyedDict(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"a": int64(1), "b": []interface{}{"x"}}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("expected %#v, got %#v", want, m)
+	}
+
+	d.SetKey(starlark.MakeInt(2), starlark.None)
+	d.SetKey(starlark.Tuple{starlark.MakeInt(1), starlark.MakeInt(2)}, starlark.None)
+	_, err = FromStringKeyedDict(d)
+	if err == nil || err.Error() != "dict has non-string keys: 2, (1, 2)" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestToValuesFromValues(t *testing.T) {
+	vals, err := ToValues([]interface{}{1, "a", []byte("b"), starlark.True}, BytesAsString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []starlark.Value{starlark.MakeInt(1), starlark.String("a"), starlark.String("b"), starlark.True}
+	if !reflect.DeepEqual(vals, want) {
+		t.Fatalf("expected %v, got %v", want, vals)
+	}
+	back, err := FromValues(starlark.Tuple(vals), BytesAsString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, []interface{}{int64(1), "a", "b", true}) {
+		t.Fatalf("unexpected %#v", back)
+	}
+
+	_, err = ToValues([]interface{}{1, complex(1, 2)})
+	if err == nil || err.Error() != "value 1: type complex128 is not a supported starlark type" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// a dict with tuple keys can't be a Go map with []interface{} keys.
+	d := starlark.NewDict(1)
+	d.SetKey(starlark.Tuple{starlark.MakeInt(1)}, starlark.True)
+	_, err = FromValues([]starlark.Value{starlark.None, d})
+	if err == nil || err.Error() != "value 1: can't convert dict to a go value: tuple key converts to unhashable type []interface {}" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestMakeSet(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{map[interface{}]bool{"a": true}, `set(["a"])`},
+		{map[string]bool{"a": true, "b": false}, `set(["a"])`},
+		{&map[string]bool{"a": true}, `set(["a"])`},
+		{map[int]struct{}{1: {}}, `set([1])`},
+		{[]string{"a", "a"}, `set(["a"])`},
+	}
+	for _, test := range tests {
+		set, err := MakeSetFrom(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if set.String() != test.want {
+			t.Errorf("MakeSetFrom(%v): expected %s, got %s", test.in, test.want, set)
+		}
+	}
+	if _, err := MakeSetFrom(map[string]int{}); err == nil || err.Error() != "can't make set of map[string]int" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := MakeSetFrom((*map[string]bool)(nil)); err == nil || err.Error() != "can't make set of nil *map[string]bool" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// MakeSet keeps its original behavior of including every key.
+	set, err := MakeSet(map[interface{}]bool{"a": true, "b": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Len() != 2 {
+		t.Fatalf("expected both keys, got %s", set)
+	}
+}
+
+type tagged struct {
+	Tags  map[string]struct{} `starlark:",set"`
+	Names []string            `starlark:",set"`
+	Flags *map[string]bool    `starlark:",set"`
+}
+
+func TestSetFields(t *testing.T) {
+	v := &tagged{Tags: map[string]struct{}{"a": {}}, Names: []string{"x", "x"}}
+	globals := map[string]starlark.Value{"v": NewStruct(v)}
+	code := `
+def run():
+	if type(v.Tags) != "set" or type(v.Names) != "set":
+		fail("expected sets, got %s and %s" % (type(v.Tags), type(v.Names)))
+	if v.Flags != None:
+		fail("expected a nil set pointer to be None, got %s" % v.Flags)
+	if len(v.Names) != 1:
+		fail("expected one name, got %s" % v.Names)
+	v.Tags = v.Tags | set(["b"])
+	v.Names = set(["y"])
+run()
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]struct{}{"a": {}, "b": {}}; !reflect.DeepEqual(v.Tags, want) {
+		t.Fatalf("expected %v, got %v", want, v.Tags)
+	}
+	if want := []string{"y"}; !reflect.DeepEqual(v.Names, want) {
+		t.Fatalf("expected %v, got %v", want, v.Names)
+	}
+}
@@ -0,0 +1,355 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// DivisionScale is the number of digits after the decimal point kept by
+// division of decimals whose own scales are smaller.
+const DivisionScale = 16
+
+// Decimal is an exact fixed-point decimal number, for billing and other
+// scripts where float rounding is unacceptable.  The zero value is 0.
+//
+// Decimals are starlark values, so they can be passed to scripts as is, or as
+// fields of Go structs and results of Go functions.  Scripts make them with
+// the builtin returned by DecimalBuiltin, and can add, subtract, multiply and
+// divide them, including with ints, and negate and compare them.  Starlark
+// only compares values of the same type, so compare decimals with decimals,
+// e.g. total > decimal(0), not total > 0.  Division is exact to
+// DivisionScale places, rounding half to even.  Mixing decimals and floats is
+// an error, since it would lose exactness.
+//
+// Decimals have these methods in scripts:
+//
+//	round(places=0)  rounds half to even to the given number of decimal places
+//	toFloat()        returns the nearest float
+type Decimal struct {
+	// the value is unscaled * 10^-scale.
+	unscaled *big.Int
+	scale    int32
+}
+
+var (
+	_ starlark.HasBinary  = Decimal{}
+	_ starlark.HasUnary   = Decimal{}
+	_ starlark.Comparable = Decimal{}
+	_ starlark.HasAttrs   = Decimal{}
+	_ starlark.Value      = Decimal{}
+	_ fmt.Stringer        = Decimal{}
+)
+
+// NewDecimal returns the decimal unscaled * 10^-scale, e.g. NewDecimal(1999, 2)
+// is 19.99.  It panics if scale is negative.
+func NewDecimal(unscaled int64, scale int32) Decimal {
+	if scale < 0 {
+		panic(fmt.Errorf("negative decimal scale %d", scale))
+	}
+	return Decimal{unscaled: big.NewInt(unscaled), scale: scale}
+}
+
+// ParseDecimal parses a decimal number such as "-12.50".  Exponents are not
+// supported.
+func ParseDecimal(s string) (Decimal, error) {
+	digits := s
+	var scale int32
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		digits = s[:i] + s[i+1:]
+		scale = int32(len(s) - i - 1)
+		if scale == 0 || i == 0 || s[i-1] < '0' || s[i-1] > '9' {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+	}
+	n, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	return Decimal{unscaled: n, scale: scale}, nil
+}
+
+func (d Decimal) int() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+// String returns the decimal with all of its digits, e.g. "19.990".
+func (d Decimal) String() string {
+	s := d.int().String()
+	if d.scale == 0 {
+		return s
+	}
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if pad := int(d.scale) + 1 - len(s); pad > 0 {
+		s = strings.Repeat("0", pad) + s
+	}
+	s = s[:len(s)-int(d.scale)] + "." + s[len(s)-int(d.scale):]
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// Float64 returns the nearest float64 to d.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// Cmp compares d and e, returning -1, 0 or +1.
+func (d Decimal) Cmp(e Decimal) int {
+	x, y := align(d, e)
+	return x.Cmp(y)
+}
+
+// Add returns d + e.
+func (d Decimal) Add(e Decimal) Decimal {
+	x, y := align(d, e)
+	return Decimal{unscaled: new(big.Int).Add(x, y), scale: max32(d.scale, e.scale)}
+}
+
+// Sub returns d - e.
+func (d Decimal) Sub(e Decimal) Decimal {
+	x, y := align(d, e)
+	return Decimal{unscaled: new(big.Int).Sub(x, y), scale: max32(d.scale, e.scale)}
+}
+
+// Mul returns d * e.
+func (d Decimal) Mul(e Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.int(), e.int()), scale: d.scale + e.scale}
+}
+
+// Quo returns d / e, rounded half to even to the larger of the scales of d and
+// e and DivisionScale.  It returns an error if e is zero.
+func (d Decimal) Quo(e Decimal) (Decimal, error) {
+	if e.int().Sign() == 0 {
+		return Decimal{}, errors.New("decimal division by zero")
+	}
+	scale := max32(max32(d.scale, e.scale), DivisionScale)
+	// d/e = (d.unscaled * 10^(scale - d.scale + e.scale) / e.unscaled) * 10^-scale
+	num := new(big.Int).Mul(d.int(), pow10(scale-d.scale+e.scale))
+	return Decimal{unscaled: quoEven(num, e.int()), scale: scale}, nil
+}
+
+// Round returns d rounded half to even to the given number of decimal places.
+func (d Decimal) Round(places int32) Decimal {
+	if places < 0 {
+		places = 0
+	}
+	if places >= d.scale {
+		return d
+	}
+	return Decimal{unscaled: quoEven(d.int(), pow10(d.scale-places)), scale: places}
+}
+
+// align returns the unscaled values of d and e at the same scale.
+func align(d, e Decimal) (*big.Int, *big.Int) {
+	x, y := d.int(), e.int()
+	switch {
+	case d.scale < e.scale:
+		x = new(big.Int).Mul(x, pow10(e.scale-d.scale))
+	case e.scale < d.scale:
+		y = new(big.Int).Mul(y, pow10(d.scale-e.scale))
+	}
+	return x, y
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// quoEven returns x / y rounded half to even.
+func quoEven(x, y *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	// compare 2|r| with |y| to find which way to round.
+	c := new(big.Int).Abs(r)
+	c.Lsh(c, 1)
+	cmp := c.Cmp(new(big.Int).Abs(y))
+	if cmp > 0 || (cmp == 0 && q.Bit(0) == 1) {
+		if x.Sign()*y.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+func max32(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// normalized returns d without trailing zeros after the decimal point.
+func (d Decimal) normalized() Decimal {
+	n, scale := d.int(), d.scale
+	ten := big.NewInt(10)
+	for scale > 0 {
+		q, r := new(big.Int).QuoRem(n, ten, new(big.Int))
+		if r.Sign() != 0 {
+			break
+		}
+		n, scale = q, scale-1
+	}
+	return Decimal{unscaled: n, scale: scale}
+}
+
+// toDecimal converts ints and decimals to decimals.
+func toDecimal(v starlark.Value) (Decimal, bool) {
+	switch v := v.(type) {
+	case Decimal:
+		return v, true
+	case starlark.Int:
+		return Decimal{unscaled: v.BigInt()}, true
+	}
+	return Decimal{}, false
+}
+
+// Type returns "decimal".
+func (d Decimal) Type() string { return "decimal" }
+
+// Freeze does nothing, since decimals are immutable.
+func (d Decimal) Freeze() {}
+
+// Truth reports whether d is not zero.
+func (d Decimal) Truth() starlark.Bool { return d.int().Sign() != 0 }
+
+// Hash returns the same hash for equal decimals, whatever their scale.
+func (d Decimal) Hash() (uint32, error) {
+	h := fnv.New32a()
+	h.Write([]byte(d.normalized().String()))
+	return h.Sum32(), nil
+}
+
+// Binary implements arithmetic with decimals and ints.
+func (d Decimal) Binary(op syntax.Token, y starlark.Value, side starlark.Side) (starlark.Value, error) {
+	if _, ok := y.(starlark.Float); ok {
+		return nil, fmt.Errorf("can't mix decimal and float in %s, use decimal(float) to convert", op)
+	}
+	e, ok := toDecimal(y)
+	if !ok {
+		return nil, nil
+	}
+	x := d
+	if side == starlark.Right {
+		x, e = e, d
+	}
+	switch op {
+	case syntax.PLUS:
+		return x.Add(e), nil
+	case syntax.MINUS:
+		return x.Sub(e), nil
+	case syntax.STAR:
+		return x.Mul(e), nil
+	case syntax.SLASH:
+		return x.Quo(e)
+	}
+	return nil, nil
+}
+
+// Unary implements -d and +d.
+func (d Decimal) Unary(op syntax.Token) (starlark.Value, error) {
+	switch op {
+	case syntax.MINUS:
+		return Decimal{unscaled: new(big.Int).Neg(d.int()), scale: d.scale}, nil
+	case syntax.PLUS:
+		return d, nil
+	}
+	return nil, nil
+}
+
+// CompareSameType compares two decimals.
+func (d Decimal) CompareSameType(op syntax.Token, y starlark.Value, depth int) (bool, error) {
+	return threeway(op, d.Cmp(y.(Decimal))), nil
+}
+
+func threeway(op syntax.Token, cmp int) bool {
+	switch op {
+	case syntax.EQL:
+		return cmp == 0
+	case syntax.NEQ:
+		return cmp != 0
+	case syntax.LE:
+		return cmp <= 0
+	case syntax.LT:
+		return cmp < 0
+	case syntax.GE:
+		return cmp >= 0
+	case syntax.GT:
+		return cmp > 0
+	}
+	panic(op)
+}
+
+// Attr returns the decimal's methods.
+func (d Decimal) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "round":
+		return starlark.NewBuiltin("round", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var places int
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "places?", &places); err != nil {
+				return nil, err
+			}
+			return d.Round(int32(places)), nil
+		}).BindReceiver(d), nil
+	case "toFloat":
+		return starlark.NewBuiltin("toFloat", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+				return nil, err
+			}
+			return starlark.Float(d.Float64()), nil
+		}).BindReceiver(d), nil
+	}
+	return nil, nil
+}
+
+// AttrNames returns the names of the decimal's methods.
+func (d Decimal) AttrNames() []string {
+	return []string{"round", "toFloat"}
+}
+
+// DecimalBuiltin returns a builtin named "decimal" that scripts can use to make
+// decimals from strings, ints, floats and other decimals.  Floats are
+// converted from their shortest representation, so decimal(0.1) is exactly
+// 0.1.
+func DecimalBuiltin() *starlark.Builtin {
+	return starlark.NewBuiltin("decimal", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var v starlark.Value
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &v); err != nil {
+			return nil, err
+		}
+		switch v := v.(type) {
+		case starlark.String:
+			d, err := ParseDecimal(strings.TrimSpace(string(v)))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+			}
+			return d, nil
+		case starlark.Float:
+			d, err := ParseDecimal(strconv.FormatFloat(float64(v), 'f', -1, 64))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+			}
+			return d, nil
+		}
+		if d, ok := toDecimal(v); ok {
+			return d, nil
+		}
+		return nil, fmt.Errorf("%s: can't convert %s to decimal", fn.Name(), v.Type())
+	})
+}
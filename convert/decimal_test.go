@@ -0,0 +1,89 @@
+package convert_test
+
+import (
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+)
+
+type invoice struct {
+	Total convert.Decimal
+}
+
+func (i *invoice) Add(d convert.Decimal) {
+	i.Total = i.Total.Add(d)
+}
+
+func TestDecimal(t *testing.T) {
+	inv := &invoice{Total: convert.NewDecimal(1999, 2)}
+	globals := map[string]interface{}{
+		"decimal": convert.DecimalBuiltin(),
+		"inv":     inv,
+		"assert":  &assert{t: t},
+	}
+	code := []byte(`
+def run():
+    a = decimal("0.1") + decimal("0.2")
+    assert.Eq(a, decimal("0.3"))
+    assert.Eq(str(a), "0.3")
+    assert.Eq(str(decimal(0.1) * 3), "0.3")
+    assert.Eq(str(decimal("1.50") - 2), "-0.50")
+    assert.Eq(str(decimal("10") / 4), "2.5000000000000000")
+    assert.Eq(str(decimal(2) / 3), "0.6666666666666667")
+    assert.Eq(str(-decimal("1.5")), "-1.5")
+    assert.Eq(str(decimal("2.345").round(2)), "2.34")
+    assert.Eq(str(decimal("2.355").round(2)), "2.36")
+    assert.Eq(str(decimal("-2.5").round()), "-2")
+    assert.Eq(decimal("1.10") == decimal("1.1"), True)
+    assert.Eq(decimal("1.10") < decimal("1.2"), True)
+    d = {decimal("1.10"): 1}
+    d[decimal("1.1")] = 2
+    assert.Eq(len(d), 1)
+    assert.Eq(decimal("0.25").toFloat(), 0.25)
+    assert.Eq(bool(decimal("0.00")), False)
+    assert.Eq(str(inv.Total + 1), "20.99")
+    inv.Add(decimal("0.01"))
+run()
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := inv.Total.String(); got != "20.00" {
+		t.Fatalf("expected total 20.00, got %s", got)
+	}
+}
+
+func TestDecimalErrors(t *testing.T) {
+	globals := map[string]interface{}{"decimal": convert.DecimalBuiltin()}
+	tests := []struct {
+		code, err string
+	}{
+		{`decimal("1.5") + 1.5`, "can't mix decimal and float in +, use decimal(float) to convert"},
+		{`decimal("1") / 0`, "decimal division by zero"},
+		{`decimal("1.2.3")`, `decimal: invalid decimal "1.2.3"`},
+		{`decimal([])`, "decimal: can't convert list to decimal"},
+	}
+	for _, test := range tests {
+		_, err := starlight.Eval([]byte(test.code), globals, nil)
+		expectErr(t, err, test.err)
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	for _, s := range []string{"0", "-12.50", "0.001", "123456789012345678901234567890.5"} {
+		d, err := convert.ParseDecimal(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if d.String() != s {
+			t.Errorf("expected %s, got %s", s, d)
+		}
+	}
+	for _, s := range []string{"", ".5", "1.", "1e5", "0x10"} {
+		if _, err := convert.ParseDecimal(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// DecodeError is returned by Decode for the values that couldn't be decoded.
+type DecodeError struct {
+	// Errors are the errors for each value, prefixed with the path to the
+	// value, e.g. `servers[1].port: expected int, got string`.
+	Errors []error
+}
+
+// Error returns the errors joined with semicolons.
+func (e *DecodeError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Decode decodes v into the Go value dst points to, like json.Unmarshal.
+// Dicts and values with attributes (such as those made with struct()) decode
+// into Go structs, lists, tuples and sets into slices and arrays, and dicts
+// into maps, with each field and element converted to its Go type.  Numbers
+// that don't fit their Go type are errors, not truncated.  Bytes decode into
+// strings or byte slices.
+//
+// Struct fields are matched by their `starlark` tag, or else by name, ignoring
+// case and underscores, so a field UserID is set from user_id.  Fields tagged
+// "-" are skipped, as are keys without a field.  Fields tagged with the
+// required option, e.g. `starlark:",required"` or `starlark:"port,required"`,
+// must be set.  Types with UnmarshalStarlark
+// or UnmarshalText methods, or a converter registered with
+// RegisterReverseConverter, decode themselves.
+//
+// Decode sets all the values it can.  If any can't be decoded, it returns a
+// *DecodeError listing them.
+func Decode(v starlark.Value, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("decode expects a non-nil pointer, got %T", dst)
+	}
+	d := &decoder{}
+	d.decode(v, rv.Elem(), "")
+	if len(d.errs) > 0 {
+		return &DecodeError{Errors: d.errs}
+	}
+	return nil
+}
+
+// FromStringDictTyped decodes the globals of a script into the struct dst
+// points to, like Decode, e.g. to read a config written as a script.  Globals
+// without a field, such as helper functions, are ignored.
+func FromStringDictTyped(m starlark.StringDict, dst interface{}) error {
+	dict := starlark.NewDict(len(m))
+	for _, k := range m.Keys() {
+		if err := dict.SetKey(starlark.String(k), m[k]); err != nil {
+			return err
+		}
+	}
+	return Decode(dict, dst)
+}
+
+type decoder struct {
+	errs []error
+}
+
+func (d *decoder) fail(path string, err error) {
+	if path != "" {
+		err = fmt.Errorf("%s: %v", path, err)
+	}
+	d.errs = append(d.errs, err)
+}
+
+func (d *decoder) mismatch(path string, v starlark.Value, t reflect.Type) {
+	d.fail(path, fmt.Errorf("expected %v, got %s", t, v.Type()))
+}
+
+// decode sets out, which must be settable, from v.
+func (d *decoder) decode(v starlark.Value, out reflect.Value, path string) {
+	t := out.Type()
+	if val, ok, err := fromRegistered(v, t); ok {
+		d.set(out, val, err, path)
+		return
+	}
+	if v == starlark.None {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			out.Set(reflect.Zero(t))
+			return
+		}
+	}
+	if val, ok, err := fromUnmarshaler(v, t); ok {
+		d.set(out, val, err, path)
+		return
+	}
+	if val, ok, err := fromText(v, t); ok {
+		d.set(out, val, err, path)
+		return
+	}
+	// wrapped Go values of the right type are used as-is.
+	switch v.(type) {
+	case *GoStruct, *GoCollection, *GoIterableStruct, *GoCallable, *GoMap, *GoSlice, *GoInterface, *GoChan, *GoRecvChan:
+		if val := reflect.ValueOf(FromValue(v)); val.Type().AssignableTo(t) {
+			out.Set(val)
+			return
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		p := reflect.New(t.Elem())
+		d.decode(v, p.Elem(), path)
+		out.Set(p)
+	case reflect.Interface:
+		val, err := FromValueErr(v)
+		if err != nil {
+			d.fail(path, err)
+			return
+		}
+		rv := reflect.ValueOf(val)
+		if !rv.IsValid() {
+			out.Set(reflect.Zero(t))
+			return
+		}
+		if !rv.Type().AssignableTo(t) {
+			d.mismatch(path, v, t)
+			return
+		}
+		out.Set(rv)
+	case reflect.Struct:
+		d.decodeStruct(v, out, path)
+	case reflect.Map:
+		d.decodeMap(v, out, path)
+	case reflect.Slice:
+		if b, ok := v.(starlark.Bytes); ok && t.Elem().Kind() == reflect.Uint8 {
+			out.Set(reflect.ValueOf([]byte(b)).Convert(t))
+			return
+		}
+		d.decodeSeq(v, out, path)
+	case reflect.Array:
+		d.decodeSeq(v, out, path)
+	case reflect.Bool:
+		b, ok := v.(starlark.Bool)
+		if !ok {
+			d.mismatch(path, v, t)
+			return
+		}
+		out.SetBool(bool(b))
+	case reflect.String:
+		switch s := v.(type) {
+		case starlark.String:
+			out.SetString(string(s))
+		case starlark.Bytes:
+			out.SetString(string(s))
+		default:
+			d.mismatch(path, v, t)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := v.(starlark.Int)
+		if !ok {
+			d.mismatch(path, v, t)
+			return
+		}
+		n, ok := i.Int64()
+		if !ok || out.OverflowInt(n) {
+			d.fail(path, fmt.Errorf("%v overflows %v", i, t))
+			return
+		}
+		out.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := v.(starlark.Int)
+		if !ok {
+			d.mismatch(path, v, t)
+			return
+		}
+		n, ok := i.Uint64()
+		if !ok || out.OverflowUint(n) {
+			d.fail(path, fmt.Errorf("%v overflows %v", i, t))
+			return
+		}
+		out.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, ok := starlark.AsFloat(v)
+		if !ok {
+			d.mismatch(path, v, t)
+			return
+		}
+		if out.OverflowFloat(f) {
+			d.fail(path, fmt.Errorf("%v overflows %v", v, t))
+			return
+		}
+		out.SetFloat(f)
+	default:
+		val, ok, err := goValue(v, t)
+		switch {
+		case err != nil:
+			d.fail(path, err)
+		case !ok:
+			d.mismatch(path, v, t)
+		default:
+			out.Set(val)
+		}
+	}
+}
+
+func (d *decoder) set(out, val reflect.Value, err error, path string) {
+	if err != nil {
+		d.fail(path, err)
+		return
+	}
+	out.Set(val)
+}
+
+func (d *decoder) decodeStruct(v starlark.Value, out reflect.Value, path string) {
+	t := out.Type()
+	set := map[int]bool{}
+	switch v := v.(type) {
+	case starlark.IterableMapping:
+		for _, item := range v.Items() {
+			key, ok := item[0].(starlark.String)
+			if !ok {
+				d.fail(path, fmt.Errorf("expected string keys, got %s", item[0].Type()))
+				continue
+			}
+			if f, ok := findField(t, string(key)); ok {
+				set[f.Index[0]] = true
+				d.decode(item[1], out.FieldByIndex(f.Index), joinPath(path, string(key)))
+			}
+		}
+	case starlark.HasAttrs:
+		for _, name := range v.AttrNames() {
+			f, ok := findField(t, name)
+			if !ok {
+				continue
+			}
+			attr, err := v.Attr(name)
+			if err != nil {
+				d.fail(joinPath(path, name), err)
+				continue
+			}
+			if attr == nil {
+				continue
+			}
+			set[f.Index[0]] = true
+			d.decode(attr, out.FieldByIndex(f.Index), joinPath(path, name))
+		}
+	default:
+		d.mismatch(path, v, t)
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); !set[i] && hasTagOption(f, "required") {
+			d.fail(path, fmt.Errorf("missing required field %s", decodeName(f)))
+		}
+	}
+}
+
+// hasTagOption reports whether the field's starlark tag has the option opt,
+// e.g. `starlark:",required"`.
+func hasTagOption(f reflect.StructField, opt string) bool {
+	opts := strings.Split(f.Tag.Get("starlark"), ",")
+	for _, o := range opts[1:] {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeName returns the name scripts use for the field in Decode errors.
+func decodeName(f reflect.StructField) string {
+	if tag := strings.Split(f.Tag.Get("starlark"), ",")[0]; tag != "" {
+		return tag
+	}
+	return SnakeCase(f.Name)
+}
+
+// findField returns the exported field of the struct t named name by its
+// starlark tag, or else by its name, ignoring case and underscores.  Fields
+// tagged "-" are never found.
+func findField(t reflect.Type, name string) (reflect.StructField, bool) {
+	var match *reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if tag, ok := f.Tag.Lookup("starlark"); ok {
+			tag = strings.Split(tag, ",")[0]
+			if tag == "-" {
+				// hidden from scripts.
+				continue
+			}
+			if tag == name {
+				return f, true
+			}
+			if tag != "" {
+				continue
+			}
+		}
+		if match == nil && foldName(f.Name) == foldName(name) {
+			match = &f
+		}
+	}
+	if match == nil {
+		return reflect.StructField{}, false
+	}
+	return *match, true
+}
+
+func foldName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "", -1))
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func (d *decoder) decodeMap(v starlark.Value, out reflect.Value, path string) {
+	t := out.Type()
+	if set, ok := v.(*starlark.Set); ok && isSetMap(t) {
+		d.decodeSet(set, out, path)
+		return
+	}
+	dict, ok := v.(starlark.IterableMapping)
+	if !ok {
+		d.mismatch(path, v, t)
+		return
+	}
+	m := reflect.MakeMap(t)
+	for _, item := range dict.Items() {
+		elemPath := fmt.Sprintf("%s[%s]", path, item[0])
+		key := reflect.New(t.Key()).Elem()
+		n := len(d.errs)
+		d.decode(item[0], key, elemPath)
+		if len(d.errs) > n {
+			continue
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		d.decode(item[1], elem, elemPath)
+		m.SetMapIndex(key, elem)
+	}
+	out.Set(m)
+}
+
+// decodeSet sets out, a map with bool or struct{} values, to the set's
+// elements.
+func (d *decoder) decodeSet(set *starlark.Set, out reflect.Value, path string) {
+	t := out.Type()
+	m := reflect.MakeMapWithSize(t, set.Len())
+	present := reflect.New(t.Elem()).Elem()
+	if present.Kind() == reflect.Bool {
+		present.SetBool(true)
+	}
+	it := set.Iterate()
+	defer it.Done()
+	var elem starlark.Value
+	for it.Next(&elem) {
+		key := reflect.New(t.Key()).Elem()
+		n := len(d.errs)
+		d.decode(elem, key, fmt.Sprintf("%s[%s]", path, elem))
+		if len(d.errs) == n {
+			m.SetMapIndex(key, present)
+		}
+	}
+	out.Set(m)
+}
+
+func (d *decoder) decodeSeq(v starlark.Value, out reflect.Value, path string) {
+	t := out.Type()
+	seq, ok := v.(starlark.Sequence)
+	if !ok {
+		d.mismatch(path, v, t)
+		return
+	}
+	n := seq.Len()
+	if t.Kind() == reflect.Array {
+		if n > t.Len() {
+			d.fail(path, fmt.Errorf("%d elements don't fit in %v", n, t))
+			return
+		}
+	} else {
+		out.Set(reflect.MakeSlice(t, n, n))
+	}
+	it := seq.Iterate()
+	defer it.Done()
+	var elem starlark.Value
+	for i := 0; it.Next(&elem); i++ {
+		d.decode(elem, out.Index(i), fmt.Sprintf("%s[%d]", path, i))
+	}
+}
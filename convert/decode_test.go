@@ -0,0 +1,167 @@
+package convert_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+type server struct {
+	Host    string
+	Port    uint16
+	Timeout time.Duration
+}
+
+type config struct {
+	Name    string
+	UserID  int
+	Ratio   float64
+	Servers []server
+	Limits  map[string]int
+	Owner   *server
+	Aliases [2]string
+	Extra   interface{}
+	Secret  string `starlark:"-"`
+	Mode    string `starlark:"run_mode"`
+}
+
+func eval(t *testing.T, expr string) starlark.Value {
+	t.Helper()
+	globals := starlark.StringDict{"struct": starlark.NewBuiltin("struct", starlarkstruct.Make)}
+	v, err := starlark.Eval(&starlark.Thread{}, "decode.star", expr, globals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestDecode(t *testing.T) {
+	v := eval(t, `{
+	"name": "prod",
+	"user_id": 7,
+	"ratio": 1,
+	"servers": [{"host": "a", "port": 80}, struct(host = "b", port = 81)],
+	"limits": {"cpu": 2},
+	"owner": {"host": "c"},
+	"aliases": ("x",),
+	"extra": [1, "two"],
+	"secret": "nope",
+	"run_mode": "fast",
+	"unknown": True,
+}`)
+	var c config
+	if err := convert.Decode(v, &c); err != nil {
+		t.Fatal(err)
+	}
+	want := config{
+		Name:    "prod",
+		UserID:  7,
+		Ratio:   1,
+		Servers: []server{{Host: "a", Port: 80}, {Host: "b", Port: 81}},
+		Limits:  map[string]int{"cpu": 2},
+		Owner:   &server{Host: "c"},
+		Aliases: [2]string{"x"},
+		Extra:   []interface{}{int64(1), "two"},
+		Mode:    "fast",
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Fatalf("expected\n%#v\ngot\n%#v", want, c)
+	}
+
+	var names []string
+	if err := convert.Decode(eval(t, `["a", "b"]`), &names); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Fatalf("unexpected names %v", names)
+	}
+}
+
+func TestDecodeHiddenField(t *testing.T) {
+	var c config
+	if err := convert.Decode(eval(t, `{"-": "pwned", "Secret": "nope"}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Secret != "" {
+		t.Fatalf("expected the hidden field to be left alone, got %q", c.Secret)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	v := eval(t, `{
+	"name": 1,
+	"servers": [{"host": "a", "port": 70000}, {"port": "80"}],
+	"limits": {"cpu": "two"},
+	"aliases": ["a", "b", "c"],
+}`)
+	var c config
+	err := convert.Decode(v, &c)
+	expectErr(t, err, `name: expected string, got int; `+
+		`servers[0].port: 70000 overflows uint16; `+
+		`servers[1].port: expected uint16, got string; `+
+		`limits["cpu"]: expected int, got string; `+
+		`aliases: 3 elements don't fit in [2]string`)
+	if derr, ok := err.(*convert.DecodeError); !ok || len(derr.Errors) != 5 {
+		t.Fatalf("expected a DecodeError with 5 errors, got %#v", err)
+	}
+	if c.Servers[0].Host != "a" {
+		t.Errorf("expected valid values to be set, got %#v", c.Servers)
+	}
+
+	err = convert.Decode(v, c)
+	expectErr(t, err, "decode expects a non-nil pointer, got convert_test.config")
+}
+
+type appConfig struct {
+	Name    string `starlark:",required"`
+	Port    int    `starlark:"listen_port,required"`
+	Debug   bool
+	Servers []server
+}
+
+func TestFromStringDictTyped(t *testing.T) {
+	code := `
+name = "api"
+listen_port = 8080
+servers = [{"host": "a"}]
+
+def helper():
+    pass
+`
+	globals, err := starlark.ExecFile(&starlark.Thread{}, "config.star", code, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c appConfig
+	if err := convert.FromStringDictTyped(globals, &c); err != nil {
+		t.Fatal(err)
+	}
+	want := appConfig{Name: "api", Port: 8080, Servers: []server{{Host: "a"}}}
+	if !reflect.DeepEqual(c, want) {
+		t.Fatalf("expected %#v, got %#v", want, c)
+	}
+
+	globals, err = starlark.ExecFile(&starlark.Thread{}, "config.star", `debug = True`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = convert.FromStringDictTyped(globals, &c)
+	expectErr(t, err, "missing required field name; missing required field listen_port")
+}
+
+func TestDecodeBytes(t *testing.T) {
+	var msg struct {
+		Text string
+		Body []byte
+	}
+	if err := convert.Decode(eval(t, `{"text": b"hi", "body": b"\x00\x01"}`), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != "hi" || string(msg.Body) != "\x00\x01" {
+		t.Fatalf("unexpected %#v", msg)
+	}
+}
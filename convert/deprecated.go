@@ -0,0 +1,148 @@
+package convert
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// Deprecation describes a script's use of a deprecated Go field, method or
+// function.
+type Deprecation struct {
+	// Pos is the position in the script of the first use during the run.
+	Pos syntax.Position
+	// Name is the name of the deprecated member, e.g. "Person.Age".
+	Name string
+	// Message is the deprecation message, e.g. "use Birthday instead".
+	Message string
+}
+
+// String returns the warning in the usual file:line:col: message format.
+func (d Deprecation) String() string {
+	s := fmt.Sprintf("%s: warning: %s is deprecated", d.Pos, d.Name)
+	if d.Message != "" {
+		s += ": " + d.Message
+	}
+	return s
+}
+
+type memberKey struct {
+	t    reflect.Type
+	name string
+}
+
+var deprecated = struct {
+	sync.RWMutex
+	members map[memberKey]string
+	funcs   map[uintptr]string
+}{
+	members: map[memberKey]string{},
+	funcs:   map[uintptr]string{},
+}
+
+// Deprecate marks the named field or method of the type of v as deprecated,
+// with a message telling script authors what to use instead.  v may be a value
+// of the type or a pointer to one.  Struct fields may also be marked with a
+// `deprecated:"message"` tag.  Script access to deprecated members is only
+// reported for values converted WithThread.
+func Deprecate(v interface{}, name, msg string) {
+	deprecated.Lock()
+	deprecated.members[memberKey{t: baseType(reflect.TypeOf(v)), name: name}] = msg
+	deprecated.Unlock()
+}
+
+// DeprecateFunc marks the Go function fn as deprecated, with a message telling
+// script authors what to use instead.  Calls to fn from scripts are reported
+// whether or not fn was converted WithThread.  Note that Go closures created by
+// the same function literal share code, so marking one marks them all.
+func DeprecateFunc(fn interface{}, msg string) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		panic(fmt.Errorf("DeprecateFunc expects a function, but got %T", fn))
+	}
+	deprecated.Lock()
+	deprecated.funcs[v.Pointer()] = msg
+	deprecated.Unlock()
+}
+
+func baseType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// checkDeprecated reports access to the named member of t if it is deprecated.
+// The position reported is that of the script instruction being executed.
+func (o *options) checkDeprecated(t reflect.Type, name string) {
+	if o == nil || o.thread == nil {
+		return
+	}
+	t = baseType(t)
+	deprecated.RLock()
+	msg, ok := deprecated.members[memberKey{t: t, name: name}]
+	deprecated.RUnlock()
+	if !ok && t.Kind() == reflect.Struct {
+		if f, found := t.FieldByName(name); found {
+			msg, ok = f.Tag.Lookup("deprecated")
+		}
+	}
+	if !ok {
+		return
+	}
+	o.warn(o.thread, 0, t.Name()+"."+name, msg)
+}
+
+// deprecateFn wraps b to report calls to it, if gofn is deprecated.
+func deprecateFn(b *starlark.Builtin, gofn reflect.Value, o *options) *starlark.Builtin {
+	deprecated.RLock()
+	msg, ok := deprecated.funcs[gofn.Pointer()]
+	deprecated.RUnlock()
+	if !ok {
+		return b
+	}
+	name := b.Name()
+	if f := runtime.FuncForPC(gofn.Pointer()); f != nil {
+		name = f.Name()[strings.LastIndex(f.Name(), "/")+1:]
+	}
+	return starlark.NewBuiltin(b.Name(), func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		// frame 0 is this builtin, frame 1 is its caller.
+		o.warn(thread, 1, name, msg)
+		return b.CallInternal(thread, args, kwargs)
+	})
+}
+
+// deprecationsKey is the thread local holding the set of deprecated names
+// already reported during the thread's run.
+const deprecationsKey = "starlight.deprecations"
+
+func (o *options) warn(thread *starlark.Thread, depth int, name, msg string) {
+	seen, _ := thread.Local(deprecationsKey).(map[string]bool)
+	if seen == nil {
+		seen = map[string]bool{}
+		thread.SetLocal(deprecationsKey, seen)
+	}
+	if seen[name] {
+		return
+	}
+	seen[name] = true
+
+	d := Deprecation{Name: name, Message: msg}
+	if thread.CallStackDepth() > depth {
+		d.Pos = thread.CallFrame(depth).Pos
+	}
+	switch {
+	case o != nil && o.onDeprecated != nil:
+		o.onDeprecated(d)
+	case thread.Print != nil:
+		thread.Print(thread, d.String())
+	default:
+		fmt.Fprintln(os.Stderr, d.String())
+	}
+}
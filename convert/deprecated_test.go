@@ -0,0 +1,101 @@
+package convert_test
+
+import (
+	"testing"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+type account struct {
+	Name  string
+	Email string `deprecated:"use Contact"`
+}
+
+func (a *account) Contact() string {
+	return a.Email
+}
+
+func (a *account) Mail() string {
+	return a.Email
+}
+
+func oldGreet(name string) string {
+	return "hi " + name
+}
+
+func init() {
+	convert.Deprecate(account{}, "Mail", "use Contact")
+	convert.DeprecateFunc(oldGreet, "use greet")
+}
+
+func runWithWarnings(t *testing.T, code string, globals map[string]interface{}) []string {
+	var warnings []string
+	thread := &starlark.Thread{
+		Print: func(_ *starlark.Thread, msg string) { warnings = append(warnings, msg) },
+	}
+	dict, err := convert.MakeStringDictWithOptions(globals, convert.WithThread(thread))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := starlark.ExecFile(thread, "test.star", code, dict); err != nil {
+		t.Fatal(err)
+	}
+	return warnings
+}
+
+func TestDeprecatedMembers(t *testing.T) {
+	code := `
+a = acct.Email
+b = acct.Email
+c = acct.Mail()
+d = acct.Contact()
+e = acct.Name
+`
+	warnings := runWithWarnings(t, code, map[string]interface{}{
+		"acct": &account{Name: "bob", Email: "bob@example.com"},
+	})
+	expected := []string{
+		"test.star:2:9: warning: account.Email is deprecated: use Contact",
+		"test.star:4:9: warning: account.Mail is deprecated: use Contact",
+	}
+	assert := &assert{t: t}
+	assert.Eq(expected, warnings)
+}
+
+func TestDeprecatedFunc(t *testing.T) {
+	code := `
+a = greet("bob")
+b = greet("alice")
+`
+	warnings := runWithWarnings(t, code, map[string]interface{}{
+		"greet": oldGreet,
+	})
+	expected := []string{
+		"test.star:2:10: warning: convert_test.oldGreet is deprecated: use greet",
+	}
+	assert := &assert{t: t}
+	assert.Eq(expected, warnings)
+}
+
+func TestDeprecationHandler(t *testing.T) {
+	var got []convert.Deprecation
+	thread := &starlark.Thread{}
+	dict, err := convert.MakeStringDictWithOptions(map[string]interface{}{
+		"acct": &account{Email: "bob@example.com"},
+	}, convert.WithThread(thread), convert.OnDeprecated(func(d convert.Deprecation) {
+		got = append(got, d)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := starlark.ExecFile(thread, "test.star", "a = acct.Email", dict); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 deprecation, got %d", len(got))
+	}
+	if got[0].Name != "account.Email" || got[0].Message != "use Contact" || got[0].Pos.Line != 1 {
+		t.Fatalf("unexpected deprecation %#v", got[0])
+	}
+}
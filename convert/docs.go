@@ -0,0 +1,63 @@
+package convert
+
+import (
+	"go.starlark.net/starlark"
+)
+
+// DocBuiltin is a builtin with documentation for script authors, such as one
+// made by MakeStarFn and passed to Document.  Scripts can read the
+// documentation as fn.__doc__, and the introspect package includes it in the
+// descriptions it writes.
+type DocBuiltin struct {
+	*starlark.Builtin
+	// Doc describes what the function does.
+	Doc string
+	// Params describe the function's parameters, in order.
+	Params []ParamDoc
+}
+
+// ParamDoc describes a parameter of a DocBuiltin.
+type ParamDoc struct {
+	Name string
+	Doc  string
+}
+
+var _ starlark.HasAttrs = (*DocBuiltin)(nil)
+
+// Document returns fn with the given documentation attached, e.g.
+//
+//	Document(MakeNamedStarFn("fetch", fetch, "url"), "fetch downloads url.",
+//		ParamDoc{"url", "the address to download"})
+func Document(fn *starlark.Builtin, doc string, params ...ParamDoc) *DocBuiltin {
+	return &DocBuiltin{Builtin: fn, Doc: doc, Params: params}
+}
+
+// Attr returns the documentation of the builtin as __doc__.  Scripts get the
+// parameter descriptions too, after the description of the function.
+func (b *DocBuiltin) Attr(name string) (starlark.Value, error) {
+	if name != "__doc__" {
+		return nil, nil
+	}
+	return starlark.String(b.DocString()), nil
+}
+
+// AttrNames returns the names of the builtin's attributes.
+func (b *DocBuiltin) AttrNames() []string {
+	return []string{"__doc__"}
+}
+
+// DocString returns the documentation of the builtin as plain text: the
+// description of the function, followed by a line for each parameter.
+func (b *DocBuiltin) DocString() string {
+	s := b.Doc
+	if len(b.Params) > 0 && s != "" {
+		s += "\n\n"
+	}
+	for i, p := range b.Params {
+		if i > 0 {
+			s += "\n"
+		}
+		s += p.Name + ": " + p.Doc
+	}
+	return s
+}
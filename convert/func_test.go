@@ -1,10 +1,18 @@
 package convert_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
 )
 
 func TestVariadic(t *testing.T) {
@@ -36,3 +44,621 @@ do()
 		t.Fatal(err)
 	}
 }
+
+func TestVariadicConversion(t *testing.T) {
+	join := func(prefix string, items ...int) string {
+		return fmt.Sprint(prefix, items)
+	}
+	globals := map[string]interface{}{
+		"join":   join,
+		"ids":    []int{4, 5},
+		"assert": &assert{t: t},
+	}
+	code := []byte(`
+assert.Eq(join("a"), "a[]")
+assert.Eq(join("a", 1, 2), "a[1 2]")
+assert.Eq(join("a", *[1, 2, 3]), "a[1 2 3]")
+assert.Eq(join("a", *ids), "a[4 5]")
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectFails(t, []fail{
+		{`join()`, "expected at least 1 args but got 0"},
+		{`join("a", 1, "b")`, "arg 2: expected int, got string"},
+		{`join("a", items=1)`, `unexpected keyword argument "items"`},
+	}, globals)
+}
+
+type tally struct {
+	n int
+}
+
+func (t tally) Count() int {
+	return t.n
+}
+
+func (t *tally) Add(n int) {
+	t.n += n
+}
+
+func TestBindMethods(t *testing.T) {
+	tl := &tally{}
+	globals := convert.BindMethods(tl)
+	if len(globals) != 2 {
+		t.Fatalf("expected 2 methods, got %v", globals)
+	}
+	globals["assert"] = convert.NewStruct(&assert{t: t})
+	code := `
+Add(2)
+Add(3)
+assert.Eq(Count(), 5)
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "bind.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	if tl.n != 5 {
+		t.Fatalf("expected 5, got %d", tl.n)
+	}
+
+	copied := convert.BindMethods(tally{n: 1})
+	if _, ok := copied["Add"]; !ok {
+		t.Fatalf("expected pointer methods to be bound, got %v", copied)
+	}
+}
+
+func TestFuncCollectionArgs(t *testing.T) {
+	ids := []int{1, 2}
+	var gotIDs []int
+	var gotLimits map[string]uint8
+	globals := map[string]interface{}{
+		"ids":   ids,
+		"same":  func(v []int) bool { return &v[0] == &ids[0] },
+		"use":   func(v []int) { gotIDs = v },
+		"limit": func(m map[string]uint8) { gotLimits = m },
+	}
+	code := []byte(`
+kept = same(ids)
+use([3, 4])
+limit({"cpu": 2})
+`)
+	out, err := starlight.Eval(code, globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["kept"] != true {
+		t.Error("expected a wrapped slice to be passed back unchanged")
+	}
+	if len(gotIDs) != 2 || gotIDs[0] != 3 || gotIDs[1] != 4 {
+		t.Errorf("expected [3 4], got %v", gotIDs)
+	}
+	if gotLimits["cpu"] != 2 {
+		t.Errorf("expected cpu limit 2, got %v", gotLimits)
+	}
+
+	_, err = starlight.Eval([]byte(`limit({"cpu": 300})`), globals, nil)
+	expectErr(t, err, `arg 0: ["cpu"]: 300 overflows uint8`)
+}
+
+func TestFuncArgMismatch(t *testing.T) {
+	globals := map[string]interface{}{
+		"double": func(n int) int { return n * 2 },
+		"first":  func(a [3]int) int { return a[0] },
+		"ids":    []int{1, 2},
+	}
+	expectFails(t, []fail{
+		{`double("2")`, "arg 0: expected int, got string"},
+		{`double({"n": 2})`, "arg 0: expected int, got dict"},
+		{`double(1.5)`, "arg 0: expected int, got float"},
+		{`first(ids)`, "arg 0: expected [3]int, got go.slice<[]int>"},
+	}, globals)
+}
+
+func TestFuncTypedCollectionArgs(t *testing.T) {
+	globals := map[string]interface{}{
+		"sum": func(xs []int) int {
+			total := 0
+			for _, x := range xs {
+				total += x
+			}
+			return total
+		},
+		"join":   func(m map[string]string) string { return fmt.Sprint(m) },
+		"assert": &assert{t: t},
+	}
+	code := []byte(`
+assert.Eq(sum([1, 2, 3]), 6)
+assert.Eq(sum((4, 5)), 9)
+assert.Eq(sum([]), 0)
+assert.Eq(join({"a": "b"}), "map[a:b]")
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectFails(t, []fail{
+		{`sum([1, "x", 2.5])`, "arg 0: [1]: expected int, got string; [2]: expected int, got float"},
+		{`sum([1 << 70])`, "arg 0: [0]: 1180591620717411303424 overflows int"},
+		{`join({"a": 1})`, `arg 0: ["a"]: expected string, got int`},
+	}, globals)
+}
+
+type fetchOptions struct {
+	Timeout    int
+	MaxRetries int
+	UserAgent  string `starlark:"agent"`
+}
+
+func TestFuncKwargs(t *testing.T) {
+	var gotURL string
+	var got fetchOptions
+	fetch := func(url string, opts *fetchOptions) {
+		gotURL, got = url, *opts
+	}
+	globals, err := convert.MakeStringDictWithOptions(map[string]interface{}{
+		"fetch": fetch,
+	}, convert.Naming(convert.SnakeCase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := `fetch("http://example.com", timeout=5, max_retries=2, agent="bot")`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	if want := (fetchOptions{Timeout: 5, MaxRetries: 2, UserAgent: "bot"}); gotURL != "http://example.com" || got != want {
+		t.Fatalf("expected %v, got %q %v", want, gotURL, got)
+	}
+
+	fails := map[string]string{
+		`fetch("x", retries=1)`:         `unexpected keyword argument "retries"`,
+		`fetch("x", timeout="5")`:       "timeout: expected int, got string",
+		`fetch(url="x", timeout=5)`:     `unexpected keyword argument "url"`,
+		`fetch("x", fetchOptions, a=1)`: `unexpected keyword argument "a"`,
+	}
+	globals["fetchOptions"] = starlark.None
+	for code, msg := range fails {
+		_, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals)
+		if err == nil || !strings.HasSuffix(err.Error(), msg) {
+			t.Errorf("%s: expected error %q, got %v", code, msg, err)
+		}
+	}
+}
+
+func TestMakeNamedStarFn(t *testing.T) {
+	resize := func(width, height int, opts *fetchOptions) string {
+		if opts == nil {
+			return fmt.Sprintf("%dx%d", width, height)
+		}
+		return fmt.Sprintf("%dx%d %d", width, height, opts.Timeout)
+	}
+	globals := map[string]interface{}{
+		"resize": convert.MakeNamedStarFn("resize", resize, "width", "height", "opts"),
+		"assert": &assert{t: t},
+	}
+	code := []byte(`
+assert.Eq(resize(1, 2, None), "1x2")
+assert.Eq(resize(height=2, width=1, opts=None), "1x2")
+assert.Eq(resize(1, height=2, Timeout=3), "1x2 3")
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectFails(t, []fail{
+		{`resize(1, width=2, opts=None)`, `resize: got multiple values for keyword argument "width"`},
+		{`resize(1, opts=None)`, "resize: missing argument for height"},
+		{`resize(1, 2, size=3)`, `unexpected keyword argument "size"`},
+	}, globals)
+}
+
+func TestMakeStarFnWithDefaults(t *testing.T) {
+	fetch := func(url string, retries int, tags []string) string {
+		return fmt.Sprintf("%s %d %v", url, retries, tags)
+	}
+	globals := map[string]interface{}{
+		"fetch":  convert.MakeStarFnWithDefaults("fetch", fetch, []string{"url", "retries", "tags"}, 3, []string{"a"}),
+		"add":    convert.MakeStarFnWithDefaults("add", func(a, b int) int { return a + b }, nil, 10),
+		"tag":    convert.MakeStarFnWithDefaults("tag", func(prefix string, n ...int) string { return fmt.Sprint(prefix, n) }, []string{"prefix"}),
+		"assert": &assert{t: t},
+	}
+	code := []byte(`
+assert.Eq(fetch("x"), "x 3 [a]")
+assert.Eq(fetch("x", 5), "x 5 [a]")
+assert.Eq(fetch("x", tags=["b"]), "x 3 [b]")
+assert.Eq(fetch(retries=1, url="y"), "y 1 [a]")
+assert.Eq(add(1), 11)
+assert.Eq(add(1, 2), 3)
+assert.Eq(tag("a", 1, 2), "a[1 2]")
+assert.Eq(tag(prefix="b"), "b[]")
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectFails(t, []fail{
+		{`fetch()`, "fetch: missing argument for url"},
+		{`fetch(retries=1)`, "fetch: missing argument for url"},
+		{`add()`, "add: missing argument for arg0"},
+		{`add(1, 2, 3)`, "add: got 3 arguments, want at most 2"},
+		{`tag(n=1)`, `tag: unexpected keyword argument "n"`},
+		{`add(1, arg1=1)`, `add: unexpected keyword argument "arg1"`},
+	}, globals)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a default of the wrong type")
+		}
+	}()
+	convert.MakeStarFnWithDefaults("add", func(a, b int) int { return a + b }, nil, "ten")
+}
+
+func TestKeywordOnlyParams(t *testing.T) {
+	render := func(text string, bold, italic bool) string {
+		return fmt.Sprintf("%s %v %v", text, bold, italic)
+	}
+	join := func(sep string, parts ...string) string { return strings.Join(parts, sep) }
+	globals := map[string]interface{}{
+		"render": convert.MakeStarFnWithDefaults("render", render, []string{"text", "*", "bold", "italic"}, false),
+		"join":   convert.MakeStarFnWithDefaults("join", join, []string{"*", "sep"}, ","),
+		"assert": &assert{t: t},
+	}
+	code := []byte(`
+assert.Eq(render("a", bold=True), "a true false")
+assert.Eq(render(text="a", italic=True, bold=False), "a false true")
+assert.Eq(join("x", "y"), "x,y")
+assert.Eq(join("x", "y", sep="-"), "x-y")
+assert.Eq(join(), "")
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectFails(t, []fail{
+		{`render("a", True)`, "render: got 2 positional arguments, want at most 1 (bold must be passed by keyword)"},
+		{`render("a", True, False)`, "render: got 3 positional arguments, want at most 1 (bold must be passed by keyword)"},
+		{`render("a", italic=True)`, "render: missing argument for bold"},
+	}, globals)
+}
+
+func TestThreadParam(t *testing.T) {
+	greet := func(thread *starlark.Thread, name string) string {
+		return fmt.Sprintf("%s %s from %s", thread.Local("greeting"), name, thread.Name)
+	}
+	sum := func(thread *starlark.Thread, nums ...int) int {
+		total := 0
+		for _, n := range nums {
+			total += n
+		}
+		return total
+	}
+	globals := starlark.StringDict{
+		"greet":  convert.MakeStarFn("greet", greet),
+		"sum":    convert.MakeStarFn("sum", sum),
+		"assert": convert.NewStruct(&assert{t: t}),
+	}
+	code := `
+assert.Eq(greet("bob"), "hi bob from main")
+assert.Eq(sum(), 0)
+assert.Eq(sum(1, 2), 3)
+`
+	thread := &starlark.Thread{Name: "main"}
+	thread.SetLocal("greeting", "hi")
+	if _, err := starlark.ExecFile(thread, "foo.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	_, err := starlark.ExecFile(thread, "foo.star", `greet()`, globals)
+	if err == nil || !strings.HasSuffix(err.Error(), "expected 1 args but got 0") {
+		t.Fatalf("expected arg count error, got %v", err)
+	}
+}
+
+func TestFuncPanics(t *testing.T) {
+	boom := func(n int) int {
+		var m map[string]int
+		m["x"] = n
+		return n
+	}
+	globals := starlark.StringDict{"boom": convert.MakeStarFn("boom", boom)}
+	_, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", `boom(1)`, globals)
+	var pe *convert.PanicError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a PanicError, got %v", err)
+	}
+	if pe.Func != "boom" || len(pe.Stack) != 0 || !strings.HasSuffix(err.Error(), "boom panicked: assignment to entry in nil map") {
+		t.Fatalf("unexpected error %#v", pe)
+	}
+
+	globals, err = convert.MakeStringDictWithOptions(map[string]interface{}{"boom": boom}, convert.PanicStacks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = starlark.ExecFile(&starlark.Thread{}, "foo.star", `boom(1)`, globals)
+	if !errors.As(err, &pe) || !bytes.Contains(pe.Stack, []byte("TestFuncPanics")) {
+		t.Fatalf("expected a PanicError with a stack, got %v", err)
+	}
+}
+
+func TestStarlarkValueParams(t *testing.T) {
+	var gotDict *starlark.Dict
+	var gotValues []starlark.Value
+	globals := map[string]interface{}{
+		"keep": func(d *starlark.Dict, v starlark.Value) { gotDict, gotValues = d, append(gotValues, v) },
+		"call": func(thread *starlark.Thread, fn starlark.Callable) (starlark.Value, error) {
+			return starlark.Call(thread, fn, starlark.Tuple{starlark.MakeInt(2)}, nil)
+		},
+		"ids": []int{1},
+	}
+	code := []byte(`
+d = {"a": 1}
+keep(d, None)
+keep(d, ids)
+x = call(lambda n: n * 3)
+`)
+	out, err := starlight.Eval(code, globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotDict == nil || gotDict.Len() != 1 {
+		t.Fatalf("expected the script's dict, got %v", gotDict)
+	}
+	if gotValues[0] != starlark.None || gotValues[1].Type() != "go.slice<[]int>" {
+		t.Fatalf("expected the script's values, got %v", gotValues)
+	}
+	if out["x"] != int64(6) {
+		t.Fatalf("expected 6, got %v", out["x"])
+	}
+	expectFails(t, []fail{
+		{`keep([], None)`, "arg 0: expected *starlark.Dict, got list"},
+	}, globals)
+}
+
+type jobConfig struct {
+	Name string
+	Port int
+}
+
+type jobHolder struct {
+	Config jobConfig
+	Body   closeCounter
+}
+
+func TestFuncPointerParams(t *testing.T) {
+	h := &jobHolder{Config: jobConfig{Name: "h"}}
+	globals := map[string]interface{}{
+		"describe": func(c *jobConfig) string { return fmt.Sprintf("%s:%d", c.Name, c.Port) },
+		"rename":   func(c *jobConfig) { c.Name = "renamed" },
+		"byValue":  func(c jobConfig) string { return c.Name },
+		"double":   func(n *int) int { return *n * 2 },
+		"close":    func(c io.Closer) error { return c.Close() },
+		"cfg":      &jobConfig{Name: "p"},
+		"h":        h,
+		"assert":   &assert{t: t},
+	}
+	code := []byte(`
+assert.Eq(describe({"Name": "a", "Port": 1}), "a:1")
+assert.Eq(describe(cfg), "p:0")
+assert.Eq(byValue(cfg), "p")
+assert.Eq(double(3), 6)
+rename(h.Config)
+close(h.Body)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if h.Config.Name != "renamed" || h.Body.Closed != 1 {
+		t.Fatalf("expected the fields to be changed in place, got %+v", h)
+	}
+	expectFails(t, []fail{
+		{`describe({"Name": 1})`, "arg 0: Name: expected string, got int"},
+		{`double("x")`, "arg 0: expected *int, got string"},
+	}, globals)
+}
+
+type userClient struct {
+	calls int
+}
+
+func (c *userClient) GetUser(id int) string {
+	c.calls++
+	return fmt.Sprintf("user%d", id)
+}
+
+func (c *userClient) Calls() int { return c.calls }
+
+func TestMakeStarMethods(t *testing.T) {
+	c := &userClient{}
+	globals := starlark.StringDict{
+		"client": convert.MakeStarMethods("client", c, convert.Naming(convert.SnakeCase)),
+		"plain":  convert.MakeStarMethods("plain", c),
+		"assert": convert.NewStruct(&assert{t: t}),
+	}
+	code := `
+assert.Eq(client.get_user(1), "user1")
+assert.Eq(plain.GetUser(2), "user2")
+assert.Eq(client.calls(), 2)
+assert.Eq(dir(client), ["calls", "get_user"])
+assert.Eq(type(client), "module")
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDocument(t *testing.T) {
+	fetch := convert.Document(
+		convert.MakeStarFnWithDefaults("fetch", func(url string, retries int) string { return url }, []string{"url", "retries"}, 3),
+		"fetch downloads url.",
+		convert.ParamDoc{Name: "url", Doc: "the address to download"},
+		convert.ParamDoc{Name: "retries", Doc: "how many times to retry"},
+	)
+	globals := starlark.StringDict{
+		"fetch":  fetch,
+		"bare":   convert.Document(convert.MakeStarFn("bare", func() {}), "bare does nothing."),
+		"assert": convert.NewStruct(&assert{t: t}),
+	}
+	code := `
+assert.Eq(fetch("a", retries=1), "a")
+assert.Eq(fetch.__doc__, "fetch downloads url.\n\nurl: the address to download\nretries: how many times to retry")
+assert.Eq(bare.__doc__, "bare does nothing.")
+assert.Eq(dir(fetch), ["__doc__"])
+assert.Eq(type(fetch), "builtin_function_or_method")
+assert.Eq(str(fetch), "<built-in function fetch>")
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamResults(t *testing.T) {
+	stream := func(n int) <-chan int {
+		ch := make(chan int)
+		go func() {
+			defer close(ch)
+			for i := 0; i < n; i++ {
+				ch <- i
+			}
+		}()
+		return ch
+	}
+	produced := 0
+	count := func(yield func(int) bool) {
+		for i := 0; ; i++ {
+			produced++
+			if !yield(i) {
+				return
+			}
+		}
+	}
+	forever := make(chan int)
+	globals := map[string]interface{}{
+		"stream":  stream,
+		"count":   func() func(func(int) bool) { return count },
+		"none":    func() <-chan int { return nil },
+		"forever": func() <-chan int { return forever },
+		"assert":  &assert{t: t},
+	}
+	code := []byte(`
+assert.Eq([x for x in stream(3)], [0, 1, 2])
+assert.Eq(type(stream(0)), "go.chan<<-chan int>")
+def first(n):
+    out = []
+    for x in count():
+        if x == n:
+            break
+        out.append(x)
+    return out
+assert.Eq(first(3), [0, 1, 2])
+assert.Eq(none(), None)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if produced != 4 {
+		t.Errorf("expected the iterator to stop after 4 values, it produced %d", produced)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	// the loop fails when the context is done, rather than blocking forever.
+	_, err := starlight.EvalContext(ctx, []byte("[x for x in forever()]"), globals, nil)
+	if err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+}
+
+func TestStreamPanics(t *testing.T) {
+	stream := func() func(func(int) bool) {
+		return func(yield func(int) bool) {
+			if yield(1) {
+				panic("boom")
+			}
+		}
+	}
+	users := func() func(func(userRecord) bool) {
+		return func(yield func(userRecord) bool) {
+			yield(userRecord{UserID: 1})
+		}
+	}
+	globals := map[string]interface{}{
+		"stream": stream,
+		"users":  convert.MakeStarFnWithOptions("users", users, convert.Naming(convert.SnakeCase)),
+		"assert": &assert{t: t},
+	}
+	code := []byte(`
+assert.Eq([u.user_id for u in users()], [1])
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err := starlight.Eval([]byte("x = [v for v in stream()]"), globals, nil)
+	if err == nil || !strings.Contains(err.Error(), "iterator panicked: boom") {
+		t.Fatalf("expected the iterator's panic as an error, got %v", err)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	slow := func() { <-release }
+	hasDeadline := func(thread *starlark.Thread) bool {
+		_, ok := convert.ThreadContext(thread).Deadline()
+		return ok
+	}
+	timeout := convert.CallTimeout(10 * time.Millisecond)
+	globals := map[string]interface{}{
+		"slow":         convert.MakeStarFnWithOptions("slow", slow, timeout),
+		"has_deadline": convert.MakeStarFnWithOptions("has_deadline", hasDeadline, timeout),
+		"no_deadline":  convert.MakeStarFn("no_deadline", hasDeadline),
+		"assert":       &assert{t: t},
+	}
+	code := []byte(`
+assert.Eq(has_deadline(), True)
+assert.Eq(no_deadline(), False)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err := starlight.Eval([]byte("slow()\nassert.Eq(1, 2)"), globals, nil)
+	expectErr(t, err, "slow: timed out after 10ms")
+
+	globals["slow"] = convert.MakeStarFnWithOptions("slow", slow, convert.CallTimeout(time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = starlight.EvalContext(ctx, []byte("slow()"), globals, nil)
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("expected the run's deadline to stop the call, got %v", err)
+	}
+}
+
+func TestCallTimeoutCallbacks(t *testing.T) {
+	// work calls back into the script until its deadline, so it must not run
+	// on its own goroutine once the call has timed out.
+	work := func(thread *starlark.Thread, fn starlark.Callable) error {
+		ctx := convert.ThreadContext(thread)
+		for ctx.Err() == nil {
+			if _, err := starlark.Call(thread, fn, nil, nil); err != nil {
+				return err
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return ctx.Err()
+	}
+	globals := map[string]interface{}{
+		"work": convert.MakeStarFnWithOptions("work", work, convert.CallTimeout(10*time.Millisecond)),
+	}
+	code := []byte(`
+calls = []
+def callback():
+    calls.append(1)
+work(callback)
+`)
+	_, err := starlight.Eval(code, globals, nil)
+	expectErr(t, err, "work: timed out after 10ms")
+}
+
+func BenchmarkStarFnCall(b *testing.B) {
+	fn := convert.MakeStarFn("add", func(name string, a, b int) string { return name })
+	thread := &starlark.Thread{}
+	args := starlark.Tuple{starlark.String("x"), starlark.MakeInt(1), starlark.MakeInt(2)}
+	for n := 0; n < b.N; n++ {
+		if _, err := starlark.Call(thread, fn, args, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -12,14 +12,14 @@ import (
 // if the type is not a bool, string, float kind, int kind, or uint kind .
 func MakeGoInterface(v interface{}) *GoInterface {
 	val := reflect.ValueOf(v)
-	ifc, ok := makeGoInterface(val)
+	ifc, ok := makeGoInterface(val, nil)
 	if !ok {
 		panic(fmt.Errorf("value of type %T is not supported by GoInterface", val.Interface()))
 	}
 	return ifc
 }
 
-func makeGoInterface(val reflect.Value) (*GoInterface, bool) {
+func makeGoInterface(val reflect.Value, o *options) (*GoInterface, bool) {
 	// we accept pointers to anything except structs, which should go through GoStruct.
 	if val.Kind() == reflect.Ptr && val.Elem().Kind() == reflect.Struct {
 		return nil, false
@@ -31,16 +31,19 @@ func makeGoInterface(val reflect.Value) (*GoInterface, bool) {
 		reflect.Float32, reflect.Float64,
 		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return &GoInterface{v: val}, true
+		return &GoInterface{v: val, opts: o}, true
 	}
 	return nil, false
 }
 
 // GoInterface wraps a go value to expose its methods to starlark scripts. Basic
 // types will not behave as their base type (you can't add 2 to an ID, even if
-// it is an int underneath).
+// it is an int underneath).  Values of interface types, such as a struct field of type
+// io.ReadCloser, expose the methods of the interface (Read and Close), so
+// scripts can use them the same way whatever type of value they hold.
 type GoInterface struct {
-	v reflect.Value
+	v    reflect.Value
+	opts *options
 }
 
 // Attr returns a starlark value that wraps the method or field with the given
@@ -61,31 +64,26 @@ func (g *GoInterface) Attr(name string) (starlark.Value, error) {
 
 	method := g.v.MethodByName(name)
 	if method.Kind() != reflect.Invalid {
-		return makeStarFn(name, method), nil
+		g.opts.checkDeprecated(g.v.Type(), name)
+		return makeStarFn(name, method, g.opts.child()), nil
 	}
 	return nil, nil
 }
 
-// AttrNames returns the list of all fields and methods on this struct.
+// AttrNames returns the names of the value's methods, and of the toInt,
+// toString, toFloat, toUint and toBool conversions.
 func (g *GoInterface) AttrNames() []string {
-	count := g.v.NumMethod()
-	if g.v.Kind() == reflect.Ptr {
-		elem := g.v.Elem()
-		count += elem.NumMethod()
+	t := g.v.Type()
+	names := make([]string, 0, t.NumMethod()+len(interfaceConversions))
+	for i := 0; i < t.NumMethod(); i++ {
+		names = append(names, t.Method(i).Name)
 	}
-	names := make([]string, 0, count)
-	for i := 0; i < g.v.NumMethod(); i++ {
-		names = append(names, g.v.Type().Method(i).Name)
-	}
-	if g.v.Kind() == reflect.Ptr {
-		t := g.v.Elem().Type()
-		for i := 0; i < t.NumMethod(); i++ {
-			names = append(names, t.Method(i).Name)
-		}
-	}
-	return names
+	return append(names, interfaceConversions...)
 }
 
+// interfaceConversions are the names of GoInterface's conversion methods.
+var interfaceConversions = []string{"toInt", "toString", "toFloat", "toUint", "toBool"}
+
 // String returns the string representation of the value.
 // Starlark string values are quoted as if by Python's repr.
 func (g *GoInterface) String() string {
@@ -94,15 +92,10 @@ func (g *GoInterface) String() string {
 
 // Type returns a short string describing the value's type.
 func (g *GoInterface) Type() string {
-	return fmt.Sprintf("starlight_interface<%T>", g.v.Interface())
+	return fmt.Sprintf("go.interface<%T>", g.v.Interface())
 }
 
-// Freeze causes the value, and all values transitively
-// reachable from it through collections and closures, to be
-// marked as frozen.  All subsequent mutations to the data
-// structure through this API will fail dynamically, making the
-// data structure immutable and safe for publishing to other
-// Starlark interpreters running concurrently.
+// Freeze does nothing, since scripts can only call the value's methods.
 func (g *GoInterface) Freeze() {}
 
 // Truth returns the truth value of an object.
@@ -129,7 +122,7 @@ func (g *GoInterface) Truth() starlark.Bool {
 // Hash may fail if the value's type is not hashable, or if the value
 // contains a non-hashable value.
 func (g *GoInterface) Hash() (uint32, error) {
-	return 0, errors.New("starlight_interface is not hashable")
+	return 0, errors.New("go.interface is not hashable")
 }
 
 // Below are conversion functions, they only work on the appropriate underlying type.
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/starlight-go/starlight"
+	"go.starlark.net/starlark"
 )
 
 func TestInterfaceStructPtr(t *testing.T) {
@@ -86,6 +87,24 @@ assert.Eq("Foo: 1", f.Foo())
 	}
 }
 
+func TestInterfaceAttrNames(t *testing.T) {
+	globals := map[string]interface{}{
+		"n":      Name("a"),
+		"toPFoo": toPFoo,
+		"assert": &assert{t: t},
+	}
+	code := []byte(`
+assert.Eq(dir(n), ["Double", "toBool", "toFloat", "toInt", "toString", "toUint"])
+assert.Eq(type(n), "go.interface<convert_test.Name>")
+p = toPFoo(1)
+assert.Eq(dir(p), ["Foo", "PFoo", "toBool", "toFloat", "toInt", "toString", "toUint"])
+assert.Eq(type(p), "go.interface<*convert_test.Foo>")
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestInterfacePtrCall(t *testing.T) {
 	globals := map[string]interface{}{
 		"toPFoo": toPFoo,
@@ -204,3 +223,125 @@ do()
 		t.Fatal(err)
 	}
 }
+
+type envelope struct {
+	Payload interface{}
+	Value   starlark.Value
+	Next    starlark.Callable
+}
+
+func TestInterfaceFields(t *testing.T) {
+	e := &envelope{
+		Payload: map[string]interface{}{"items": []interface{}{1, starlark.String("two")}},
+		Value:   starlark.NewList([]starlark.Value{starlark.MakeInt(1)}),
+	}
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"e":      e,
+	}
+	code := []byte(`
+assert.Eq(e.Payload["items"][0], 1)
+assert.Eq(e.Payload["items"][1], "two")
+assert.Eq(e.Value[0], 1)
+e.Payload = 5
+assert.Eq(e.Payload + 1, 6)
+e.Payload = e
+assert.Eq(e.Payload.Value[0], 1)
+e.Value = {"k": [1, 2]}
+assert.Eq(e.Value["k"][1], 2)
+e.Next = lambda x: x * 2
+assert.Eq(e.Next(2), 4)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.Value.(*starlark.Dict); !ok {
+		t.Fatalf("expected the script's dict, got %T", e.Value)
+	}
+	expectFails(t, []fail{
+		{`e.Next = 1`, "Next: expected starlark.Callable, got int"},
+	}, globals)
+}
+
+type closeCounter struct {
+	Closed int
+}
+
+func (c *closeCounter) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (c *closeCounter) Close() error {
+	c.Closed++
+	return nil
+}
+
+func TestInterfaceValues(t *testing.T) {
+	type holder struct {
+		Any   interface{}
+		Body  io.ReadCloser
+		Items []interface{}
+		Named map[string]io.Closer
+	}
+	cc := &closeCounter{}
+	h := &holder{
+		Any:   &closeCounter{Closed: 2},
+		Body:  cc,
+		Items: []interface{}{1, "two"},
+		Named: map[string]io.Closer{"cc": cc},
+	}
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"h":      h,
+	}
+	code := []byte(`
+assert.Eq(h.Any.Closed, 2)
+assert.Eq(h.Items[0] + 1, 2)
+assert.Eq(h.Items[1] + "!", "two!")
+assert.Eq(sorted(dir(h.Body)), ["Close", "Read", "toBool", "toFloat", "toInt", "toString", "toUint"])
+assert.Eq(hasattr(h.Body, "Closed"), False)
+h.Body.Close()
+h.Named["cc"].Close()
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cc.Closed != 2 {
+		t.Fatalf("expected 2 closes, got %d", cc.Closed)
+	}
+}
+
+type cents int
+
+func (c cents) Neg() cents { return -c }
+
+type perms uint8
+
+func (p perms) Not() perms { return ^p }
+
+type vec struct{ X, Y int }
+
+func (v vec) Neg() vec { return vec{-v.X, -v.Y} }
+func (v vec) Pos() vec { return v }
+
+func TestUnaryOperators(t *testing.T) {
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"c":      cents(5),
+		"p":      perms(0x0f),
+		"v":      vec{1, 2},
+	}
+	code := []byte(`
+assert.Eq((-c).toInt(), -5)
+assert.Eq((~p).toUint(), 0xf0)
+assert.Eq((-v).X, -1)
+assert.Eq((+v).Y, 2)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := []fail{
+		{`~v`, "unknown unary op: ~ go.struct<convert_test.vec>"},
+	}
+	expectFails(t, tests, globals)
+}
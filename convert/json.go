@@ -0,0 +1,94 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+
+	"go.starlark.net/starlark"
+)
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// toJSON converts val by marshaling it with its MarshalJSON method and
+// converting the JSON to starlark values, if it has the method and o allows
+// it.
+func toJSON(val reflect.Value, o *options) (starlark.Value, bool, error) {
+	if !o.jsonMarshal() || !val.CanInterface() || !val.Type().Implements(jsonMarshalerType) {
+		return nil, false, nil
+	}
+	data, err := val.Interface().(json.Marshaler).MarshalJSON()
+	if err != nil {
+		return nil, true, fmt.Errorf("can't convert %v to json: %v", val.Type(), err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, true, fmt.Errorf("can't convert %v to json: %v", val.Type(), err)
+	}
+	sv, err := fromJSON(v)
+	if err != nil {
+		return nil, true, fmt.Errorf("can't convert %v from json: %v", val.Type(), err)
+	}
+	if o.isFrozen() {
+		sv.Freeze()
+	}
+	return sv, true, nil
+}
+
+// fromJSON converts decoded JSON to starlark values, keeping integers as ints.
+// Objects become dicts with sorted keys.
+func fromJSON(v interface{}) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return starlark.MakeInt64(i), nil
+		}
+		if i, ok := new(big.Int).SetString(string(v), 10); ok {
+			return starlark.MakeBigInt(i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return starlark.Float(f), nil
+	case []interface{}:
+		vals := make([]starlark.Value, len(v))
+		for i := range v {
+			val, err := fromJSON(v[i])
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = val
+		}
+		return starlark.NewList(vals), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		d := starlark.NewDict(len(v))
+		for _, k := range keys {
+			val, err := fromJSON(v[k])
+			if err != nil {
+				return nil, err
+			}
+			if err := d.SetKey(starlark.String(k), val); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("unexpected json value of type %T", v)
+}
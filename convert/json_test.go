@@ -0,0 +1,45 @@
+package convert_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+type weather struct {
+	city  string
+	temps []float64
+}
+
+func (w weather) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"city":  w.city,
+		"temps": w.temps,
+		"big":   uint64(1) << 63,
+		"alert": nil,
+	})
+}
+
+func TestJSONMarshalers(t *testing.T) {
+	globals, err := convert.MakeStringDictWithOptions(map[string]interface{}{
+		"assert": &assert{t: t},
+		"w":      weather{city: "Oslo", temps: []float64{-3.5, 2}},
+		"raw":    json.RawMessage(`{"ok": true, "ids": [1, 2]}`),
+	}, convert.JSONMarshalers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := `
+assert.Eq(type(w), "dict")
+assert.Eq(w["city"], "Oslo")
+assert.Eq(w["temps"], [-3.5, 2])
+assert.Eq(w["big"], 1 << 63)
+assert.Eq(w["alert"], None)
+assert.Eq(raw, {"ids": [1, 2], "ok": True})
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "json.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,71 @@
+package convert_test
+
+import (
+	"testing"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+func TestMaxDepth(t *testing.T) {
+	n := &node{Name: "a", Next: &node{Name: "b", Next: &node{Name: "c"}}}
+	globals, err := convert.MakeStringDictWithOptions(map[string]interface{}{"n": n}, convert.MaxDepth(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	thread := &starlark.Thread{}
+	if _, err := starlark.ExecFile(thread, "ok.star", `x = n.Next.Name`, globals); err != nil {
+		t.Fatal(err)
+	}
+	_, err = starlark.ExecFile(thread, "deep.star", `x = n.Next.Next.Name`, globals)
+	expectErr(t, err, "can't convert string: exceeds max depth of 2")
+}
+
+func TestMaxElements(t *testing.T) {
+	_, err := convert.ToValueWithOptions([]int{1, 2, 3}, convert.MaxElements(2))
+	expectErr(t, err, "can't convert []int: 3 elements exceeds max of 2")
+
+	// m.items() can't fail, so the map's values are checked up front.
+	_, err = convert.ToValueWithOptions(map[string][]int{"a": {1, 2, 3}, "b": {1}}, convert.MaxElements(2))
+	expectErr(t, err, "can't convert []int: 3 elements exceeds max of 2")
+
+	v := convert.NewStructWithOptions(&limited{Small: []int{1}, Big: []int{1, 2, 3}}, convert.MaxElements(2))
+	globals := starlark.StringDict{"s": v}
+	thread := &starlark.Thread{}
+	if _, err := starlark.ExecFile(thread, "ok.star", `x = s.Small[0]`, globals); err != nil {
+		t.Fatal(err)
+	}
+	_, err = starlark.ExecFile(thread, "big.star", `x = s.Big`, globals)
+	expectErr(t, err, "can't convert []int: 3 elements exceeds max of 2")
+}
+
+type limited struct {
+	Small []int
+	Big   []int
+	Grid  [][][]int
+	Any   []interface{}
+}
+
+func TestMaxDepthIndexing(t *testing.T) {
+	_, err := convert.ToValueWithOptions([][][]int{{{1}}}, convert.MaxDepth(1))
+	expectErr(t, err, "can't convert []int: exceeds max depth of 1")
+
+	v := convert.NewStructWithOptions(&limited{
+		Small: []int{1},
+		Grid:  [][][]int{{{1}}},
+		Any:   []interface{}{1, []interface{}{[]int{2}}},
+	}, convert.MaxDepth(2))
+	globals := starlark.StringDict{"s": v}
+	thread := &starlark.Thread{}
+	if _, err := starlark.ExecFile(thread, "ok.star", `x = s.Small[0]`, globals); err != nil {
+		t.Fatal(err)
+	}
+	for code, want := range map[string]string{
+		`x = s.Grid[0][0]`:       "can't convert []int: exceeds max depth of 2",
+		`x = s.Any[1]`:           "can't convert []int: exceeds max depth of 2",
+		`x = [a for a in s.Any]`: "can't convert []int: exceeds max depth of 2",
+	} {
+		_, err := starlark.ExecFile(thread, "deep.star", code, globals)
+		expectErr(t, err, want)
+	}
+}
@@ -3,10 +3,12 @@ package convert
 import (
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"sort"
 
 	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
 )
 
 // Much of this code is derived in large part from starlark-go's Dict
@@ -15,13 +17,23 @@ import (
 // Which is Copyright 2017 The Bazel Authors and uses a BSD 3-clause license.
 
 // GoMap is a wrapper around a Go map that makes it satisfy starlark's
-// expectations of a starlark dict.
+// expectations of a starlark dict.  It reads and writes through to the Go map,
+// so changes made by scripts are seen by Go code and vice versa, and the map is
+// never copied.
 type GoMap struct {
 	v      reflect.Value
+	opts   *options
 	numIt  int
 	frozen bool
 }
 
+var (
+	_ starlark.IterableMapping = (*GoMap)(nil)
+	_ starlark.HasSetKey       = (*GoMap)(nil)
+	_ starlark.Sequence        = (*GoMap)(nil)
+	_ starlark.HasAttrs        = (*GoMap)(nil)
+)
+
 // NewGoMap wraps the given map m in a new GoMap.  This function will panic if m
 // is not a map.
 func NewGoMap(m interface{}) *GoMap {
@@ -41,7 +53,16 @@ func (g *GoMap) SetKey(k, v starlark.Value) (err error) {
 		return fmt.Errorf("cannot insert into map during iteration")
 	}
 
-	// if you set something funky on the map, it'll panic, so we recover it here.
+	key, err := tryConv(k, g.v.Type().Key())
+	if err != nil {
+		return err
+	}
+	val, err := tryConv(v, g.v.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	// setting a key on a nil map panics, so we recover it here.
 	defer func() {
 		r := recover()
 		if r == nil {
@@ -54,19 +75,22 @@ func (g *GoMap) SetKey(k, v starlark.Value) (err error) {
 		}
 	}()
 
-	key := conv(k, g.v.Type().Key())
-	val := conv(v, g.v.Type().Elem())
 	g.v.SetMapIndex(key, val)
 	return nil
 }
 
 // Get implements starlark.Mapping.
 func (g *GoMap) Get(in starlark.Value) (out starlark.Value, found bool, err error) {
-	v := g.v.MapIndex(conv(in, g.v.Type().Key()))
+	key, err := tryConv(in, g.v.Type().Key())
+	if err != nil {
+		// a key of the wrong type can't be in the map.
+		return starlark.None, false, nil
+	}
+	v := g.v.MapIndex(key)
 	if v.Kind() == reflect.Invalid {
 		return starlark.None, false, nil
 	}
-	val, err := toValue(v)
+	val, err := toValue(v, g.opts.nested(g.frozen))
 	if err != nil {
 		return nil, false, err
 	}
@@ -81,7 +105,7 @@ func (g *GoMap) String() string {
 
 // Type returns a short string describing the value's type.
 func (g *GoMap) Type() string {
-	return fmt.Sprintf("starlight_map<%T>", g.v.Interface())
+	return fmt.Sprintf("go.map<%T>", g.v.Interface())
 }
 
 // Freeze causes the value, and all values transitively
@@ -103,7 +127,7 @@ func (g *GoMap) Truth() starlark.Bool {
 // Hash may fail if the value's type is not hashable, or if the value
 // contains a non-hashable value.
 func (g *GoMap) Hash() (uint32, error) {
-	return 0, errors.New("starlight_map is not hashable")
+	return 0, errors.New("go.map is not hashable")
 }
 
 func (g *GoMap) Clear() error {
@@ -126,7 +150,10 @@ func (g *GoMap) Delete(k starlark.Value) (v starlark.Value, found bool, err erro
 	if g.numIt > 0 {
 		return nil, false, fmt.Errorf("cannot delete from map during iteration")
 	}
-	key := conv(k, g.v.Type().Key())
+	key, err := tryConv(k, g.v.Type().Key())
+	if err != nil {
+		return starlark.None, false, nil
+	}
 	return g.delete(key)
 }
 
@@ -137,7 +164,7 @@ func (g *GoMap) delete(key reflect.Value) (v starlark.Value, found bool, err err
 	}
 	g.v.SetMapIndex(key, reflect.Value{})
 
-	ret, err := toValue(val)
+	ret, err := toValue(val, g.opts.nested(g.frozen))
 	if err != nil {
 		return starlark.None, true, err
 	}
@@ -147,13 +174,13 @@ func (g *GoMap) delete(key reflect.Value) (v starlark.Value, found bool, err err
 func (g *GoMap) Items() []starlark.Tuple {
 	tuples := make([]starlark.Tuple, 0, g.v.Len())
 	var err error
-	for _, k := range g.v.MapKeys() {
+	for _, k := range mapKeys(g.v, g.opts) {
 		tuple := make(starlark.Tuple, 2)
-		tuple[0], err = toValue(k)
+		tuple[0], err = toValue(k, g.opts.nested(g.frozen))
 		if err != nil {
 			panic(err)
 		}
-		tuple[1], err = toValue(g.v.MapIndex(k))
+		tuple[1], err = toValue(g.v.MapIndex(k), g.opts.nested(g.frozen))
 		if err != nil {
 			panic(err)
 		}
@@ -164,8 +191,8 @@ func (g *GoMap) Items() []starlark.Tuple {
 
 func (g *GoMap) Keys() []starlark.Value {
 	keys := make([]starlark.Value, 0, g.v.Len())
-	for _, k := range g.v.MapKeys() {
-		key, err := toValue(k)
+	for _, k := range mapKeys(g.v, g.opts) {
+		key, err := toValue(k, g.opts.nested(g.frozen))
 		if err != nil {
 			panic(err)
 		}
@@ -182,7 +209,7 @@ func (g *GoMap) Iterate() starlark.Iterator {
 	g.numIt++
 	return &mapIterator{
 		g:    g,
-		keys: g.v.MapKeys(),
+		keys: mapKeys(g.v, g.opts),
 	}
 }
 
@@ -239,7 +266,7 @@ type mapIterator struct {
 
 func (it *mapIterator) Next(p *starlark.Value) bool {
 	if it.i < len(it.keys) {
-		v, err := toValue(it.keys[it.i])
+		v, err := toValue(it.keys[it.i], it.g.opts.nested(it.g.frozen))
 		if err != nil {
 			panic(err)
 		}
@@ -320,7 +347,7 @@ func dict_popitem(fnname string, g *GoMap, args starlark.Tuple, _ []starlark.Tup
 	if len(args) > 0 {
 		return nil, fmt.Errorf("%s: wanted 0 args, got %d", fnname, len(args))
 	}
-	keys := g.v.MapKeys()
+	keys := mapKeys(g.v, g.opts)
 	if len(keys) == 0 {
 		return nil, fmt.Errorf("popitem: empty dict")
 	}
@@ -329,7 +356,7 @@ func dict_popitem(fnname string, g *GoMap, args starlark.Tuple, _ []starlark.Tup
 	if err != nil {
 		return nil, err
 	}
-	key, err := toValue(k)
+	key, err := toValue(k, g.opts.nested(g.frozen))
 	if err != nil {
 		return nil, err
 	}
@@ -434,11 +461,234 @@ func updateDict(dict *GoMap, updates starlark.Tuple, kwargs []starlark.Tuple) er
 	return nil
 }
 
-// conv tries to convert v to t if v is not assignable to t.
+// conv tries to convert v to t if v is not assignable to t.  It panics if v
+// can't be converted.
 func conv(v starlark.Value, t reflect.Type) reflect.Value {
-	out := reflect.ValueOf(FromValue(v))
-	if !out.Type().AssignableTo(t) {
+	out, ok, err := goValue(v, t)
+	if err != nil {
+		panic(err)
+	}
+	if !ok {
 		return out.Convert(t)
 	}
 	return out
 }
+
+// tryConv is like conv, but returns an error instead of panicking if v can't be
+// converted to t, e.g. when a script appends a string to a []int.
+func tryConv(v starlark.Value, t reflect.Type) (reflect.Value, error) {
+	out, ok, err := goValue(v, t)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if ok {
+		return out, nil
+	}
+	if out.IsValid() && out.Type().ConvertibleTo(t) {
+		return out.Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("expected %v, got %s", t, v.Type())
+}
+
+// goValue converts v to a Go value of type t.  If that isn't possible, it
+// returns false and the Go value of v.  Wrapped Go values are used as-is, and
+// starlark collections are decoded element by element (see Decode).  It
+// returns an error if a converter registered for t, t's UnmarshalStarlark
+// method, or decoding fails.
+func goValue(v starlark.Value, t reflect.Type) (reflect.Value, bool, error) {
+	if out, ok, err := fromRegistered(v, t); ok {
+		return out, err == nil, err
+	}
+	// starlark types, such as starlark.Value or *starlark.Dict, get the
+	// script's value as it is.
+	if t.Implements(starlarkValueType) && reflect.TypeOf(v).AssignableTo(t) {
+		return reflect.ValueOf(v), true, nil
+	}
+	if v == starlark.None {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface, reflect.Func, reflect.Chan:
+			return reflect.Zero(t), true, nil
+		}
+	}
+	if out, ok, err := fromUnmarshaler(v, t); ok {
+		return out, err == nil, err
+	}
+	if out, ok := toBig(v, t); ok {
+		return out, true, nil
+	}
+	if v == starlark.None {
+		// report the type of None, since it has no Go value.
+		return reflect.ValueOf(v), false, nil
+	}
+	val, err := fromValue(v)
+	if err != nil {
+		return reflect.Value{}, false, err
+	}
+	out := reflect.ValueOf(val)
+	if out.Type().AssignableTo(t) {
+		return out, true, nil
+	}
+	if out.Type().ConvertibleTo(t) && convertsExactly(out, t) {
+		return out.Convert(t), true, nil
+	}
+	// e.g. the text form of a type converted with TextMarshalers.
+	if text, ok, err := fromText(v, t); ok {
+		return text, err == nil, err
+	}
+	// e.g. a list made by the script passed to Go code that expects []int.
+	if decodable(v, t) {
+		out := reflect.New(t).Elem()
+		d := &decoder{}
+		d.decode(v, out, "")
+		if len(d.errs) > 0 {
+			return reflect.Value{}, false, &DecodeError{Errors: d.errs}
+		}
+		return out, true, nil
+	}
+	// e.g. a struct field passed to Go code that expects a pointer to it, or
+	// an interface its pointer methods implement.
+	if addr, ok := addressOf(v); ok && addr.Type().AssignableTo(t) {
+		return addr, true, nil
+	}
+	// e.g. a dict passed to Go code that expects a pointer to a struct.
+	if t.Kind() == reflect.Ptr {
+		elem, ok, err := goValue(v, t.Elem())
+		if err != nil || !ok {
+			return out, false, err
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(elem)
+		return p, true, nil
+	}
+	// e.g. a struct held by pointer passed to Go code that expects a struct.
+	if out.Kind() == reflect.Ptr && !out.IsNil() && out.Type().Elem().AssignableTo(t) {
+		return out.Elem(), true, nil
+	}
+	return out, false, nil
+}
+
+// addressOf returns the address of the Go value wrapped by v, if it's
+// addressable, such as a field of a struct held by pointer.
+func addressOf(v starlark.Value) (reflect.Value, bool) {
+	var val reflect.Value
+	switch v := v.(type) {
+	case *GoStruct:
+		val = v.v
+	case *GoCollection:
+		val = v.v
+	case *GoIterableStruct:
+		val = v.v
+	case *GoCallable:
+		val = v.v
+	case *GoSlice:
+		val = v.v
+	}
+	if !val.IsValid() || !val.CanAddr() {
+		return reflect.Value{}, false
+	}
+	return val.Addr(), true
+}
+
+// convertsExactly reports whether converting v to t keeps its value, so that
+// numbers aren't truncated or wrapped, and aren't turned into strings of the
+// rune with that code point, and slices are only converted to arrays of their
+// length.
+func convertsExactly(v reflect.Value, t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String:
+		return v.Kind() == reflect.String || v.Kind() == reflect.Slice
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return !reflect.Zero(t).OverflowInt(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return v.Uint() <= math.MaxInt64 && !reflect.Zero(t).OverflowInt(int64(v.Uint()))
+		case reflect.Float32, reflect.Float64:
+			return false
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return v.Int() >= 0 && !reflect.Zero(t).OverflowUint(uint64(v.Int()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return !reflect.Zero(t).OverflowUint(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			return false
+		}
+	case reflect.Array:
+		// converting a slice to an array panics if it's too short.
+		if v.Kind() == reflect.Slice {
+			return v.Len() == t.Len()
+		}
+	case reflect.Ptr:
+		if v.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Array {
+			return v.Len() == t.Elem().Len()
+		}
+	}
+	return true
+}
+
+// decodable reports whether v is a starlark collection or struct that can be
+// decoded into a t element by element.
+func decodable(v starlark.Value, t reflect.Type) bool {
+	switch v.(type) {
+	case *starlark.List, starlark.Tuple:
+		return t.Kind() == reflect.Slice || t.Kind() == reflect.Array
+	case *starlark.Set:
+		return t.Kind() == reflect.Slice || t.Kind() == reflect.Array || isSetMap(t)
+	case *starlark.Dict:
+		return t.Kind() == reflect.Map || t.Kind() == reflect.Struct
+	case *starlarkstruct.Struct:
+		return t.Kind() == reflect.Struct
+	}
+	return false
+}
+
+// isSetMap reports whether t is a map used as a set, with bool or struct{}
+// values.
+func isSetMap(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && (t.Elem().Kind() == reflect.Bool || t.Elem() == reflect.TypeOf(struct{}{}))
+}
+
+// mapKeys returns the keys of the map m, sorted if the options say so.
+func mapKeys(m reflect.Value, o *options) []reflect.Value {
+	keys := m.MapKeys()
+	if o.sortedKeys() {
+		sort.SliceStable(keys, func(i, j int) bool {
+			return lessKey(keys[i], keys[j])
+		})
+	}
+	return keys
+}
+
+// lessKey orders map keys by value if they're strings, numbers or bools of the
+// same kind, and otherwise by type and printed form.
+func lessKey(a, b reflect.Value) bool {
+	if a.Kind() == reflect.Interface {
+		a = a.Elem()
+	}
+	if b.Kind() == reflect.Interface {
+		b = b.Elem()
+	}
+	if !a.IsValid() || !b.IsValid() {
+		return !a.IsValid() && b.IsValid()
+	}
+	if a.Kind() == b.Kind() {
+		switch a.Kind() {
+		case reflect.String:
+			return a.String() < b.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.Bool:
+			return !a.Bool() && b.Bool()
+		}
+	}
+	if at, bt := a.Type().String(), b.Type().String(); at != bt {
+		return at < bt
+	}
+	return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+}
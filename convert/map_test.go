@@ -156,7 +156,7 @@ func TestMapIndex(t *testing.T) {
 a = x9["a"]
 `)
 	_, err := starlight.Eval(code, globals, nil)
-	expectErr(t, err, `key "a" not in starlight_map<map[string]int>`)
+	expectErr(t, err, `key "a" not in go.map<map[string]int>`)
 
 	code = []byte(`
 x9["a"] = 1
@@ -181,7 +181,7 @@ setIndex(x9, [], 2)
 `)
 
 	_, err = starlight.Eval(code, globals, nil)
-	expectErr(t, err, `reflect.Value.Convert: value of type []interface {} cannot be converted to type string`)
+	expectErr(t, err, `expected string, got list`)
 
 	v, err := convert.ToValue(x9)
 	if err != nil {
@@ -264,7 +264,7 @@ record("a" not in x11)
 b = x11["a"]
 `)
 	_, err = starlight.Eval(code, globals, nil)
-	expectErr(t, err, `key "a" not in starlight_map<map[string]int>`)
+	expectErr(t, err, `key "a" not in go.map<map[string]int>`)
 
 	v, err := convert.ToValue(x11)
 	if err != nil {
@@ -529,3 +529,54 @@ m[2] = "bye"
 		t.Fatalf("expected %#v, got %#v", expected, m)
 	}
 }
+
+func TestGoMapWriteThrough(t *testing.T) {
+	m := map[string]int{"a": 1}
+	copied, err := convert.MakeDict(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals := map[string]interface{}{
+		"live":   convert.NewGoMap(m),
+		"copied": copied,
+	}
+	code := []byte(`
+live["b"] = 2
+copied["c"] = 3
+live.pop("a")
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 1 || m["b"] != 2 {
+		t.Fatalf("expected map[b:2], got %v", m)
+	}
+}
+
+func TestMapWrongKeyType(t *testing.T) {
+	m := map[int]int{1: 2}
+	globals := map[string]interface{}{
+		"m": convert.NewGoMap(m),
+	}
+	code := []byte(`
+def run():
+	if "x" in m:
+		fail("string key should not be in map[int]int")
+	if m.get("x", 3) != 3:
+		fail("get with a string key should return the default")
+	if m.pop("x", 4) != 4:
+		fail("pop with a string key should return the default")
+run()
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectFails(t, []fail{
+		{`m["x"]`, `key "x" not in go.map<map[int]int>`},
+		{`m["x"] = 1`, "expected int, got string"},
+		{`m[1] = "x"`, "expected int, got string"},
+	}, globals)
+	if len(m) != 1 || m[1] != 2 {
+		t.Fatalf("expected map[1:2], got %v", m)
+	}
+}
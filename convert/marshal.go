@@ -0,0 +1,78 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+
+	"go.starlark.net/starlark"
+)
+
+// Marshaler is implemented by Go types that convert themselves to starlark
+// values.  ToValue calls StarlarkValue instead of converting the value by
+// reflection, so a type can control what scripts see without registering a
+// converter.
+type Marshaler interface {
+	StarlarkValue() (starlark.Value, error)
+}
+
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+// toMarshaled converts val with its StarlarkValue method, if it has one.
+func toMarshaled(val reflect.Value) (starlark.Value, bool, error) {
+	if !val.CanInterface() {
+		return nil, false, nil
+	}
+	if !val.Type().Implements(marshalerType) {
+		if !val.CanAddr() || !reflect.PtrTo(val.Type()).Implements(marshalerType) {
+			return nil, false, nil
+		}
+		val = val.Addr()
+	}
+	v, err := val.Interface().(Marshaler).StarlarkValue()
+	if err != nil {
+		return nil, true, err
+	}
+	if v == nil {
+		return nil, true, fmt.Errorf("StarlarkValue of %v returned nil", val.Type())
+	}
+	return v, true, nil
+}
+
+// Unmarshaler is implemented by Go types that set themselves from starlark
+// values, usually with a pointer receiver.  When a script passes a value to Go
+// code that expects such a type, e.g. as a function argument or struct field,
+// UnmarshalStarlark is called on a new value of the type instead of converting
+// by reflection, so the type can check its own invariants.  None is passed to
+// UnmarshalStarlark, except for pointer types, which become nil.
+type Unmarshaler interface {
+	UnmarshalStarlark(starlark.Value) error
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+// fromUnmarshaler makes a new value of type t set from v with its
+// UnmarshalStarlark method, if it has one.
+func fromUnmarshaler(v starlark.Value, t reflect.Type) (reflect.Value, bool, error) {
+	var p reflect.Value
+	switch {
+	case t.Kind() == reflect.Ptr && t.Implements(unmarshalerType):
+		p = reflect.New(t.Elem())
+	case reflect.PtrTo(t).Implements(unmarshalerType):
+		p = reflect.New(t)
+	default:
+		return reflect.Value{}, false, nil
+	}
+	// values that are already a t, e.g. wrapped Go values, are used as-is.
+	if val, err := fromValue(v); err == nil {
+		if out := reflect.ValueOf(val); out.IsValid() && out.Type().AssignableTo(t) {
+			return out, true, nil
+		}
+	}
+	if err := p.Interface().(Unmarshaler).UnmarshalStarlark(v); err != nil {
+		return reflect.Value{}, true, err
+	}
+	if t.Kind() == reflect.Ptr {
+		return p, true, nil
+	}
+	return p.Elem(), true, nil
+}
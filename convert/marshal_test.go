@@ -0,0 +1,112 @@
+package convert_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"go.starlark.net/starlark"
+)
+
+type secret string
+
+func (s secret) StarlarkValue() (starlark.Value, error) {
+	if s == "" {
+		return nil, errors.New("empty secret")
+	}
+	return starlark.String("***"), nil
+}
+
+type counter struct {
+	n int
+}
+
+func (c *counter) StarlarkValue() (starlark.Value, error) {
+	return starlark.MakeInt(c.n), nil
+}
+
+type login struct {
+	User     string
+	Password secret
+	Attempts counter
+}
+
+func TestMarshaler(t *testing.T) {
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"l":      &login{User: "bob", Password: "hunter2", Attempts: counter{n: 3}},
+		"pw":     secret("hunter2"),
+	}
+	code := []byte(`
+assert.Eq(l.User, "bob")
+assert.Eq(l.Password, "***")
+assert.Eq(l.Attempts, 3)
+assert.Eq(pw, "***")
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	globals = map[string]interface{}{"l": &login{}}
+	_, err := starlight.Eval([]byte(`x = l.Password`), globals, nil)
+	expectErr(t, err, "empty secret")
+}
+
+type email struct {
+	user, domain string
+}
+
+func (e *email) UnmarshalStarlark(v starlark.Value) error {
+	s, ok := starlark.AsString(v)
+	if !ok {
+		return fmt.Errorf("email must be a string, not %s", v.Type())
+	}
+	i := strings.Index(s, "@")
+	if i < 1 || i == len(s)-1 {
+		return fmt.Errorf("invalid email %q", s)
+	}
+	e.user, e.domain = s[:i], s[i+1:]
+	return nil
+}
+
+type recipient struct {
+	Email email
+	Alt   *email
+}
+
+func TestUnmarshaler(t *testing.T) {
+	c := &recipient{}
+	var sent []email
+	globals := map[string]interface{}{
+		"c":    c,
+		"send": func(to email, cc *email) { sent = append(sent, to, *cc) },
+		"same": func(e email) email { return e },
+	}
+	code := []byte(`
+c.Email = "bob@example.com"
+c.Alt = "bob@work.example.com"
+send("a@b.c", "d@e.f")
+send(same(c.Email), c.Alt)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.Email != (email{"bob", "example.com"}) {
+		t.Errorf("unexpected email %v", c.Email)
+	}
+	if c.Alt == nil || *c.Alt != (email{"bob", "work.example.com"}) {
+		t.Errorf("unexpected alt email %v", c.Alt)
+	}
+	want := []email{{"a", "b.c"}, {"d", "e.f"}, {"bob", "example.com"}, {"bob", "work.example.com"}}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("expected %v, got %v", want, sent)
+	}
+
+	_, err := starlight.Eval([]byte(`c.Email = "bob"`), globals, nil)
+	expectErr(t, err, `Email: invalid email "bob"`)
+	_, err = starlight.Eval([]byte(`send(1, None)`), globals, nil)
+	expectErr(t, err, "arg 0: email must be a string, not int")
+}
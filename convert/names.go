@@ -0,0 +1,170 @@
+package convert
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// SnakeCase converts a Go name to snake case, e.g. "UserID" to "user_id" and
+// "HTTPServer" to "http_server", for use with Naming.
+func SnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// start a new word at a lower to upper change, or at the last upper
+			// of an acronym followed by a lower.
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// LowerCamelCase converts a Go name to lower camel case, e.g. "UserID" to
+// "userID" and "HTTPServer" to "httpServer", for use with Naming.
+func LowerCamelCase(name string) string {
+	runes := []rune(name)
+	for i, r := range runes {
+		// lower the leading acronym, except the start of the next word.
+		if !unicode.IsUpper(r) || (i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			break
+		}
+		runes[i] = unicode.ToLower(r)
+	}
+	return string(runes)
+}
+
+// StructField is a field of a struct as scripts see it.
+type StructField struct {
+	// Name is the name scripts use for the field.
+	Name string
+	// ReadOnly is true if the options keep scripts from setting the field, as
+	// ReadOnly does.  Fields of structs held by value can't be set either.
+	ReadOnly bool
+	reflect.StructField
+}
+
+// ScriptFields returns the fields of the struct t (which may be a pointer to a
+// struct) that scripts can use when it's converted with the given options,
+// with the names scripts use for them, as listed by GoStruct.AttrNames.  Fields
+// promoted from embedded structs are included, and fields hidden by their tags
+// are left out.  It's for tools that describe converted values to script
+// authors.
+func ScriptFields(t reflect.Type, opts ...Option) []StructField {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	o := makeOptions(opts)
+	var fields []StructField
+	for _, f := range exportedFields(t) {
+		if name, ok := o.fieldName(f); ok {
+			fields = append(fields, StructField{Name: name, ReadOnly: o.isFrozen(), StructField: f})
+		}
+	}
+	return fields
+}
+
+// ScriptName returns the name scripts use for the Go method name when it's
+// converted with the given options.
+func ScriptName(goName string, opts ...Option) string {
+	return makeOptions(opts).methodName(goName)
+}
+
+// fieldName returns the name scripts use for the struct field f, or false if
+// the field is hidden from scripts.
+func (o *options) fieldName(f reflect.StructField) (string, bool) {
+	if name, ok := tagName(f, "starlark"); ok {
+		return name, name != "-"
+	}
+	if o != nil && o.tag != "" {
+		if name, ok := tagName(f, o.tag); ok {
+			return name, name != "-"
+		}
+	}
+	return o.methodName(f.Name), true
+}
+
+// tagName returns the name given to the field f by its tag with the given key,
+// if the tag has a name.
+func tagName(f reflect.StructField, key string) (string, bool) {
+	name := strings.Split(f.Tag.Get(key), ",")[0]
+	return name, name != ""
+}
+
+// hasNameTags reports whether any field of the struct t (which may be a
+// pointer to a struct) is named by a starlark tag.
+func hasNameTags(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for _, f := range exportedFields(t) {
+		if _, ok := tagName(f, "starlark"); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// omitEmpty reports whether the field f is left out of dicts when it's the
+// zero value, because of the OmitEmpty option or the omitempty option of its
+// tag named by TagName.
+func (o *options) omitEmpty(f reflect.StructField) bool {
+	if o == nil {
+		return false
+	}
+	if o.omitZero {
+		return true
+	}
+	if o.tag == "" {
+		return false
+	}
+	opts := strings.Split(f.Tag.Get(o.tag), ",")
+	for _, opt := range opts[1:] {
+		if opt == "omitempty" {
+			return true
+		}
+	}
+	return false
+}
+
+// methodName returns the name scripts use for the Go method or field name.
+func (o *options) methodName(name string) string {
+	if o == nil || o.naming == nil {
+		return name
+	}
+	return o.naming(name)
+}
+
+// fieldByName returns the exported field of the struct t that scripts call
+// name.
+func (o *options) fieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for _, f := range exportedFields(t) {
+		if n, ok := o.fieldName(f); ok && n == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// goName returns the Go name of the field or method of the struct t (which
+// may be a pointer to a struct) that scripts call name.
+func (o *options) goName(t reflect.Type, name string) (string, bool) {
+	for i := 0; i < t.NumMethod(); i++ {
+		if m := t.Method(i); o.methodName(m.Name) == name {
+			return m.Name, true
+		}
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if f, ok := o.fieldByName(t, name); ok {
+		return f.Name, true
+	}
+	return "", false
+}
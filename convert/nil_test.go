@@ -0,0 +1,125 @@
+package convert_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+type node struct {
+	Name  string
+	Next  *node
+	Extra fmt.Stringer
+}
+
+func TestNilToNone(t *testing.T) {
+	var nilNode *node
+	globals := map[string]interface{}{
+		"assert":  &assert{t: t},
+		"n":       &node{Name: "a"},
+		"nilNode": nilNode,
+		"nothing": nil,
+		"find":    func(string) *node { return nil },
+	}
+	code := []byte(`
+assert.Eq(n.Next, None)
+assert.Eq(n.Extra, None)
+assert.Eq(nilNode, None)
+assert.Eq(nothing, None)
+assert.Eq(find("x"), None)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStrictNil(t *testing.T) {
+	var n *node
+	_, err := convert.ToValueWithOptions(n, convert.StrictNil())
+	expectErr(t, err, "can't convert nil *convert_test.node")
+	_, err = convert.ToValueWithOptions(nil, convert.StrictNil())
+	expectErr(t, err, "can't convert nil value")
+	v, err := convert.ToValue(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != starlark.None {
+		t.Fatalf("expected None, got %v", v)
+	}
+}
+
+func TestNoneToNil(t *testing.T) {
+	n := &node{Name: "a", Next: &node{Name: "b"}, Extra: time.Second}
+	var gotMap map[string]int
+	var gotSlice []int
+	called := false
+	globals := map[string]interface{}{
+		"n": n,
+		"take": func(m map[string]int, s []int, p *node) {
+			called = true
+			gotMap, gotSlice = m, s
+			if p != nil {
+				t.Errorf("expected nil pointer, got %v", p)
+			}
+		},
+	}
+	code := []byte(`
+n.Next = None
+n.Extra = None
+take(None, None, None)
+out = None
+`)
+	out, err := starlight.Eval(code, globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Next != nil || n.Extra != nil {
+		t.Errorf("expected fields to be set to nil, got %v and %v", n.Next, n.Extra)
+	}
+	if !called || gotMap != nil || gotSlice != nil {
+		t.Errorf("expected take to be called with nils, got %v and %v", gotMap, gotSlice)
+	}
+	if v, ok := out["out"]; !ok || v != nil {
+		t.Errorf("expected out to be nil, got %#v", v)
+	}
+	if v := convert.FromValue(starlark.None); v != nil {
+		t.Errorf("expected FromValue(None) to be nil, got %#v", v)
+	}
+}
+
+func TestNoneToNonNillable(t *testing.T) {
+	globals := map[string]interface{}{"f": func(int) {}}
+	_, err := starlight.Eval([]byte(`f(None)`), globals, nil)
+	expectErr(t, err, "arg 0: expected int, got NoneType")
+}
+
+func TestNilEmbedded(t *testing.T) {
+	globals := map[string]interface{}{
+		"d":      &document{Title: "doc"},
+		"n":      &node{Name: "a"},
+		"assert": &assert{t: t},
+	}
+	code := []byte(`
+assert.Eq(d.Updated, None)
+assert.Eq(d.Title, "doc")
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectFails(t, []fail{
+		{`n.Next.Name`, "NoneType has no .Name field or method"},
+	}, globals)
+
+	strict, err := convert.MakeStringDictWithOptions(map[string]interface{}{"d": &document{}}, convert.StrictNil())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = starlark.ExecFile(&starlark.Thread{}, "foo.star", "d.Updated", strict)
+	if err == nil || err.Error() != "can't get Updated: embedded audit is nil" {
+		t.Fatalf("expected nil embedded error, got %v", err)
+	}
+}
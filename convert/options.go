@@ -0,0 +1,769 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// Option configures how Go values are converted to starlark values.  Options
+// are carried by the wrapped value, so they also apply to fields, elements and
+// function results converted later, when a script uses them.
+type Option func(*options)
+
+type options struct {
+	thread       *starlark.Thread
+	onDeprecated func(Deprecation)
+	// frozen makes every wrapper created from the converted value frozen.
+	frozen    bool
+	strings   bool
+	strictNil bool
+	text      bool
+	json      bool
+	stringer  bool
+	chans     bool
+	sorted    bool
+	dicts     bool
+	structs   bool
+	ident     bool
+	getter    bool
+	omitZero  bool
+	stacks    bool
+	// timeout limits how long each call of a Go function may take.
+	timeout time.Duration
+	// resultStyle and resultNames set how functions return multiple values.
+	resultStyle ResultStyle
+	resultNames []string
+	// validators check the fields scripts set, by struct type.
+	validators map[reflect.Type][]fieldValidator
+	// callMethod names the method that makes structs callable.
+	callMethod string
+	// maxDepth and maxElems limit the conversion of nested data, and depth is
+	// how deeply nested the values converted with these options are.
+	maxDepth int
+	maxElems int
+	depth    int
+	// parents are the pointers to the structs being converted to dicts that
+	// a nested struct is converted for.
+	parents *structPath
+	// checked is set for the elements of maps, slices and arrays whose
+	// contents were checked against the limits when they were wrapped.
+	checked bool
+	// naming and tag set the names scripts use for struct fields and methods.
+	naming func(string) string
+	tag    string
+	// converters take precedence over those registered with
+	// RegisterConverter.
+	converters map[reflect.Type]func(interface{}) (starlark.Value, error)
+}
+
+func (o *options) isFrozen() bool {
+	return o != nil && o.frozen
+}
+
+func (o *options) sortedKeys() bool {
+	return o != nil && o.sorted
+}
+
+func (o *options) structDicts() bool {
+	return o != nil && o.dicts
+}
+
+func (o *options) results() ResultStyle {
+	if o == nil {
+		return TupleResults
+	}
+	return o.resultStyle
+}
+
+// resultName returns the dict key of the i'th result for DictResults.
+func (o *options) resultName(i int) string {
+	if o != nil && i < len(o.resultNames) {
+		return o.resultNames[i]
+	}
+	return fmt.Sprintf("result%d", i)
+}
+
+func (o *options) starlarkStructs() bool {
+	return o != nil && o.structs
+}
+
+func (o *options) identity() bool {
+	return o != nil && o.ident
+}
+
+func (o *options) callName() string {
+	if o == nil {
+		return ""
+	}
+	return o.callMethod
+}
+
+// fieldValidator checks the values scripts set a struct's fields to, or only
+// the named field's if field is set.
+type fieldValidator struct {
+	field string
+	fn    func(field string, old, new interface{}) error
+}
+
+// validate runs the validators for the field of the struct t, returning the
+// first error.
+func (o *options) validate(t reflect.Type, field string, old, new interface{}) error {
+	if o == nil {
+		return nil
+	}
+	for _, v := range o.validators[t] {
+		if v.field != "" && v.field != field {
+			continue
+		}
+		if err := v.fn(field, old, new); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *options) getters() bool {
+	return o != nil && o.getter
+}
+
+func (o *options) bytesAsString() bool {
+	return o != nil && o.strings
+}
+
+func (o *options) isStrictNil() bool {
+	return o != nil && o.strictNil
+}
+
+func (o *options) textMarshal() bool {
+	return o != nil && o.text
+}
+
+func (o *options) jsonMarshal() bool {
+	return o != nil && o.json
+}
+
+func (o *options) stringers() bool {
+	return o != nil && o.stringer
+}
+
+// renames reports whether o changes the names of struct fields or methods.
+func (o *options) renames() bool {
+	return o != nil && (o.naming != nil || o.tag != "")
+}
+
+// converter returns the converter for t set with the Converter option.
+func (o *options) converter(t reflect.Type) (func(interface{}) (starlark.Value, error), bool) {
+	if o == nil {
+		return nil, false
+	}
+	fn, ok := o.converters[t]
+	return fn, ok && fn != nil
+}
+
+func (o *options) channels() bool {
+	return o != nil && o.chans
+}
+
+func (o *options) panicStacks() bool {
+	return o != nil && o.stacks
+}
+
+func (o *options) callTimeout() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.timeout
+}
+
+// child returns the options for values nested in a value converted with o.
+func (o *options) child() *options {
+	if o == nil || o.maxDepth == 0 {
+		return o
+	}
+	c := *o
+	c.depth++
+	return &c
+}
+
+// nested returns the options for values reached through a wrapper, which are
+// frozen if the wrapper is, so freezing a value freezes everything scripts can
+// reach from it.
+func (o *options) nested(frozen bool) *options {
+	return o.child().withFrozen(frozen)
+}
+
+// withFrozen returns o, or a copy of o that freezes new wrappers if frozen is
+// set.
+func (o *options) withFrozen(frozen bool) *options {
+	if !frozen || o.isFrozen() {
+		return o
+	}
+	if o == nil {
+		return &options{frozen: true}
+	}
+	c := *o
+	c.frozen = true
+	return &c
+}
+
+// withThread returns a copy of o with thread set, so that the channels
+// functions return stop iterating when the thread's run is cancelled.
+func (o *options) withThread(thread *starlark.Thread) *options {
+	c := options{}
+	if o != nil {
+		c = *o
+	}
+	c.thread = thread
+	return &c
+}
+
+// checkLimits returns an error if converting val exceeds the max depth or max
+// elements.
+func (o *options) checkLimits(val reflect.Value) error {
+	if o == nil {
+		return nil
+	}
+	if o.maxDepth > 0 && o.depth > o.maxDepth {
+		return fmt.Errorf("can't convert %s: exceeds max depth of %d", val.Type(), o.maxDepth)
+	}
+	if o.maxElems > 0 {
+		v := val
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Map, reflect.Slice, reflect.Array:
+			if v.Len() > o.maxElems {
+				return fmt.Errorf("can't convert %s: %d elements exceeds max of %d", val.Type(), v.Len(), o.maxElems)
+			}
+		}
+	}
+	return nil
+}
+
+func (o *options) threadOrNil() *starlark.Thread {
+	if o == nil {
+		return nil
+	}
+	return o.thread
+}
+
+// failIteration fails the script running on the thread of o with err, since
+// iterators can't return errors.  Without a thread, it panics with err.
+func (o *options) failIteration(err error) {
+	thread := o.threadOrNil()
+	if thread == nil {
+		panic(err)
+	}
+	thread.Cancel(err.Error())
+}
+
+// checkContents checks the limits for the values scripts can reach from val by
+// indexing and iterating, since those can't return errors, unlike reading
+// fields and looking up map keys, so that e.g. a slice whose elements are too
+// deeply nested can't be wrapped at all.  It returns the options to wrap val
+// with, which don't check the contents of val's elements again.
+func (o *options) checkContents(val reflect.Value) (*options, error) {
+	if o == nil || (o.maxDepth == 0 && o.maxElems == 0) {
+		return o, nil
+	}
+	v := val
+	for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		if o.checked {
+			return o, nil
+		}
+		if err := o.checkElems(v, o.depth, map[visit]bool{}); err != nil {
+			return nil, err
+		}
+		c := *o
+		c.checked = true
+		return &c, nil
+	case reflect.Struct:
+		// collections are indexed too, but their fields are read as
+		// attributes, so their fields' contents are checked separately.
+		if err := o.checkElems(v, o.depth, map[visit]bool{}); err != nil {
+			return nil, err
+		}
+		if o.checked {
+			c := *o
+			c.checked = false
+			return &c, nil
+		}
+	}
+	return o, nil
+}
+
+// structPath is a list of pointers to structs, innermost first.
+type structPath struct {
+	visit
+	parent *structPath
+}
+
+func (o *options) parentStructs() *structPath {
+	if o == nil {
+		return nil
+	}
+	return o.parents
+}
+
+// visit identifies a map, slice or pointer already checked by checkElems.
+type visit struct {
+	t reflect.Type
+	p uintptr
+}
+
+// checkElems returns an error if the elements of v, which is at the given
+// depth, or anything reachable from them by indexing and iterating, exceed the
+// limits.
+func (o *options) checkElems(v reflect.Value, depth int, seen map[visit]bool) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Ptr {
+			// pointers may form cycles.
+			key := visit{v.Type(), v.Pointer()}
+			if seen[key] {
+				return nil
+			}
+			seen[key] = true
+		}
+		v = v.Elem()
+	}
+	var elems []reflect.Value
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			// bytes
+			return nil
+		}
+		key := visit{v.Type(), v.Pointer()}
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+		fallthrough
+	case reflect.Array:
+		if o.maxElems > 0 && v.Len() > o.maxElems {
+			return fmt.Errorf("can't convert %s: %d elements exceeds max of %d", v.Type(), v.Len(), o.maxElems)
+		}
+		if v.Kind() == reflect.Map {
+			iter := v.MapRange()
+			for iter.Next() {
+				elems = append(elems, iter.Key(), iter.Value())
+			}
+			break
+		}
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, v.Index(i))
+		}
+	case reflect.Struct:
+		recv := v
+		if v.CanAddr() {
+			recv = v.Addr()
+		}
+		lenFn, at := lenMethod(recv), atMethod(recv)
+		if !lenFn.IsValid() || !at.IsValid() {
+			return nil
+		}
+		n := int(lenFn.Call(nil)[0].Int())
+		if o.maxElems > 0 && n > o.maxElems {
+			return fmt.Errorf("can't convert %s: %d elements exceeds max of %d", v.Type(), n, o.maxElems)
+		}
+		for i := 0; i < n; i++ {
+			elems = append(elems, at.Call([]reflect.Value{reflect.ValueOf(i)})[0])
+		}
+	default:
+		return nil
+	}
+	if len(elems) > 0 && o.maxDepth > 0 && depth >= o.maxDepth {
+		e := elems[0]
+		if e.Kind() == reflect.Interface && !e.IsNil() {
+			e = e.Elem()
+		}
+		return fmt.Errorf("can't convert %s: exceeds max depth of %d", e.Type(), o.maxDepth)
+	}
+	for _, e := range elems {
+		if err := o.checkElems(e, depth+1, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithThread tells wrapped values which thread the script using them runs on.
+// Values converted with a thread report script access to deprecated fields and
+// methods (see Deprecate).  Since the thread is only valid for a single run,
+// values converted with this option should not be shared between runs.
+func WithThread(thread *starlark.Thread) Option {
+	return func(o *options) {
+		o.thread = thread
+	}
+}
+
+// OnDeprecated sets the function called when a script first uses a deprecated
+// Go field, method or function during a run.  By default a warning is printed
+// with the thread's Print function.
+func OnDeprecated(fn func(Deprecation)) Option {
+	return func(o *options) {
+		o.onDeprecated = fn
+	}
+}
+
+// ReadOnly makes the converted values read-only, as if frozen, so scripts
+// can't set struct fields, or change maps and slices, reached through them.
+// Methods can still change the values they're called on, so only share
+// values whose methods don't with untrusted scripts.
+func ReadOnly() Option {
+	return func(o *options) {
+		o.frozen = true
+	}
+}
+
+// BytesAsString converts byte slices to starlark strings instead of bytes, for
+// scripts that treat them as text.
+func BytesAsString() Option {
+	return func(o *options) {
+		o.strings = true
+	}
+}
+
+// StrictNil makes converting nil pointers and interfaces an error, instead of
+// converting them to None.
+func StrictNil() Option {
+	return func(o *options) {
+		o.strictNil = true
+	}
+}
+
+// TextMarshalers converts values that implement encoding.TextMarshaler (such
+// as UUIDs or netip.Addr) to starlark strings of their text form, instead of
+// exposing their internals to scripts.  Times and big numbers are still
+// converted to their starlark types.  Whether or not this option is used,
+// strings passed to Go code that expects a type that implements
+// encoding.TextUnmarshaler are converted with UnmarshalText.
+func TextMarshalers() Option {
+	return func(o *options) {
+		o.text = true
+	}
+}
+
+// JSONMarshalers converts values that implement json.Marshaler by marshaling
+// them to JSON and converting the result to starlark dicts, lists, strings,
+// numbers, bools and None, so that types such as API responses can be used by
+// scripts as plain data.  The result is a copy, so changes scripts make to it
+// don't change the Go value.  TextMarshalers takes precedence for types that
+// implement both.
+func JSONMarshalers() Option {
+	return func(o *options) {
+		o.json = true
+	}
+}
+
+// Stringers converts values of otherwise unsupported types, such as handles
+// and complex numbers, to starlark strings if they implement fmt.Stringer, for
+// scripts that only need to display them.
+func Stringers() Option {
+	return func(o *options) {
+		o.stringer = true
+	}
+}
+
+// Channels converts channels as NewGoChan does, so that scripts can receive
+// from them, iterate over them and send on them.  Without it, channels can't
+// be converted, since a script blocking on a channel can stall its host.
+// Combine it with WithThread so that blocked scripts stop when their run is
+// cancelled.
+func Channels() Option {
+	return func(o *options) {
+		o.chans = true
+	}
+}
+
+// SortedKeys sorts the keys of Go maps, so that dicts made by MakeDict and
+// wrapped maps list their keys in the same order every run, for scripts whose
+// output must be reproducible.  Strings, numbers and bools sort by value, and
+// other keys by their printed form.
+func SortedKeys() Option {
+	return func(o *options) {
+		o.sorted = true
+	}
+}
+
+// StructsAsDicts converts structs to starlark dicts of their exported fields,
+// for scripts written against plain data, such as those ported from a JSON
+// based system.  Structs in the fields' values are converted to dicts too.
+// The dicts are copies, so changes scripts make to them don't change the Go
+// values; use Decode to read them back into structs.  Keys are named like the
+// attributes of wrapped structs, so Naming and TagName apply, and fields whose
+// tag has the omitempty option, e.g. `json:"name,omitempty"`, are left out
+// when they are the zero value.
+func StructsAsDicts() Option {
+	return func(o *options) {
+		o.dicts = true
+	}
+}
+
+// StarlarkStructs converts structs to the structs of the
+// go.starlark.net/starlarkstruct package, like those made by its struct
+// builtin, for code that mixes converted values with that package.  The
+// fields are converted like those of StructsAsDicts, and take precedence over
+// it.  FromValue converts the structs back to maps, and Decode can decode them
+// into Go structs.
+func StarlarkStructs() Option {
+	return func(o *options) {
+		o.structs = true
+	}
+}
+
+// PanicStacks adds the Go stack to the PanicError returned when a Go function
+// called by a script panics, to help find the bug.  It's left out by default,
+// since scripts see the error, and the stack tells them about the host.
+func PanicStacks() Option {
+	return func(o *options) {
+		o.stacks = true
+	}
+}
+
+// CallTimeout limits how long each call of a Go function wrapped with these
+// options (see MakeStarFnWithOptions), or of the methods of values converted
+// with them, may take, so that e.g. a slow RPC can't hang a script.  The call
+// runs with a context with the deadline, derived from the run's context, which
+// functions that take a *starlark.Thread can get with ThreadContext.  If the
+// deadline passes, or the run is cancelled, before the function returns, the
+// script's thread is cancelled and the call fails.  Functions that don't take
+// the thread aren't waited for, and are left to finish in the background.
+// Functions that take the thread may use it, e.g. to call back into starlark,
+// so they're waited for, and should stop when its context is done.  Zero
+// means no limit.
+func CallTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// CompareIdentity makes structs held by pointer equal only if they're the same
+// struct, instead of if the structs they point to are equal.
+func CompareIdentity() Option {
+	return func(o *options) {
+		o.ident = true
+	}
+}
+
+// CallMethod makes structs that have a method with the given name, e.g.
+// "Call" or "Invoke", callable by scripts, so that rule(x) calls rule.Call(x).
+// Arguments and results are converted as for MakeStarFn.
+func CallMethod(name string) Option {
+	return func(o *options) {
+		o.callMethod = name
+	}
+}
+
+// Validator sets fn to check the values scripts set the fields of structs of
+// type t to, e.g. to enforce ranges or enum membership.  fn is passed the Go
+// name of the field and its old and new values, and if it returns an error,
+// the field isn't set and the script fails with the error.  t may be a struct
+// type or a pointer to one.
+func Validator(t reflect.Type, fn func(field string, old, new interface{}) error) Option {
+	return FieldValidator(t, "", fn)
+}
+
+// FieldValidator is like Validator, but only checks the field of t with the
+// given Go name.
+func FieldValidator(t reflect.Type, field string, fn func(field string, old, new interface{}) error) Option {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return func(o *options) {
+		if o.validators == nil {
+			o.validators = map[reflect.Type][]fieldValidator{}
+		}
+		o.validators[t] = append(o.validators[t], fieldValidator{field: field, fn: fn})
+	}
+}
+
+// Getters makes the values of getter methods of structs attributes, as
+// protobuf and builder style Go APIs expect, so that a method GetName or
+// IsActive is read as the attribute Name or Active (or name and active with
+// Naming(SnakeCase)).  Getters must take no arguments and return a value, and
+// optionally an error.  They're called each time a script reads the
+// attribute.  Fields and methods of the same name take precedence, and the
+// methods can still be called too.
+func Getters() Option {
+	return func(o *options) {
+		o.getter = true
+	}
+}
+
+// OmitEmpty leaves fields that are the zero value, such as empty strings and
+// zeroes, out of the dicts and structs that StructsAsDicts, StarlarkStructs and
+// to_dict() make, so that sparse structs don't flood scripts with empty
+// values.
+func OmitEmpty() Option {
+	return func(o *options) {
+		o.omitZero = true
+	}
+}
+
+// ResultStyle is how Go functions called by scripts return multiple values.
+// See Results.
+type ResultStyle int
+
+// Result styles.
+const (
+	// TupleResults returns multiple values as a tuple.  It's the default.
+	TupleResults ResultStyle = iota
+	// ListResults returns multiple values as a list.
+	ListResults
+	// DictResults returns multiple values as a dict keyed by the names given
+	// to Results, or result0, result1 and so on.
+	DictResults
+	// FirstResult returns only the first value, e.g. the value of a function
+	// that returns (value, ok).
+	FirstResult
+	// RawResults returns all the values as a tuple, including a trailing
+	// error, as its message or None, rather than failing the script when
+	// it's not nil.
+	RawResults
+)
+
+// Results sets how Go functions return multiple values to scripts, after a
+// trailing error is removed, for functions wrapped with these options (see
+// MakeStarFnWithOptions) and methods of values converted with them.  With
+// DictResults, names are the keys of the values, in order, e.g.
+// Results(DictResults, "value", "ok").  A single value is always returned as
+// it is.
+func Results(style ResultStyle, names ...string) Option {
+	return func(o *options) {
+		o.resultStyle = style
+		o.resultNames = names
+	}
+}
+
+// MaxDepth limits how deeply nested the converted data may be, for untrusted or
+// very deep Go data.  The converted value itself has depth 0, and its fields,
+// elements and function results have depth 1, and so on.  Since wrapped values
+// are converted as scripts use them, a script that reaches past the max depth
+// gets an error.  Maps, slices and arrays can't fail when scripts index or
+// loop over them, so they can't be converted at all if anything reachable
+// that way is too deep.  Zero means no limit.
+func MaxDepth(n int) Option {
+	return func(o *options) {
+		o.maxDepth = n
+	}
+}
+
+// MaxElements limits the number of elements of each map, slice or array that
+// is converted, and of the starlark values made from them.  As with MaxDepth,
+// the elements of maps, slices and arrays are checked when they're converted.
+// Zero means no limit.
+func MaxElements(n int) Option {
+	return func(o *options) {
+		o.maxElems = n
+	}
+}
+
+// Naming sets the names scripts use for the fields and methods of Go structs,
+// and for keyword arguments of Go functions that take a struct (see
+// MakeStarFn), e.g. SnakeCase or LowerCamelCase.  fn is passed the Go name.
+// Without it, scripts use the Go names.  Fields named by a struct tag
+// (see TagName) keep the tag's name.
+func Naming(fn func(goName string) string) Option {
+	return func(o *options) {
+		o.naming = fn
+	}
+}
+
+// TagName names struct fields by the struct tag with the given key, e.g.
+// "json", like encoding/json does.  Fields without the tag are named by the
+// naming policy (see Naming), and fields tagged "-" are hidden from scripts.
+// Names set by a field's starlark tag take precedence.
+func TagName(tag string) Option {
+	return func(o *options) {
+		o.tag = tag
+	}
+}
+
+// Converter sets fn to convert values of type t, for this conversion only.  It
+// takes precedence over converters registered with RegisterConverter.
+func Converter(t reflect.Type, fn func(interface{}) (starlark.Value, error)) Option {
+	return func(o *options) {
+		if o.converters == nil {
+			o.converters = map[reflect.Type]func(interface{}) (starlark.Value, error){}
+		}
+		o.converters[t] = fn
+	}
+}
+
+func makeOptions(opts []Option) *options {
+	if len(opts) == 0 {
+		return nil
+	}
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// ToValueWithOptions is like ToValue, but configures the conversion with the
+// given options.
+func ToValueWithOptions(v interface{}, opts ...Option) (starlark.Value, error) {
+	if val, ok := v.(starlark.Value); ok {
+		return val, nil
+	}
+	return toValue(reflect.ValueOf(v), makeOptions(opts))
+}
+
+// MakeDictWithOptions is like MakeDict, but configures the conversion with the
+// given options.
+func MakeDictWithOptions(v interface{}, opts ...Option) (starlark.Value, error) {
+	return makeDict(reflect.ValueOf(v), makeOptions(opts))
+}
+
+// NewStructWithOptions is like NewStruct, but configures the conversion with
+// the given options.
+func NewStructWithOptions(strct interface{}, opts ...Option) *GoStruct {
+	g := NewStruct(strct)
+	g.opts = makeOptions(opts)
+	g.frozen = g.opts.isFrozen()
+	return g
+}
+
+// MakeStarFnWithOptions is like MakeStarFn, but configures the conversion of
+// the function's arguments and results with the given options.
+func MakeStarFnWithOptions(name string, gofn interface{}, opts ...Option) *starlark.Builtin {
+	v := reflect.ValueOf(gofn)
+	if v.Kind() != reflect.Func {
+		panic(errors.New("fn is not a function"))
+	}
+	o := makeOptions(opts)
+	return deprecateFn(makeStarFn(name, v, o), v, o)
+}
+
+// MakeStringDictWithOptions is like MakeStringDict, but configures the
+// conversion with the given options.
+func MakeStringDictWithOptions(m map[string]interface{}, opts ...Option) (starlark.StringDict, error) {
+	o := makeOptions(opts)
+	dict := make(starlark.StringDict, len(m))
+	for k, v := range m {
+		if val, ok := v.(starlark.Value); ok {
+			dict[k] = val
+			continue
+		}
+		val, err := toValue(reflect.ValueOf(v), o)
+		if err != nil {
+			return nil, err
+		}
+		dict[k] = val
+	}
+	return dict, nil
+}
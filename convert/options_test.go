@@ -0,0 +1,445 @@
+package convert_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+type userRecord struct {
+	UserID    int
+	HTTPProxy string
+	Email     string `json:"mail,omitempty"`
+	Password  string `json:"-"`
+	Tags      []string
+}
+
+func (u *userRecord) DisplayName() string {
+	return "user " + u.Email
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"Name":        "name",
+		"UserID":      "user_id",
+		"HTTPProxy":   "http_proxy",
+		"DisplayName": "display_name",
+		"Base64Data":  "base64_data",
+	}
+	for in, want := range tests {
+		if got := convert.SnakeCase(in); got != want {
+			t.Errorf("SnakeCase(%q): expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestLowerCamelCase(t *testing.T) {
+	tests := map[string]string{
+		"Name":       "name",
+		"UserID":     "userID",
+		"HTTPServer": "httpServer",
+		"ID":         "id",
+	}
+	for in, want := range tests {
+		if got := convert.LowerCamelCase(in); got != want {
+			t.Errorf("LowerCamelCase(%q): expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestNamingOptions(t *testing.T) {
+	u := &userRecord{UserID: 1, Email: "bob@example.com", Password: "hunter2", Tags: []string{"a"}}
+	globals, err := convert.MakeStringDictWithOptions(map[string]interface{}{
+		"u":     u,
+		"users": map[string]*userRecord{"bob": u},
+	}, convert.Naming(convert.SnakeCase), convert.TagName("json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals["assert"] = convert.NewStruct(&assert{t: t})
+	code := `
+assert.Eq(u.user_id, 1)
+assert.Eq(u.mail, "bob@example.com")
+assert.Eq(users["bob"].display_name(), "user bob@example.com")
+assert.Eq(hasattr(u, "Password"), False)
+assert.Eq(hasattr(u, "password"), False)
+assert.Eq(hasattr(u, "UserID"), False)
+assert.Eq(sorted(dir(u)), ["display_name", "http_proxy", "mail", "tags", "to_dict", "user_id"])
+u.http_proxy = "proxy:8080"
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "names.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	if u.HTTPProxy != "proxy:8080" {
+		t.Errorf("expected HTTPProxy to be set, got %q", u.HTTPProxy)
+	}
+	_, err = starlark.ExecFile(&starlark.Thread{}, "hidden.star", `u.Password = "x"`, globals)
+	expectErr(t, err, "go.struct<*convert_test.userRecord> has no .Password field; its fields are user_id, http_proxy, mail, tags")
+}
+
+func TestConverterOption(t *testing.T) {
+	hideEmail := convert.Converter(reflect.TypeOf(userRecord{}), func(v interface{}) (starlark.Value, error) {
+		return starlark.String("<user>"), nil
+	})
+	d, err := convert.MakeDictWithOptions(map[string]userRecord{"bob": {}}, hideEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _, err := d.(*starlark.Dict).Get(starlark.String("bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != starlark.String("<user>") {
+		t.Errorf("expected <user>, got %v", v)
+	}
+
+	s := convert.NewStructWithOptions(&struct{ Owner userRecord }{}, hideEmail)
+	v, err = s.Attr("Owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != starlark.String("<user>") {
+		t.Errorf("expected <user>, got %v", v)
+	}
+}
+
+func TestSortedKeys(t *testing.T) {
+	m := map[string]int{"c": 3, "a": 1, "d": 4, "b": 2}
+	v, err := convert.MakeDictWithOptions(m, convert.SortedKeys())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := v.String(), `{"a": 1, "b": 2, "c": 3, "d": 4}`; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	mixed := map[interface{}]bool{3: true, "x": true, 1: true, "a": true}
+	v, err = convert.ToValueWithOptions(mixed, convert.SortedKeys())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	iter := v.(starlark.Iterable).Iterate()
+	defer iter.Done()
+	var k starlark.Value
+	for iter.Next(&k) {
+		keys = append(keys, k.String())
+	}
+	if want := []string{"1", "3", `"a"`, `"x"`}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("expected %v, got %v", want, keys)
+	}
+}
+
+type order struct {
+	ID       int
+	Customer userRecord
+	Items    []orderItem
+	Note     string `json:"note,omitempty"`
+	internal bool
+}
+
+type orderItem struct {
+	SKU string `json:"sku"`
+	Qty int    `json:"qty"`
+}
+
+func TestStructsAsDicts(t *testing.T) {
+	o := &order{
+		ID:       7,
+		Customer: userRecord{UserID: 1, Email: "bob@example.com", Password: "hunter2"},
+		Items:    []orderItem{{SKU: "a1", Qty: 2}},
+	}
+	globals, err := convert.MakeStringDictWithOptions(map[string]interface{}{"o": o},
+		convert.StructsAsDicts(), convert.Naming(convert.SnakeCase), convert.TagName("json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals["assert"] = convert.NewStruct(&assert{t: t})
+	code := `
+assert.Eq(type(o), "dict")
+assert.Eq(sorted(o.keys()), ["customer", "id", "items"])
+assert.Eq(sorted(o["customer"].keys()), ["http_proxy", "mail", "tags", "user_id"])
+assert.Eq(o["customer"]["mail"], "bob@example.com")
+assert.Eq(o["items"][0], {"sku": "a1", "qty": 2})
+o["id"] = 8
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	if o.ID != 7 {
+		t.Fatalf("expected the dict to be a copy, but the struct changed to %d", o.ID)
+	}
+}
+
+func TestStarlarkStructs(t *testing.T) {
+	o := &order{ID: 7, Items: []orderItem{{SKU: "a1", Qty: 2}}}
+	var got orderItem
+	globals, err := convert.MakeStringDictWithOptions(map[string]interface{}{
+		"o":    o,
+		"save": func(item orderItem) { got = item },
+	}, convert.StarlarkStructs(), convert.Naming(convert.SnakeCase), convert.TagName("json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals["assert"] = convert.NewStruct(&assert{t: t})
+	globals["struct"] = starlark.NewBuiltin("struct", starlarkstruct.Make)
+	code := `
+assert.Eq(type(o), "struct")
+assert.Eq(o.id, 7)
+assert.Eq(type(o.customer), "struct")
+assert.Eq(o.items[0].sku, "a1")
+save(struct(sku="b2", qty=3))
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	if want := (orderItem{SKU: "b2", Qty: 3}); got != want {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	m := convert.FromValue(globals["o"]).(map[string]interface{})
+	if m["id"] != int64(7) {
+		t.Fatalf("expected id 7, got %#v", m)
+	}
+}
+
+type minLength struct {
+	Min int
+}
+
+func (r minLength) Check(s string) (bool, error) {
+	if r.Min < 0 {
+		return false, fmt.Errorf("bad rule")
+	}
+	return len(s) >= r.Min, nil
+}
+
+func TestCallMethod(t *testing.T) {
+	globals, err := convert.MakeStringDictWithOptions(map[string]interface{}{
+		"rule": minLength{Min: 3},
+		"bad":  minLength{Min: -1},
+	}, convert.CallMethod("Check"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals["assert"] = convert.NewStruct(&assert{t: t})
+	code := `
+assert.Eq(rule("abcd"), True)
+assert.Eq(rule("ab"), False)
+assert.Eq(rule.Min, 3)
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	_, err = starlark.ExecFile(&starlark.Thread{}, "foo.star", `bad("x")`, globals)
+	if err == nil || !strings.Contains(err.Error(), "bad rule") {
+		t.Fatalf("expected the method's error, got %v", err)
+	}
+}
+
+type listener struct {
+	Host string
+	Port int
+	Mode string
+}
+
+func TestValidators(t *testing.T) {
+	srv := &listener{Host: "localhost", Port: 80, Mode: "dev"}
+	var changes []string
+	globals, err := convert.MakeStringDictWithOptions(map[string]interface{}{"srv": srv},
+		convert.FieldValidator(reflect.TypeOf(listener{}), "Port", func(field string, old, new interface{}) error {
+			if p := new.(int); p < 1 || p > 65535 {
+				return fmt.Errorf("port %d out of range", p)
+			}
+			return nil
+		}),
+		convert.Validator(reflect.TypeOf(&listener{}), func(field string, old, new interface{}) error {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", field, old, new))
+			if field == "Mode" && new != "dev" && new != "prod" {
+				return fmt.Errorf("unknown mode %q", new)
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := `
+srv.Port = 8080
+srv.Mode = "prod"
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Port != 8080 || srv.Mode != "prod" {
+		t.Fatalf("unexpected %+v", srv)
+	}
+	want := []string{"Port: 80 -> 8080", "Mode: dev -> prod"}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("expected %q, got %q", want, changes)
+	}
+	fails := map[string]string{
+		`srv.Port = 0`:      "Port: port 0 out of range",
+		`srv.Mode = "test"`: `Mode: unknown mode "test"`,
+	}
+	for code, msg := range fails {
+		_, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals)
+		if err == nil || !strings.HasSuffix(err.Error(), msg) {
+			t.Errorf("%s: expected error %q, got %v", code, msg, err)
+		}
+	}
+	if srv.Port != 8080 || srv.Mode != "prod" {
+		t.Fatalf("failed validation changed the struct: %+v", srv)
+	}
+}
+
+type profile struct {
+	name   string
+	active bool
+}
+
+func (p *profile) GetName() string        { return p.name }
+func (p *profile) IsActive() bool         { return p.active }
+func (p *profile) GetAge() (int, error)   { return 0, fmt.Errorf("age unknown") }
+func (p *profile) Issue() string          { return "none" }
+func (p *profile) GetFriend(n int) string { return "" }
+
+func TestGetters(t *testing.T) {
+	p := &profile{name: "bob", active: true}
+	globals, err := convert.MakeStringDictWithOptions(map[string]interface{}{"p": p},
+		convert.Getters(), convert.Naming(convert.SnakeCase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals["assert"] = convert.NewStruct(&assert{t: t})
+	code := `
+assert.Eq(p.name, "bob")
+assert.Eq(p.active, True)
+assert.Eq(p.get_name(), "bob")
+assert.Eq([n for n in dir(p) if n in ("name", "active", "age", "friend", "sue")], ["active", "age", "name"])
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	_, err = starlark.ExecFile(&starlark.Thread{}, "foo.star", "p.age", globals)
+	if err == nil || !strings.Contains(err.Error(), "age unknown") {
+		t.Fatalf("expected the getter's error, got %v", err)
+	}
+}
+
+type dbConfig struct {
+	Host     string `yaml:"host"`
+	Password string `yaml:"-"`
+	Port     int    `yaml:"port" starlark:"db_port"`
+	Timeout  int
+}
+
+func TestTagNameDicts(t *testing.T) {
+	cfg := &dbConfig{Host: "db", Password: "secret", Port: 5432, Timeout: 3}
+	globals, err := convert.MakeStringDictWithOptions(map[string]interface{}{"cfg": cfg}, convert.TagName("yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals["assert"] = convert.NewStruct(&assert{t: t})
+	code := `
+assert.Eq(cfg.host, "db")
+assert.Eq(cfg.db_port, 5432)
+assert.Eq(cfg.to_dict(), {"host": "db", "db_port": 5432, "Timeout": 3})
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	d, err := convert.ToValueWithOptions(cfg, convert.TagName("yaml"), convert.StructsAsDicts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.String(), `{"host": "db", "db_port": 5432, "Timeout": 3}`; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestOmitEmpty(t *testing.T) {
+	cfg := &dbConfig{Host: "db"}
+	d, err := convert.ToValueWithOptions(cfg, convert.StructsAsDicts(), convert.OmitEmpty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.String(), `{"Host": "db"}`; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	globals := starlark.StringDict{
+		"cfg":    convert.NewStruct(cfg),
+		"assert": convert.NewStruct(&assert{t: t}),
+	}
+	code := `
+assert.Eq(cfg.to_dict(omit_empty=True), {"Host": "db"})
+assert.Eq(len(cfg.to_dict()), 4)
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResults(t *testing.T) {
+	lookup := func(key string) (string, bool) { return strings.ToUpper(key), key != "" }
+	parse := func(s string) (int, string, error) {
+		if s == "" {
+			return 0, "", fmt.Errorf("empty")
+		}
+		return len(s), s, nil
+	}
+	globals := starlark.StringDict{
+		"tuple":  convert.MakeStarFnWithOptions("tuple", lookup),
+		"list":   convert.MakeStarFnWithOptions("list", lookup, convert.Results(convert.ListResults)),
+		"dict":   convert.MakeStarFnWithOptions("dict", lookup, convert.Results(convert.DictResults, "value", "ok")),
+		"first":  convert.MakeStarFnWithOptions("first", lookup, convert.Results(convert.FirstResult)),
+		"raw":    convert.MakeStarFnWithOptions("raw", parse, convert.Results(convert.RawResults)),
+		"parse":  convert.MakeStarFnWithOptions("parse", parse, convert.Results(convert.DictResults)),
+		"assert": convert.NewStruct(&assert{t: t}),
+	}
+	code := `
+assert.Eq(tuple("a"), ("A", True))
+assert.Eq(list("a"), ["A", True])
+assert.Eq(dict(""), {"value": "", "ok": False})
+assert.Eq(first("a"), "A")
+assert.Eq(raw("ab"), (2, "ab", None))
+assert.Eq(raw(""), (0, "", "empty"))
+assert.Eq(parse("ab"), {"result0": 2, "result1": "ab"})
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	_, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", `parse("")`, globals)
+	if err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Fatalf("expected the function's error, got %v", err)
+	}
+}
+
+func TestStructDictCycles(t *testing.T) {
+	n := &node{Name: "a"}
+	n.Next = &node{Name: "b", Next: n}
+	for _, opt := range []convert.Option{convert.StructsAsDicts(), convert.StarlarkStructs()} {
+		_, err := convert.ToValueWithOptions(n, opt)
+		expectErr(t, err, "Next: Next: can't convert *convert_test.node: it refers to itself")
+	}
+	_, err := starlark.ExecFile(&starlark.Thread{}, "foo.star", `n.to_dict()`, starlark.StringDict{"n": convert.NewStruct(n)})
+	expectErr(t, err, "Next: Next: can't convert *convert_test.node: it refers to itself")
+
+	// structs reached twice, but not through themselves, are fine.
+	shared := &node{Name: "c"}
+	v, err := convert.ToValueWithOptions(&pair{Left: shared, Right: shared}, convert.StructsAsDicts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := v.String(), `{"Left": {"Name": "c", "Next": None, "Extra": None}, "Right": {"Name": "c", "Next": None, "Extra": None}}`; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+type pair struct {
+	Left, Right *node
+}
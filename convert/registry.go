@@ -0,0 +1,104 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"go.starlark.net/starlark"
+)
+
+var registry = struct {
+	sync.RWMutex
+	to   map[reflect.Type]func(interface{}) (starlark.Value, error)
+	from map[reflect.Type]func(starlark.Value) (interface{}, error)
+}{
+	to:   map[reflect.Type]func(interface{}) (starlark.Value, error){},
+	from: map[reflect.Type]func(starlark.Value) (interface{}, error){},
+}
+
+// RegisterConverter registers fn to convert Go values of type t to starlark
+// values, for domain types (such as UUIDs or protobuf messages) that ToValue
+// doesn't convert the way an application wants.  fn is passed values of
+// exactly type t, and takes precedence over the built-in conversions.  Passing
+// a nil fn removes the converter for t.
+//
+// Converters are global, so they should be registered during initialization.
+func RegisterConverter(t reflect.Type, fn func(interface{}) (starlark.Value, error)) {
+	registry.Lock()
+	defer registry.Unlock()
+	if fn == nil {
+		delete(registry.to, t)
+		return
+	}
+	registry.to[t] = fn
+}
+
+// RegisterReverseConverter registers fn to convert starlark values to Go
+// values of type t, the reverse of RegisterConverter.  It is used wherever a
+// script passes a value to Go code that expects a t: function arguments,
+// struct fields, and map, slice and channel elements.  fn must return a value
+// assignable to t.  Passing a nil fn removes the converter for t.
+func RegisterReverseConverter(t reflect.Type, fn func(starlark.Value) (interface{}, error)) {
+	registry.Lock()
+	defer registry.Unlock()
+	if fn == nil {
+		delete(registry.from, t)
+		return
+	}
+	registry.from[t] = fn
+}
+
+// toRegistered converts val with the converter set in o or registered for its
+// type, if there is one.
+func toRegistered(val reflect.Value, o *options) (starlark.Value, bool, error) {
+	fn, ok := o.converter(val.Type())
+	if !ok {
+		registry.RLock()
+		fn, ok = registry.to[val.Type()]
+		registry.RUnlock()
+	}
+	if !ok || !val.CanInterface() {
+		return nil, false, nil
+	}
+	v, err := fn(val.Interface())
+	if err != nil {
+		return nil, true, err
+	}
+	if v == nil {
+		return nil, true, fmt.Errorf("converter for %v returned nil", val.Type())
+	}
+	return v, true, nil
+}
+
+// hasReverseConverter reports whether a reverse converter is registered for
+// t.
+func hasReverseConverter(t reflect.Type) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	_, ok := registry.from[t]
+	return ok
+}
+
+// fromRegistered converts v to a t with the reverse converter registered for
+// t, if there is one.
+func fromRegistered(v starlark.Value, t reflect.Type) (reflect.Value, bool, error) {
+	registry.RLock()
+	fn, ok := registry.from[t]
+	registry.RUnlock()
+	if !ok {
+		return reflect.Value{}, false, nil
+	}
+	out, err := fn(v)
+	if err != nil {
+		return reflect.Value{}, true, err
+	}
+	rv := reflect.ValueOf(out)
+	if !rv.IsValid() {
+		return reflect.Zero(t), true, nil
+	}
+	if !rv.Type().AssignableTo(t) {
+		return reflect.Value{}, true, fmt.Errorf("converter for %v returned %v", t, rv.Type())
+	}
+	return rv, true, nil
+}
@@ -0,0 +1,78 @@
+package convert_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+// acct is a domain type that scripts see as a string like "acct-42".
+type acct struct {
+	id int
+}
+
+func registerAcct(t *testing.T) {
+	typ := reflect.TypeOf(acct{})
+	convert.RegisterConverter(typ, func(v interface{}) (starlark.Value, error) {
+		return starlark.String(fmt.Sprintf("acct-%d", v.(acct).id)), nil
+	})
+	convert.RegisterReverseConverter(typ, func(v starlark.Value) (interface{}, error) {
+		s, ok := starlark.AsString(v)
+		if !ok || !strings.HasPrefix(s, "acct-") {
+			return nil, errors.New("not an account")
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(s, "acct-"))
+		if err != nil {
+			return nil, err
+		}
+		return acct{id: id}, nil
+	})
+	t.Cleanup(func() {
+		convert.RegisterConverter(typ, nil)
+		convert.RegisterReverseConverter(typ, nil)
+	})
+}
+
+type transfer struct {
+	From acct
+	To   acct
+}
+
+func TestRegisteredConverter(t *testing.T) {
+	registerAcct(t)
+	var got acct
+	tr := &transfer{From: acct{id: 1}}
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"tr":     tr,
+		"accts":  []acct{{id: 7}},
+		"use":    func(a acct) { got = a },
+	}
+	code := []byte(`
+assert.Eq(tr.From, "acct-1")
+assert.Eq(accts[0], "acct-7")
+tr.To = "acct-2"
+use("acct-3")
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if tr.To.id != 2 {
+		t.Errorf("expected To to be account 2, got %v", tr.To)
+	}
+	if got.id != 3 {
+		t.Errorf("expected account 3, got %v", got)
+	}
+
+	_, err := starlight.Eval([]byte(`use("bob")`), globals, nil)
+	expectErr(t, err, "arg 0: not an account")
+	_, err = starlight.Eval([]byte(`tr.To = "bob"`), globals, nil)
+	expectErr(t, err, "To: not an account")
+}
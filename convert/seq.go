@@ -0,0 +1,165 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.starlark.net/starlark"
+)
+
+var boolType = reflect.TypeOf(true)
+
+// NewGoSeq wraps a Go iterator function, of the form func(yield func(T) bool)
+// or func(yield func(K, V) bool) (i.e. iter.Seq or iter.Seq2), in a lazy
+// starlark iterable, so scripts can loop over it with for.  Values are
+// produced one at a time as the script asks for them, and the iterator
+// function is stopped (yield returns false) if the script leaves the loop
+// early.  Each loop calls the function again.  Pairs from two-argument
+// iterators are returned as (k, v) tuples.  This function will panic if seq is
+// not an iterator function.
+//
+// If the iterator function panics, the panic is raised again in the loop,
+// since iterators can't return errors, unless the sequence was converted
+// WithThread, in which case the script's thread is cancelled with a
+// *PanicError's message instead.
+func NewGoSeq(seq interface{}) *GoSeq {
+	v := reflect.ValueOf(seq)
+	if !isSeq(v.Type()) {
+		panic(fmt.Errorf("NewGoSeq expects a func(yield func(...) bool), but got %T", seq))
+	}
+	return &GoSeq{v: v}
+}
+
+func isSeq(t reflect.Type) bool {
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 0 {
+		return false
+	}
+	yield := t.In(0)
+	return yield.Kind() == reflect.Func &&
+		(yield.NumIn() == 1 || yield.NumIn() == 2) &&
+		yield.NumOut() == 1 && yield.Out(0) == boolType
+}
+
+// GoSeq is a wrapper around a Go iterator function to let scripts iterate over
+// it.
+type GoSeq struct {
+	v    reflect.Value
+	opts *options
+}
+
+// Iterate implements starlark.Iterable.
+func (g *GoSeq) Iterate() starlark.Iterator {
+	it := &seqIterator{
+		req:  make(chan struct{}),
+		vals: make(chan []reflect.Value),
+		stop: make(chan struct{}),
+		opts: g.opts,
+	}
+	go it.run(g.v)
+	return it
+}
+
+// String returns the string representation of the value.
+func (g *GoSeq) String() string {
+	return fmt.Sprintf("<%s>", g.Type())
+}
+
+// Type returns a short string describing the value's type.
+func (g *GoSeq) Type() string {
+	return fmt.Sprintf("go.seq<%s>", g.v.Type())
+}
+
+// Freeze is a no-op, iterating doesn't change the sequence.
+func (g *GoSeq) Freeze() {}
+
+// Truth returns the truth value of an object.
+func (g *GoSeq) Truth() starlark.Bool {
+	return !starlark.Bool(g.v.IsNil())
+}
+
+// Hash returns a function of x such that Equals(x, y) => Hash(x) == Hash(y).
+func (g *GoSeq) Hash() (uint32, error) {
+	return 0, errors.New("go.seq is not hashable")
+}
+
+// seqIterator runs the iterator function on its own goroutine, which only
+// moves on to the next value when Next asks for it.
+type seqIterator struct {
+	req  chan struct{}
+	vals chan []reflect.Value
+	stop chan struct{}
+	// panicked holds the value the iterator function panicked with.
+	panicked interface{}
+	done     bool
+	opts     *options
+}
+
+func (it *seqIterator) run(seq reflect.Value) {
+	defer close(it.vals)
+	defer func() { it.panicked = recover() }()
+	select {
+	case <-it.req:
+	case <-it.stop:
+		return
+	}
+	yield := reflect.MakeFunc(seq.Type().In(0), func(args []reflect.Value) []reflect.Value {
+		it.vals <- args
+		select {
+		case <-it.req:
+			return []reflect.Value{reflect.ValueOf(true)}
+		case <-it.stop:
+			return []reflect.Value{reflect.ValueOf(false)}
+		}
+	})
+	seq.Call([]reflect.Value{yield})
+}
+
+func (it *seqIterator) Next(p *starlark.Value) bool {
+	if it.done {
+		return false
+	}
+	select {
+	case it.req <- struct{}{}:
+	case <-it.vals:
+		// the iterator function has returned, closing vals.
+	}
+	args, ok := <-it.vals
+	if !ok {
+		it.done = true
+		if it.panicked != nil {
+			if it.opts.threadOrNil() == nil {
+				panic(it.panicked)
+			}
+			it.opts.failIteration(&PanicError{Func: "iterator", Value: it.panicked})
+		}
+		return false
+	}
+	vals := make(starlark.Tuple, len(args))
+	for i, a := range args {
+		v, err := toValue(a, it.opts.child())
+		if err != nil {
+			it.opts.failIteration(err)
+			it.Done()
+			return false
+		}
+		vals[i] = v
+	}
+	if len(vals) == 1 {
+		*p = vals[0]
+	} else {
+		*p = vals
+	}
+	return true
+}
+
+func (it *seqIterator) Done() {
+	if it.done {
+		return
+	}
+	it.done = true
+	close(it.stop)
+	// wait for the iterator function to return.
+	for range it.vals {
+	}
+}
@@ -0,0 +1,58 @@
+package convert_test
+
+import (
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+)
+
+func TestSeq(t *testing.T) {
+	var produced []int
+	count := func(yield func(int) bool) {
+		for i := 0; i < 10; i++ {
+			produced = append(produced, i)
+			if !yield(i) {
+				return
+			}
+		}
+	}
+	pairs := func(yield func(string, int) bool) {
+		_ = yield("a", 1) && yield("b", 2)
+	}
+	globals := map[string]interface{}{
+		"count": convert.NewGoSeq(count),
+		"pairs": convert.NewGoSeq(pairs),
+	}
+	out, err := starlight.Eval([]byte(`
+def first(n):
+    ret = []
+    for i in count:
+        if i == n:
+            break
+        ret.append(i)
+    return ret
+
+firsts = first(3)
+items = [k + str(v) for k, v in pairs]
+total = len(list(count))
+`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert := &assert{t: t}
+	assert.Eq([]interface{}{int64(0), int64(1), int64(2)}, out["firsts"])
+	assert.Eq([]interface{}{"a1", "b2"}, out["items"])
+	assert.Eq(int64(10), out["total"])
+	// the break stopped the first loop right after 3 was produced.
+	assert.Eq(14, len(produced))
+}
+
+func TestNewGoSeqPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	convert.NewGoSeq(func(int) bool { return true })
+}
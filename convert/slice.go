@@ -15,20 +15,47 @@ import (
 // Which is Copyright 2017 The Bazel Authors and uses a BSD 3-clause license.
 
 // GoSlice is a wrapper around a Go slice to adapt it for use with starlark.
+// Elements are converted when scripts use them, not when the slice is
+// wrapped, so wrapping even a huge slice is cheap when scripts only read a few
+// elements.
+//
+// Scripts can set elements, and append, insert, pop and remove them like in a
+// list.  Changes to the length of the slice are written back to the Go slice
+// if it is settable: a field of a struct held by pointer, an element of
+// another slice, or a slice passed to ToValue by pointer.  Otherwise only the
+// wrapper sees them.
 type GoSlice struct {
 	v      reflect.Value
+	opts   *options
 	numIt  int
 	frozen bool
 }
 
-// NewGoMap wraps the given slice in a new GoSlice.  This function will panic if m
-// is not a map.
+var (
+	_ starlark.Sliceable   = (*GoSlice)(nil)
+	_ starlark.HasSetIndex = (*GoSlice)(nil)
+)
+
+// NewGoSlice wraps the given slice or array in a new GoSlice.  Scripts can set
+// the elements of a wrapped array, but not change its length.  This function
+// will panic if slice is not a slice or array.
 func NewGoSlice(slice interface{}) *GoSlice {
 	v := reflect.ValueOf(slice)
-	if v.Kind() != reflect.Slice || v.Kind() != reflect.Array {
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
 		panic(fmt.Errorf("NewGoSlice expects a slice or array, but got %T", slice))
 	}
-	return &GoSlice{v: v}
+	return &GoSlice{v: addressable(v)}
+}
+
+// addressable returns v, or a copy of v that can be set if v is an array that
+// can't, so that scripts can set the elements of arrays passed by value.
+func addressable(v reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Array || v.CanAddr() {
+		return v
+	}
+	cp := reflect.New(v.Type()).Elem()
+	cp.Set(v)
+	return cp
 }
 
 // String returns the string representation of the value.
@@ -39,7 +66,7 @@ func (g *GoSlice) String() string {
 
 // Type returns a short string describing the value's type.
 func (g *GoSlice) Type() string {
-	return fmt.Sprintf("starlight_slice<%T>", g.v.Interface())
+	return fmt.Sprintf("go.slice<%T>", g.v.Interface())
 }
 
 // Freeze causes the value, and all values transitively
@@ -61,19 +88,30 @@ func (g *GoSlice) Truth() starlark.Bool {
 // Hash may fail if the value's type is not hashable, or if the value
 // contains a non-hashable value.
 func (g *GoSlice) Hash() (uint32, error) {
-	return 0, errors.New("starlight_slice is not hashable")
+	return 0, errors.New("go.slice is not hashable")
 }
 
 func (g *GoSlice) Clear() error {
-	if err := g.checkMutable("clear"); err != nil {
+	if err := g.checkResizable("clear"); err != nil {
 		return err
 	}
-	g.v = g.v.Slice(0, 0)
+	g.set(g.v.Slice(0, 0))
 	return nil
 }
 
+// set replaces the wrapped slice with s, e.g. after appending to it.  If the
+// slice is settable, such as a field of a struct held by pointer, it is
+// updated in place, so the Go code that owns it sees the change.
+func (g *GoSlice) set(s reflect.Value) {
+	if g.v.CanSet() {
+		g.v.Set(s)
+		return
+	}
+	g.v = s
+}
+
 func (g *GoSlice) Index(i int) starlark.Value {
-	v, err := toValue(g.v.Index(i))
+	v, err := toValue(g.v.Index(i), g.opts.nested(g.frozen))
 	if err != nil {
 		panic(err)
 	}
@@ -84,24 +122,32 @@ func (g *GoSlice) SetIndex(index int, v starlark.Value) error {
 	if err := g.checkMutable("assign to"); err != nil {
 		return err
 	}
-	val := conv(v, g.v.Type().Elem())
+	val, err := tryConv(v, g.v.Type().Elem())
+	if err != nil {
+		return err
+	}
 	g.v.Index(index).Set(val)
 	return nil
 }
 
 func (g *GoSlice) Slice(start, end, step int) starlark.Value {
-	// python slices are copies, so we don't just use .Slice here
+	// python slices are copies, so we don't just use .Slice here.  The copy
+	// can be changed, but the values in it are still those of this slice, so
+	// they stay frozen.  Slices of arrays are slices.
+	t := reflect.SliceOf(g.v.Type().Elem())
 	if step == 1 {
-		copy := reflect.MakeSlice(g.v.Type(), end-start, end-start)
-		reflect.Copy(copy, g.v.Slice(start, end))
-		return &GoSlice{v: copy}
+		copy := reflect.MakeSlice(t, end-start, end-start)
+		for i := start; i < end; i++ {
+			copy.Index(i - start).Set(g.v.Index(i))
+		}
+		return &GoSlice{v: copy, opts: g.opts.withFrozen(g.frozen)}
 	}
-	copy := reflect.MakeSlice(g.v.Type().Elem(), 0, 0)
+	copy := reflect.MakeSlice(t, 0, 0)
 	sign := signOf(step)
 	for i := start; signOf(end-i) == sign; i += step {
 		copy = reflect.Append(copy, g.v.Index(i))
 	}
-	return &GoSlice{v: copy}
+	return &GoSlice{v: copy, opts: g.opts.withFrozen(g.frozen)}
 }
 
 func signOf(i int) int {
@@ -176,7 +222,7 @@ type sliceIterator struct {
 
 func (it *sliceIterator) Next(p *starlark.Value) bool {
 	if it.i < it.g.v.Len() {
-		v, err := toValue(it.g.v.Index(it.i))
+		v, err := toValue(it.g.v.Index(it.i), it.g.opts.nested(it.g.frozen))
 		if err != nil {
 			panic(err)
 		}
@@ -187,6 +233,16 @@ func (it *sliceIterator) Next(p *starlark.Value) bool {
 	return false
 }
 
+// checkResizable reports an error if the length of the slice can't be
+// changed, because it's frozen or an array.  verb+" slice" should describe the
+// operation.
+func (g *GoSlice) checkResizable(verb string) error {
+	if g.v.Kind() == reflect.Array {
+		return fmt.Errorf("cannot %s array", verb)
+	}
+	return g.checkMutable(verb)
+}
+
 // checkMutable reports an error if the slicve should not be mutated.
 // verb+" slice" should describe the operation.
 func (g *GoSlice) checkMutable(verb string) error {
@@ -208,11 +264,14 @@ func list_append(fnname string, g *GoSlice, args starlark.Tuple, kwargs []starla
 	if len(args) != 1 {
 		return nil, fmt.Errorf("append: got %d arguments, want 1", len(args))
 	}
-	if err := g.checkMutable("append to"); err != nil {
+	if err := g.checkResizable("append to"); err != nil {
 		return nil, err
 	}
-	v := conv(args[0], g.v.Type().Elem())
-	g.v = reflect.Append(g.v, v)
+	v, err := tryConv(args[0], g.v.Type().Elem())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
+	g.set(reflect.Append(g.v, v))
 	return starlark.None, nil
 }
 
@@ -229,20 +288,26 @@ func list_extend(fnname string, g *GoSlice, args starlark.Tuple, kwargs []starla
 	if len(args) != 1 {
 		return nil, fmt.Errorf("extend: got %d arguments, want 1", len(args))
 	}
-	if err := g.checkMutable("extend"); err != nil {
+	if err := g.checkResizable("extend"); err != nil {
 		return nil, err
 	}
 	iterable, ok := args[0].(starlark.Iterable)
 	if !ok {
 		return nil, fmt.Errorf("argument is not iterable: %#v", args[0])
 	}
+	// convert everything before appending, so a bad element changes nothing.
+	var vals []reflect.Value
 	var val starlark.Value
 	it := iterable.Iterate()
 	defer it.Done()
 	for it.Next(&val) {
-		v := conv(val, g.v.Type().Elem())
-		g.v = reflect.Append(g.v, v)
+		v, err := tryConv(val, g.v.Type().Elem())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fnname, err)
+		}
+		vals = append(vals, v)
 	}
+	g.set(reflect.Append(g.v, vals...))
 
 	return starlark.None, nil
 }
@@ -262,7 +327,10 @@ func list_index(fnname string, g *GoSlice, args starlark.Tuple, kwargs []starlar
 	case 1:
 		// ok
 	}
-	value := conv(args[0], g.v.Type().Elem())
+	value, err := tryConv(args[0], g.v.Type().Elem())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
 	start, end, err := indices(start_, end_, g.v.Len())
 	if err != nil {
 		return nil, fmt.Errorf("%s: %s", fnname, err)
@@ -281,7 +349,7 @@ func list_insert(fnname string, g *GoSlice, args starlark.Tuple, kwargs []starla
 	if len(args) != 2 {
 		return nil, fmt.Errorf("extend: got %d arguments, want 2", len(args))
 	}
-	if err := g.checkMutable("insert into"); err != nil {
+	if err := g.checkResizable("insert into"); err != nil {
 		return nil, err
 	}
 
@@ -293,14 +361,17 @@ func list_insert(fnname string, g *GoSlice, args starlark.Tuple, kwargs []starla
 		index += g.v.Len()
 	}
 
-	val := conv(args[1], g.v.Type().Elem())
+	val, err := tryConv(args[1], g.v.Type().Elem())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
 	if index >= g.Len() {
-		g.v = reflect.Append(g.v, val)
+		g.set(reflect.Append(g.v, val))
 	} else {
 		if index < 0 {
 			index = 0 // start
 		}
-		g.v = reflect.Append(g.v, reflect.Zero(g.v.Type().Elem()))
+		g.set(reflect.Append(g.v, reflect.Zero(g.v.Type().Elem())))
 		reflect.Copy(g.v.Slice(index+1, g.v.Len()), g.v.Slice(index, g.v.Len())) // slide up one
 		g.v.Index(index).Set(val)
 	}
@@ -312,15 +383,19 @@ func list_remove(fnname string, g *GoSlice, args starlark.Tuple, kwargs []starla
 	if len(args) != 1 {
 		return nil, fmt.Errorf("remove: got %d arguments, want 1", len(args))
 	}
-	if err := g.checkMutable("remove from"); err != nil {
+	if err := g.checkResizable("remove from"); err != nil {
 		return nil, err
 	}
 
-	v := conv(args[0], g.v.Type().Elem()).Interface()
+	val, err := tryConv(args[0], g.v.Type().Elem())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fnname, err)
+	}
+	v := val.Interface()
 	for i := 0; i < g.v.Len(); i++ {
 		elem := g.v.Index(i)
 		if reflect.DeepEqual(elem.Interface(), v) {
-			g.v = reflect.AppendSlice(g.v.Slice(0, i), g.v.Slice(i+1, g.v.Len()))
+			g.set(reflect.AppendSlice(g.v.Slice(0, i), g.v.Slice(i+1, g.v.Len())))
 			return starlark.None, nil
 		}
 	}
@@ -345,15 +420,15 @@ func list_pop(fnname string, g *GoSlice, args starlark.Tuple, kwargs []starlark.
 	if index < 0 || index >= g.v.Len() {
 		return nil, fmt.Errorf("pop: index %d is out of range [0:%d]", index, g.v.Len())
 	}
-	if err := g.checkMutable("pop from"); err != nil {
+	if err := g.checkResizable("pop from"); err != nil {
 		return nil, err
 	}
 	// convert this out before reslicing, otherwise the value changes out from under us.
-	res, err := toValue(g.v.Index(index))
+	res, err := toValue(g.v.Index(index), g.opts.nested(g.frozen))
 	if err != nil {
 		return nil, err
 	}
-	g.v = reflect.AppendSlice(g.v.Slice(0, index), g.v.Slice(index+1, g.v.Len()))
+	g.set(reflect.AppendSlice(g.v.Slice(0, index), g.v.Slice(index+1, g.v.Len())))
 	return res, nil
 }
 
@@ -6,6 +6,7 @@ import (
 
 	"github.com/starlight-go/starlight"
 	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
 )
 
 func TestSliceTruth(t *testing.T) {
@@ -57,8 +58,8 @@ assert.Eq(abc[2], "c")
 		t.Fatal(err)
 	}
 	tests := []fail{
-		{"abc[3]", "starlight_slice<[]string> index 3 out of range [0:3]"},
-		{"abc[-4]", "starlight_slice<[]string> index -1 out of range [0:3]"},
+		{"abc[3]", "go.slice<[]string> index 3 out of range [-3:2]"},
+		{"abc[-4]", "go.slice<[]string> index -4 out of range [-3:2]"},
 	}
 
 	expectFails(t, tests, globals)
@@ -105,7 +106,7 @@ assert.Eq(x3, intSlice([0, 2, 5]))
 	globals["x3"] = v
 
 	tests := []fail{
-		{"x3[3]=4", "starlight_slice<[]int> index 3 out of range [0:3]"},
+		{"x3[3]=4", "go.slice<[]int> index 3 out of range [-3:2]"},
 		{"x3[0]=0", "cannot assign to frozen slice"},
 		{"x3.clear()", "cannot clear frozen slice"},
 	}
@@ -357,3 +358,136 @@ assert.Eq(x4, intSlice([3,4]))
 // 		t.Fatal(err)
 // 	}
 // }
+
+// lazyElem counts its conversions to starlark values.
+type lazyElem int
+
+var lazyConversions int
+
+func (e lazyElem) StarlarkValue() (starlark.Value, error) {
+	lazyConversions++
+	return starlark.MakeInt(int(e)), nil
+}
+
+func TestSliceLazy(t *testing.T) {
+	big := make([]lazyElem, 1000000)
+	big[10] = 10
+	big[999999] = 99
+	lazyConversions = 0
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"big":    convert.NewGoSlice(big),
+	}
+	code := []byte(`
+assert.Eq(len(big), 1000000)
+assert.Eq(big[10], 10)
+assert.Eq(big[-1], 99)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if lazyConversions != 2 {
+		t.Fatalf("expected 2 elements to be converted, got %d", lazyConversions)
+	}
+}
+
+func TestSliceWriteBack(t *testing.T) {
+	type playlist struct {
+		Songs []string
+	}
+	p := &playlist{Songs: []string{"a", "b"}}
+	queue := []int{1}
+	globals := map[string]interface{}{
+		"p":     p,
+		"queue": &queue,
+	}
+	code := []byte(`
+p.Songs.append("c")
+p.Songs.extend(["d", "e"])
+p.Songs.pop(0)
+p.Songs.remove("d")
+p.Songs.insert(0, "z")
+p.Songs[1] = "B"
+queue.append(2)
+queue[0] = 0
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Songs) != "[z B c e]" {
+		t.Errorf("expected [z B c e], got %v", p.Songs)
+	}
+	if fmt.Sprint(queue) != "[0 2]" {
+		t.Errorf("expected [0 2], got %v", queue)
+	}
+}
+
+func TestSliceSteps(t *testing.T) {
+	globals := map[string]interface{}{
+		"assert":   &assert{t: t},
+		"x":        []int{1, 2, 3, 4, 5},
+		"intSlice": intSlice,
+	}
+	code := []byte(`
+assert.Eq(x[::2], intSlice([1, 3, 5]))
+assert.Eq(x[::-1], intSlice([5, 4, 3, 2, 1]))
+assert.Eq(x[3:0:-2], intSlice([4, 2]))
+assert.Eq(type(x[::2]), "go.slice<[]int>")
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSliceArrays(t *testing.T) {
+	arr := [3]int{1, 2, 3}
+	globals := map[string]interface{}{
+		"assert":   &assert{t: t},
+		"arr":      arr,
+		"wrapped":  convert.NewGoSlice(arr),
+		"intSlice": intSlice,
+	}
+	code := []byte(`
+assert.Eq(arr[1:], intSlice([2, 3]))
+assert.Eq(arr[::2], intSlice([1, 3]))
+assert.Eq(wrapped[:2], intSlice([1, 2]))
+assert.Eq(type(arr[1:]), "go.slice<[]int>")
+arr[0] = 10
+assert.Eq(arr[0], 10)
+wrapped[2] = 30
+assert.Eq(wrapped[2], 30)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectFails(t, []fail{
+		{`arr.append(4)`, "cannot append to array"},
+		{`arr.extend([4])`, "cannot extend array"},
+		{`arr.insert(0, 4)`, "cannot insert into array"},
+		{`arr.remove(1)`, "cannot remove from array"},
+		{`arr.pop()`, "cannot pop from array"},
+		{`wrapped.clear()`, "cannot clear array"},
+	}, globals)
+}
+
+func TestSliceWrongElemType(t *testing.T) {
+	globals := map[string]interface{}{
+		"x": []int{1, 2, 3},
+	}
+	expectFails(t, []fail{
+		{`x.append("a")`, "append: expected int, got string"},
+		{`x.extend([4, "a"])`, "extend: expected int, got string"},
+		{`x.index("a")`, "index: expected int, got string"},
+		{`x.insert(0, "a")`, "insert: expected int, got string"},
+		{`x.remove("a")`, "remove: expected int, got string"},
+		{`x[0] = "a"`, "expected int, got string"},
+	}, globals)
+
+	// nothing is appended if an element can't be converted.
+	h := &struct{ Nums []int }{Nums: []int{1, 2, 3}}
+	_, err := starlight.Eval([]byte(`h.Nums.extend([4, "a"])`), map[string]interface{}{"h": h}, nil)
+	expectErr(t, err, "extend: expected int, got string")
+	if len(h.Nums) != 3 {
+		t.Fatalf("expected no elements to be appended, got %v", h.Nums)
+	}
+}
@@ -0,0 +1,266 @@
+package convert
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.starlark.net/starlark"
+)
+
+// NewGoReader wraps r so that scripts can read from it as a stream, e.g. to
+// process a log or an upload without the host buffering it all first.  Data is
+// returned as bytes (use str() to decode it as UTF-8).
+//
+// The wrapped reader has these methods:
+//
+//	read(n=-1)   reads n bytes, or fewer at the end of the stream, and returns
+//	             them.  It returns empty bytes at the end of the stream.  If n
+//	             is negative, it reads the rest of the stream.
+//	read_all()   reads the rest of the stream.
+//	readline()   reads up to and including the next newline, or the rest of
+//	             the stream if there is none.
+//
+// Iterating over the reader yields its lines, with their newlines.  Iteration
+// stops at the first read error, which the next read then returns.
+//
+// Reads can't be interrupted, so a reader that may block should honor the
+// context of the run itself.
+func NewGoReader(r io.Reader) *GoReader {
+	return &GoReader{r: r, buf: bufio.NewReader(r)}
+}
+
+// GoReader is a wrapper around an io.Reader to let scripts read from it.
+type GoReader struct {
+	r   io.Reader
+	buf *bufio.Reader
+	// err is a read error hit while iterating.
+	err error
+}
+
+var readerMethods = []string{"read", "read_all", "readline"}
+
+// Attr returns the reader method with the given name.
+func (g *GoReader) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "read":
+		return starlark.NewBuiltin(name, g.read), nil
+	case "read_all":
+		return starlark.NewBuiltin(name, g.readAll), nil
+	case "readline":
+		return starlark.NewBuiltin(name, g.readline), nil
+	}
+	return nil, nil
+}
+
+// AttrNames returns the names of the reader's methods.
+func (g *GoReader) AttrNames() []string {
+	return append([]string(nil), readerMethods...)
+}
+
+// takeErr returns and clears the error hit while iterating.
+func (g *GoReader) takeErr() error {
+	err := g.err
+	g.err = nil
+	return err
+}
+
+func (g *GoReader) read(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	n := -1
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "n?", &n); err != nil {
+		return nil, err
+	}
+	if err := g.takeErr(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	if n < 0 {
+		return g.readAll(thread, fn, nil, nil)
+	}
+	// the buffer grows as data arrives, so that a large n doesn't allocate
+	// more than the stream holds.
+	var b bytes.Buffer
+	if _, err := io.CopyN(&b, g.buf, int64(n)); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.Bytes(b.Bytes()), nil
+}
+
+func (g *GoReader) readAll(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	if err := g.takeErr(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	b, err := io.ReadAll(g.buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.Bytes(b), nil
+}
+
+func (g *GoReader) readline(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	if err := g.takeErr(); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	line, err := g.buf.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.Bytes(line), nil
+}
+
+// Iterate returns an iterator over the lines of the stream.
+func (g *GoReader) Iterate() starlark.Iterator {
+	return &lineIterator{g: g}
+}
+
+type lineIterator struct {
+	g    *GoReader
+	done bool
+}
+
+func (it *lineIterator) Next(p *starlark.Value) bool {
+	if it.done {
+		return false
+	}
+	line, err := it.g.buf.ReadBytes('\n')
+	if err != nil {
+		it.done = true
+		if err != io.EOF {
+			it.g.err = err
+		}
+		if len(line) == 0 {
+			return false
+		}
+	}
+	*p = starlark.Bytes(line)
+	return true
+}
+
+func (it *lineIterator) Done() {}
+
+// String returns a description of the reader.
+func (g *GoReader) String() string {
+	return fmt.Sprintf("<reader %T>", g.r)
+}
+
+// Type returns a short string describing the value's type.
+func (g *GoReader) Type() string {
+	return fmt.Sprintf("go.reader<%T>", g.r)
+}
+
+// Freeze does nothing, since reading is the only thing scripts can do with a
+// reader.
+func (g *GoReader) Freeze() {}
+
+// Truth returns true.
+func (g *GoReader) Truth() starlark.Bool {
+	return true
+}
+
+// Hash returns an error, since readers are not hashable.
+func (g *GoReader) Hash() (uint32, error) {
+	return 0, errors.New("go.reader is not hashable")
+}
+
+// NewGoWriter wraps w so that scripts can write to it as a stream.
+//
+// The wrapped writer has these methods:
+//
+//	write(data)  writes data, which may be bytes or a string, and returns the
+//	             number of bytes written.
+//	flush()      flushes buffered data, if w has a Flush method.
+func NewGoWriter(w io.Writer) *GoWriter {
+	return &GoWriter{w: w}
+}
+
+// GoWriter is a wrapper around an io.Writer to let scripts write to it.
+type GoWriter struct {
+	w io.Writer
+}
+
+var writerMethods = []string{"flush", "write"}
+
+// Attr returns the writer method with the given name.
+func (g *GoWriter) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "write":
+		return starlark.NewBuiltin(name, g.write), nil
+	case "flush":
+		return starlark.NewBuiltin(name, g.flush), nil
+	}
+	return nil, nil
+}
+
+// AttrNames returns the names of the writer's methods.
+func (g *GoWriter) AttrNames() []string {
+	return append([]string(nil), writerMethods...)
+}
+
+func (g *GoWriter) write(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var data starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &data); err != nil {
+		return nil, err
+	}
+	var s string
+	switch data := data.(type) {
+	case starlark.Bytes:
+		s = string(data)
+	case starlark.String:
+		s = string(data)
+	default:
+		return nil, fmt.Errorf("%s: expected bytes or string, got %s", fn.Name(), data.Type())
+	}
+	n, err := io.WriteString(g.w, s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.MakeInt(n), nil
+}
+
+func (g *GoWriter) flush(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	var err error
+	switch f := g.w.(type) {
+	case interface{ Flush() error }:
+		err = f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.None, nil
+}
+
+// String returns a description of the writer.
+func (g *GoWriter) String() string {
+	return fmt.Sprintf("<writer %T>", g.w)
+}
+
+// Type returns a short string describing the value's type.
+func (g *GoWriter) Type() string {
+	return fmt.Sprintf("go.writer<%T>", g.w)
+}
+
+// Freeze does nothing, since writing is the only thing scripts can do with a
+// writer.
+func (g *GoWriter) Freeze() {}
+
+// Truth returns true.
+func (g *GoWriter) Truth() starlark.Bool {
+	return true
+}
+
+// Hash returns an error, since writers are not hashable.
+func (g *GoWriter) Hash() (uint32, error) {
+	return 0, errors.New("go.writer is not hashable")
+}
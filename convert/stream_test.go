@@ -0,0 +1,87 @@
+package convert_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+)
+
+func TestGoReader(t *testing.T) {
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"r":      convert.NewGoReader(strings.NewReader("first\nsecond\nthird\nfourth\nlast")),
+	}
+	code := []byte(`
+def run():
+    assert.Eq(r.read(3), b"fir")
+    assert.Eq(r.readline(), b"st\n")
+    lines = []
+    for line in r:
+        lines.append(str(line).strip())
+        if len(lines) == 2:
+            break
+    assert.Eq(lines, ["second", "third"])
+    assert.Eq(r.read(7), b"fourth\n")
+    # large sizes only read what the stream holds.
+    assert.Eq(r.read(1 << 40), b"last")
+    assert.Eq(r.read(10), b"")
+    assert.Eq(r.readline(), b"")
+run()
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type failingReader struct{ data io.Reader }
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.data.Read(p)
+	if err == io.EOF {
+		return 0, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestGoReaderError(t *testing.T) {
+	globals := map[string]interface{}{
+		"r": convert.NewGoReader(&failingReader{strings.NewReader("a\nb\n")}),
+	}
+	code := []byte(`
+def run():
+    lines = [line for line in r]
+    if len(lines) != 2:
+        fail(lines)
+    r.read()
+run()
+`)
+	_, err := starlight.Eval(code, globals, nil)
+	expectErr(t, err, "read: connection reset")
+}
+
+func TestGoWriter(t *testing.T) {
+	var sb strings.Builder
+	w := bufio.NewWriter(&sb)
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"w":      convert.NewGoWriter(w),
+	}
+	code := []byte(`
+assert.Eq(w.write("hello "), 6)
+assert.Eq(w.write(b"world"), 5)
+w.flush()
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if sb.String() != "hello world" {
+		t.Fatalf("expected hello world, got %q", sb.String())
+	}
+	_, err := starlight.Eval([]byte(`w.write(1)`), globals, nil)
+	expectErr(t, err, "write: expected bytes or string, got int")
+}
@@ -0,0 +1,31 @@
+package convert_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+type handle uintptr
+
+func (h handle) String() string {
+	return fmt.Sprintf("handle#%d", uintptr(h))
+}
+
+func TestStringers(t *testing.T) {
+	_, err := convert.ToValue(handle(3))
+	expectErr(t, err, "type convert_test.handle is not a supported starlark type")
+
+	v, err := convert.ToValueWithOptions(handle(3), convert.Stringers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != starlark.String("handle#3") {
+		t.Fatalf("expected handle#3, got %v", v)
+	}
+
+	_, err = convert.ToValueWithOptions(uintptr(3), convert.Stringers())
+	expectErr(t, err, "type uintptr is not a supported starlark type")
+}
@@ -1,11 +1,19 @@
 package convert
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash"
+	"hash/fnv"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
 
 	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
 )
 
 // NewStruct makes a new starlark-compatible Struct from the given struct or
@@ -18,76 +26,481 @@ func NewStruct(strct interface{}) *GoStruct {
 	panic(fmt.Errorf("value must be a struct or pointer to a struct, but was %T", val.Interface()))
 }
 
+// NewReadOnlyStruct is like NewStruct, but scripts can't set the struct's
+// fields, or change the maps, slices and structs reached through it, e.g. to
+// share configuration with untrusted scripts.  It's the same as
+// NewStructWithOptions with the ReadOnly option.
+func NewReadOnlyStruct(strct interface{}, opts ...Option) *GoStruct {
+	return NewStructWithOptions(strct, append(opts, ReadOnly())...)
+}
+
 // GoStruct is a wrapper around a Go struct to let it be manipulated by starlark
-// scripts.
+// scripts.  Fields tagged `starlark:"name"` are called name by scripts, and
+// fields tagged `starlark:"-"` are hidden from them, e.g. to keep tokens out of
+// scripts' reach.
+//
+// As in Go, the fields and methods of embedded structs are promoted, so
+// scripts can use s.Inner as well as s.Embedded.Inner.  A field or method hides
+// those of the same name in more deeply embedded structs, and those of the
+// same name at the same depth hide each other, so neither can be used without
+// naming the embedded struct.
+//
+// Scripts can call s.to_dict() to get a dict of the struct's fields, e.g. to
+// serialize it or pass it on as keyword arguments with **.
 type GoStruct struct {
-	v reflect.Value
+	v      reflect.Value
+	opts   *options
+	frozen bool
+
+	// fields caches the wrappers of the struct's fields, so that converting
+	// big nested values is done once, and s.child is s.child.
+	mu     sync.Mutex
+	fields map[string]cachedField
+}
+
+// cachedField is the wrapper of a field, and the field's pointer and length
+// when it was wrapped, to tell if Go code has since replaced its value.
+type cachedField struct {
+	val starlark.Value
+	ptr uintptr
+	len int
 }
 
 // Attr returns a starlark value that wraps the method or field with the given
-// name.
+// name.  Methods with pointer receivers can be called if the struct is held by
+// pointer, or is addressable, such as a field of a struct held by pointer.
 func (g *GoStruct) Attr(name string) (starlark.Value, error) {
-	method := g.v.MethodByName(name)
-	if method.Kind() != reflect.Invalid {
-		return makeStarFn(name, method), nil
+	fnName := name
+	recv := g.receiver()
+	if g.renames() {
+		goName, ok := g.opts.goName(recv.Type(), name)
+		if !ok {
+			return g.extraAttr(fnName)
+		}
+		name = goName
 	}
 	v := g.v
 	if g.v.Kind() == reflect.Ptr {
 		v = v.Elem()
-		method = g.v.MethodByName(name)
-		if method.Kind() != reflect.Invalid {
-			return makeStarFn(name, method), nil
+	}
+	method := recv.MethodByName(name)
+	if method.Kind() != reflect.Invalid {
+		g.opts.checkDeprecated(g.v.Type(), name)
+		fn := makeStarFn(fnName, method, g.opts.nested(g.frozen))
+		if embedded, ok := nilMethodEmbedded(v, name); ok {
+			return guardEmbedded(fn, embedded), nil
 		}
+		return fn, nil
 	}
-	field := v.FieldByName(name)
-	if field.Kind() != reflect.Invalid {
-		return toValue(field)
+	// unexported fields can't be read through reflection, so they're hidden.
+	if f, ok := v.Type().FieldByName(name); ok && f.PkgPath == "" {
+		g.opts.checkDeprecated(g.v.Type(), name)
+		// fields promoted through nil embedded pointers are None, like nil
+		// pointer fields.
+		if embedded, ok := nilEmbedded(v, f.Index); ok {
+			if g.opts.isStrictNil() {
+				return nil, fmt.Errorf("can't get %s: embedded %s is nil", fnName, embedded)
+			}
+			return starlark.None, nil
+		}
+		return g.field(f, v.FieldByIndex(f.Index))
 	}
-	return nil, nil
+	return g.extraAttr(fnName)
 }
 
-// AttrNames returns the list of all fields and methods on this struct.
-func (g *GoStruct) AttrNames() []string {
-	count := g.v.NumMethod()
-	if g.v.Kind() == reflect.Ptr {
-		elem := g.v.Elem()
-		count += elem.NumField() + elem.NumMethod()
-	} else {
-		count += g.v.NumField()
+// extraAttr returns the attribute with the given name that isn't a field or
+// method: a getter's value (see the Getters option) or a builtin method.
+func (g *GoStruct) extraAttr(name string) (starlark.Value, error) {
+	if getter, ok := g.getter(name); ok {
+		return makeOut(getter.Call(nil), g.opts.nested(g.frozen))
 	}
-	names := make([]string, 0, count)
-	for i := 0; i < g.v.NumMethod(); i++ {
-		names = append(names, g.v.Type().Method(i).Name)
+	if v := g.builtinAttr(name); v != nil {
+		return v, nil
 	}
-	if g.v.Kind() == reflect.Ptr {
-		t := g.v.Elem().Type()
-		for i := 0; i < t.NumField(); i++ {
-			names = append(names, t.Field(i).Name)
+	return nil, starlark.NoSuchAttrError(fmt.Sprintf("%s has no .%s field or method; it has %s", g.Type(), name, listNames(name, g.AttrNames())))
+}
+
+// maxListedNames is how many names listNames lists before it sums up the rest.
+const maxListedNames = 20
+
+// listNames lists names for error messages, so that script authors can see
+// which they could have meant instead of name.  If there are too many to list,
+// the ones closest to name are listed first, so that a close match is never
+// left out.  Case and underscores are ignored when comparing names.  Scripts
+// also get a "did you mean" hint for the closest match from the interpreter.
+func listNames(name string, names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	if len(names) > maxListedNames {
+		names = append([]string(nil), names...)
+		dist := make(map[string]int, len(names))
+		for _, n := range names {
+			dist[n] = editDistance(foldName(name), foldName(n))
 		}
-		for i := 0; i < t.NumMethod(); i++ {
-			names = append(names, t.Method(i).Name)
+		sort.SliceStable(names, func(i, j int) bool { return dist[names[i]] < dist[names[j]] })
+		return fmt.Sprintf("%s and %d more", strings.Join(names[:maxListedNames], ", "), len(names)-maxListedNames)
+	}
+	return strings.Join(names, ", ")
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
 		}
-	} else {
-		for i := 0; i < g.v.NumField(); i++ {
-			names = append(names, g.v.Type().Field(i).Name)
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// getter returns the GetX or IsX method that scripts call name, if the struct
+// was converted with the Getters option.
+func (g *GoStruct) getter(name string) (reflect.Value, bool) {
+	if !g.opts.getters() {
+		return reflect.Value{}, false
+	}
+	recv := g.receiver()
+	for i := 0; i < recv.NumMethod(); i++ {
+		if n, ok := g.getterName(recv.Type().Method(i)); ok && n == name {
+			return recv.Method(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// getterName returns the name scripts use for the value of the method m, if
+// it's a getter: a method named GetX or IsX that takes no arguments and
+// returns a value, and optionally an error.
+func (g *GoStruct) getterName(m reflect.Method) (string, bool) {
+	var rest string
+	switch {
+	case strings.HasPrefix(m.Name, "Get"):
+		rest = m.Name[len("Get"):]
+	case strings.HasPrefix(m.Name, "Is"):
+		rest = m.Name[len("Is"):]
+	default:
+		return "", false
+	}
+	if rest == "" || !unicode.IsUpper([]rune(rest)[0]) {
+		return "", false
+	}
+	// the method's type includes the receiver.
+	t := m.Type
+	if t.NumIn() != 1 || t.NumOut() == 0 || t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != errType) {
+		return "", false
+	}
+	return g.opts.methodName(rest), true
+}
+
+// field returns the value of the field f, whose value is v.  Fields that are
+// wrapped, rather than copied, are cached until they're set.
+func (g *GoStruct) field(f reflect.StructField, v reflect.Value) (starlark.Value, error) {
+	ptr, n, ok := fieldIdentity(v)
+	if !ok {
+		return fieldValue(f, v, g.opts.nested(g.frozen))
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.fields[f.Name]; ok && c.ptr == ptr && c.len == n {
+		return c.val, nil
+	}
+	val, err := fieldValue(f, v, g.opts.nested(g.frozen))
+	if err != nil {
+		return nil, err
+	}
+	switch val.(type) {
+	case *GoStruct, *GoCollection, *GoIterableStruct, *GoMap, *GoSlice:
+		if g.fields == nil {
+			g.fields = map[string]cachedField{}
+		}
+		g.fields[f.Name] = cachedField{val: val, ptr: ptr, len: n}
+	}
+	return val, nil
+}
+
+// fieldIdentity returns what a wrapper of the field v depends on: the field's
+// address for struct and array fields, which are wrapped in place, and the
+// pointer and length for the others that are wrapped.  It returns false for
+// fields that aren't wrapped.
+func fieldIdentity(v reflect.Value) (uintptr, int, bool) {
+	switch v.Kind() {
+	case reflect.Struct, reflect.Array:
+		if !v.CanAddr() {
+			return 0, 0, false
+		}
+		return v.UnsafeAddr(), 0, true
+	case reflect.Ptr, reflect.Map:
+		if v.IsNil() {
+			return 0, 0, false
+		}
+		return v.Pointer(), 0, true
+	case reflect.Slice:
+		if v.IsNil() {
+			return 0, 0, false
+		}
+		return v.Pointer(), v.Len(), true
+	}
+	return 0, 0, false
+}
+
+// builtinAttr returns the builtin method of the struct with the given name, or
+// nil if there isn't one.  The struct's own fields and methods take
+// precedence.
+func (g *GoStruct) builtinAttr(name string) starlark.Value {
+	if name != "to_dict" {
+		return nil
+	}
+	return starlark.NewBuiltin(name, g.toDict).BindReceiver(g)
+}
+
+// withExtras adds the names of the struct's getters (see the Getters option)
+// and builtin methods to the names of its fields and methods, unless they're
+// hidden by them.
+func (g *GoStruct) withExtras(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	for _, n := range names {
+		seen[n] = true
+	}
+	var extras []string
+	if g.opts.getters() {
+		recv := g.receiver().Type()
+		for i := 0; i < recv.NumMethod(); i++ {
+			if n, ok := g.getterName(recv.Method(i)); ok {
+				extras = append(extras, n)
+			}
+		}
+	}
+	for _, n := range append(extras, "to_dict") {
+		if !seen[n] {
+			seen[n] = true
+			names = append(names, n)
 		}
 	}
 	return names
 }
 
+// toDict implements to_dict(omit_empty=False), which returns a dict of the
+// struct's exported fields, with nested structs converted to dicts too, as by
+// StructsAsDicts.  Zero fields are left out if omit_empty is true, as by
+// OmitEmpty.  The dict is a copy, so scripts can change it freely.
+func (g *GoStruct) toDict(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var omitEmpty bool
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "omit_empty?", &omitEmpty); err != nil {
+		return nil, err
+	}
+	o := options{}
+	if g.opts != nil {
+		o = *g.opts
+	}
+	o.dicts, o.structs, o.frozen = true, false, false
+	o.omitZero = o.omitZero || omitEmpty
+	return structDict(g.v, &o)
+}
+
+// exportedFields returns the exported fields of the struct t, including those
+// promoted from embedded structs.  As in Go, a field hides the fields of the
+// same name in structs embedded more deeply, and fields of the same name at the
+// same depth hide each other.
+func exportedFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for _, f := range reflect.VisibleFields(t) {
+		if f.PkgPath == "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// nilEmbedded returns the name of the nil embedded pointer that the field of
+// the struct v with the given index is promoted through, if there is one.
+func nilEmbedded(v reflect.Value, index []int) (string, bool) {
+	for _, i := range index[:len(index)-1] {
+		name := v.Type().Field(i).Name
+		v = v.Field(i)
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return name, true
+			}
+			v = v.Elem()
+		}
+	}
+	return "", false
+}
+
+// nilMethodEmbedded returns the name of a nil embedded pointer of the struct v
+// that has the method with the given name, which may be promoted through it.
+func nilMethodEmbedded(v reflect.Value, name string) (string, bool) {
+	for _, f := range reflect.VisibleFields(v.Type()) {
+		if !f.Anonymous || f.Type.Kind() != reflect.Ptr {
+			continue
+		}
+		if _, ok := f.Type.MethodByName(name); !ok {
+			continue
+		}
+		if embedded, ok := nilEmbedded(v, f.Index); ok {
+			return embedded, true
+		}
+		if v.FieldByIndex(f.Index).IsNil() {
+			return f.Name, true
+		}
+	}
+	return "", false
+}
+
+// guardEmbedded returns fn, but with the panic of calling a method promoted
+// through the nil embedded pointer named embedded reported as such.  The
+// struct may have a method of its own of the same name, which works as usual.
+func guardEmbedded(fn *starlark.Builtin, embedded string) *starlark.Builtin {
+	return starlark.NewBuiltin(fn.Name(), func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		v, err := fn.CallInternal(thread, args, kwargs)
+		var pe *PanicError
+		if errors.As(err, &pe) {
+			return nil, fmt.Errorf("can't call %s: embedded %s is nil", fn.Name(), embedded)
+		}
+		return v, err
+	})
+}
+
+// receiver returns the value whose methods scripts can call, which is a
+// pointer to the struct if it's addressable, so that methods with pointer
+// receivers are included.
+func (g *GoStruct) receiver() reflect.Value {
+	if g.v.Kind() != reflect.Ptr && g.v.CanAddr() {
+		return g.v.Addr()
+	}
+	return g.v
+}
+
+// AttrNames returns the list of all exported fields and methods on this
+// struct, and the to_dict builtin method.
+func (g *GoStruct) AttrNames() []string {
+	if g.renames() {
+		return g.scriptNames()
+	}
+	recv := g.receiver().Type()
+	t := g.v.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	fields := exportedFields(t)
+	names := make([]string, 0, recv.NumMethod()+len(fields))
+	for i := 0; i < recv.NumMethod(); i++ {
+		names = append(names, recv.Method(i).Name)
+	}
+	for _, f := range fields {
+		names = append(names, f.Name)
+	}
+	return g.withExtras(names)
+}
+
+// renames reports whether scripts use different names than Go for the
+// struct's fields or methods.
+func (g *GoStruct) renames() bool {
+	return g.opts.renames() || hasNameTags(g.v.Type())
+}
+
+// scriptNames returns the names scripts use for the struct's fields and
+// methods.
+func (g *GoStruct) scriptNames() []string {
+	var names []string
+	t := g.receiver().Type()
+	for i := 0; i < t.NumMethod(); i++ {
+		names = append(names, g.opts.methodName(t.Method(i).Name))
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for _, f := range exportedFields(t) {
+		if name, ok := g.opts.fieldName(f); ok {
+			names = append(names, name)
+		}
+	}
+	return g.withExtras(names)
+}
+
 // SetField sets the struct field with the given name with the given value.
 func (g *GoStruct) SetField(name string, val starlark.Value) error {
+	if g.frozen {
+		return fmt.Errorf("cannot set field of frozen struct")
+	}
+	goName := name
+	if g.renames() {
+		var ok bool
+		if goName, ok = g.opts.goName(g.v.Type(), name); !ok {
+			return g.noSuchField(name)
+		}
+	}
 	v := g.v
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
-	field := v.FieldByName(name)
-	if field.CanSet() {
-		val := conv(val, field.Type())
-		field.Set(val)
-		return nil
+	f, ok := v.Type().FieldByName(goName)
+	if !ok {
+		return g.noSuchField(name)
+	}
+	if f.PkgPath != "" {
+		return fmt.Errorf("%s is an unexported field", name)
+	}
+	if embedded, ok := nilEmbedded(v, f.Index); ok {
+		return fmt.Errorf("can't set %s: embedded %s is nil", name, embedded)
 	}
-	return fmt.Errorf("%s is not a settable field", name)
+	field := v.FieldByIndex(f.Index)
+	if !field.CanSet() {
+		return fmt.Errorf("%s is not a settable field", name)
+	}
+	out, ok, err := goValue(val, field.Type())
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	if !ok {
+		return fmt.Errorf("%s: expected %v, got %s", name, field.Type(), val.Type())
+	}
+	if err := g.opts.validate(v.Type(), f.Name, field.Interface(), out.Interface()); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	field.Set(out)
+	g.mu.Lock()
+	delete(g.fields, f.Name)
+	g.mu.Unlock()
+	return nil
+}
+
+// noSuchField returns the error for setting a field the struct doesn't have,
+// which lists the fields it has.
+func (g *GoStruct) noSuchField(name string) error {
+	t := g.v.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var names []string
+	for _, f := range exportedFields(t) {
+		if n, ok := g.opts.fieldName(f); ok {
+			names = append(names, n)
+		}
+	}
+	return starlark.NoSuchAttrError(fmt.Sprintf("%s has no .%s field; its fields are %s", g.Type(), name, listNames(name, names)))
 }
 
 // String returns the string representation of the value.
@@ -96,9 +509,10 @@ func (g *GoStruct) String() string {
 	return fmt.Sprint(g.v.Interface())
 }
 
-// Type returns a short string describing the value's type.
+// Type returns a short string describing the value's type, such as
+// go.struct<*pkg.User>, which scripts see in type(x) and error messages.
 func (g *GoStruct) Type() string {
-	return fmt.Sprintf("starlight_struct<%T>", g.v.Interface())
+	return fmt.Sprintf("go.struct<%T>", g.v.Interface())
 }
 
 // Freeze causes the value, and all values transitively
@@ -106,8 +520,16 @@ func (g *GoStruct) Type() string {
 // marked as frozen.  All subsequent mutations to the data
 // structure through this API will fail dynamically, making the
 // data structure immutable and safe for publishing to other
-// Starlark interpreters running concurrently.
-func (g *GoStruct) Freeze() {}
+// Starlark interpreters running concurrently.  Fields, and the values methods
+// return, are frozen too, though methods can still change the struct.
+func (g *GoStruct) Freeze() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.frozen = true
+	for _, c := range g.fields {
+		c.val.Freeze()
+	}
+}
 
 // Truth returns the truth value of an object.
 func (g *GoStruct) Truth() starlark.Bool {
@@ -115,8 +537,111 @@ func (g *GoStruct) Truth() starlark.Bool {
 }
 
 // Hash returns a function of x such that Equals(x, y) => Hash(x) == Hash(y).
-// Hash may fail if the value's type is not hashable, or if the value
-// contains a non-hashable value.
+// Structs held by pointer are hashable only if they're compared with
+// CompareIdentity, and are hashed by their pointer, since their methods can
+// change them even when they're frozen.  Other structs whose type is
+// comparable are hashable if scripts can't change them, because they're held
+// by value or frozen without pointer methods, so they can be dict keys and set
+// members, and are hashed by their field values.  Other structs are not
+// hashable.
 func (g *GoStruct) Hash() (uint32, error) {
-	return 0, errors.New("starlight_struct is not hashable")
+	h := fnv.New32a()
+	if g.v.Kind() == reflect.Ptr {
+		if !g.opts.identity() {
+			return 0, errors.New("go.struct is not hashable")
+		}
+		binary.Write(h, binary.LittleEndian, uint64(g.v.Pointer()))
+		return h.Sum32(), nil
+	}
+	mutable := g.v.CanSet() && (!g.frozen || g.receiver().NumMethod() > g.v.NumMethod())
+	if mutable || !g.v.Type().Comparable() {
+		return 0, errors.New("go.struct is not hashable")
+	}
+	hashValue(h, g.v)
+	return h.Sum32(), nil
+}
+
+// hashValue writes the parts of the comparable value v that == compares to h.
+func hashValue(h hash.Hash32, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			hashValue(h, v.Field(i))
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			hashValue(h, v.Index(i))
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			hashValue(h, v.Elem())
+		}
+	case reflect.Bool:
+		if v.Bool() {
+			h.Write([]byte{1})
+		} else {
+			h.Write([]byte{0})
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		binary.Write(h, binary.LittleEndian, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		binary.Write(h, binary.LittleEndian, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f == 0 {
+			f = 0 // -0 == 0
+		}
+		binary.Write(h, binary.LittleEndian, f)
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		binary.Write(h, binary.LittleEndian, [2]float64{real(c) + 0, imag(c) + 0})
+	case reflect.String:
+		h.Write([]byte(v.String()))
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		binary.Write(h, binary.LittleEndian, uint64(v.Pointer()))
+	}
+}
+
+// CompareSameType compares the Go values of two structs, with == if their type
+// is comparable, and otherwise with reflect.DeepEqual, so that scripts can
+// check a result against an expected value.  Structs of different Go types,
+// such as a struct and a pointer to one, are never equal.  Structs held by
+// pointer are
+// compared by the structs they point to, unless they were converted with the
+// CompareIdentity option.  Only == and != are supported.
+func (g *GoStruct) CompareSameType(op syntax.Token, y starlark.Value, depth int) (_ bool, err error) {
+	other := y.(*GoStruct)
+	if op != syntax.EQL && op != syntax.NEQ {
+		return false, fmt.Errorf("%s %s %s not implemented", g.Type(), op, y.Type())
+	}
+	if g.opts.identity() || other.opts.identity() {
+		return (op == syntax.NEQ) != g.sameStruct(other), nil
+	}
+	if g.v.Type() != other.v.Type() {
+		return op == syntax.NEQ, nil
+	}
+	a, b := reflect.Indirect(g.v), reflect.Indirect(other.v)
+	if !a.Type().Comparable() {
+		eq := reflect.DeepEqual(a.Interface(), b.Interface())
+		return eq == (op == syntax.EQL), nil
+	}
+	// interface fields holding uncomparable values make == panic.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	eq := a.Interface() == b.Interface()
+	return eq == (op == syntax.EQL), nil
+}
+
+// sameStruct reports whether g and other wrap the same Go struct.
+func (g *GoStruct) sameStruct(other *GoStruct) bool {
+	if g == other {
+		return true
+	}
+	if g.v.Kind() == reflect.Ptr && other.v.Kind() == reflect.Ptr {
+		return g.v.Type() == other.v.Type() && g.v.Pointer() == other.v.Pointer()
+	}
+	return false
 }
@@ -9,6 +9,9 @@ import (
 	"time"
 
 	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+	startime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
 )
 
 type mega struct {
@@ -47,6 +50,7 @@ func TestStructs(t *testing.T) {
 		"assert":     &assert{t: t},
 		"bytesEqual": bytes.Equal,
 		"readAll":    ioutil.ReadAll,
+		"time":       startime.Module,
 	}
 
 	code := []byte(`
@@ -54,8 +58,10 @@ assert.Eq(m.Bool, True)
 assert.Eq(m.Int, 1)
 assert.Eq(m.Int64, 2)
 assert.Eq(m.Map["foo"], "bar")
-assert.Eq(m.Time.Year(), m.Now().Year())
-assert.Eq(m.GetTime().Year(), m.Now().Year())
+assert.Eq(m.Time.year, m.Now().year)
+assert.Eq(m.GetTime().year, m.Now().year)
+assert.Eq(m.Time, m.GetTime())
+assert.Eq(m.Time + time.parse_duration("1h") > m.Time, True)
 assert.Eq(True, bytesEqual(readAll(m.Body), m.Bytes))
 `)
 
@@ -73,5 +79,545 @@ a = m.getBool()
 		"m": &mega{},
 	}
 	_, err := starlight.Eval(code, globals, nil)
-	expectErr(t, err, "starlight_struct<*convert_test.mega> has no .getBool field or method")
+	expectErr(t, err, "go.struct<*convert_test.mega> has no .getBool field or method; it has GetTime, Bool, Int, Int64, Body, String, Map, Time, Now, Bytes, to_dict (did you mean .Bool?)")
+}
+
+type point struct {
+	X, Y int
+}
+
+func TestStructKeyedMap(t *testing.T) {
+	grid := map[point]string{{1, 2}: "a", {3, 4}: "b"}
+	d, err := convert.MakeDict(grid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"d":      d,
+		"grid":   grid,
+		"p":      point{1, 2},
+		"q":      point{1, 2},
+		"pp":     &point{1, 2},
+	}
+	code := []byte(`
+assert.Eq(d[p], "a")
+assert.Eq(grid[p], "a")
+assert.Eq(p, q)
+def check():
+    seen = {p: 1}
+    seen[q] = 2
+    assert.Eq(len(seen), 1)
+    for k in d:
+        assert.Eq(d[k], grid[k])
+    for k in grid:
+        assert.Eq(grid[k], d[k])
+check()
+assert.Eq(p == pp, False)
+assert.Eq(pp == pp, True)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	back := convert.FromDict(d.(*starlark.Dict))
+	if len(back) != 2 {
+		t.Fatalf("expected 2 keys, got %v", back)
+	}
+	if v, ok := back[point{3, 4}]; !ok || v != starlark.String("b") {
+		t.Fatalf("expected b, got %v", back)
+	}
+
+	_, err = starlight.Eval([]byte(`x = {pp: 1}`), globals, nil)
+	expectErr(t, err, "go.struct is not hashable")
+}
+
+func TestStructFreeze(t *testing.T) {
+	orig := &shared{Name: "a", Tags: []string{"x"}, Attrs: map[string]int{"n": 1}}
+	orig.Next = &shared{Name: "b"}
+	v, err := convert.ToValue(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Freeze()
+	list, err := convert.ToValue([]*shared{orig.Next})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list.Freeze()
+
+	globals := map[string]interface{}{"s": v, "list": list}
+	tests := []fail{
+		{`s.Name = "b"`, "cannot set field of frozen struct"},
+		{`s.Tags[0] = "y"`, "cannot assign to frozen slice"},
+		{`s.Tags.append("y")`, "cannot append to frozen slice"},
+		{`s.Attrs["n"] = 3`, "cannot insert into frozen map"},
+		{`s.Next.Name = "c"`, "cannot set field of frozen struct"},
+		{`list[:][0].Name = "c"`, "cannot set field of frozen struct"},
+	}
+	expectFails(t, tests, globals)
+	if orig.Name != "a" || orig.Tags[0] != "x" || orig.Attrs["n"] != 1 || orig.Next.Name != "b" {
+		t.Fatalf("frozen struct was changed: %#v", orig)
+	}
+}
+
+type settings struct {
+	Name    string
+	Retries int8
+	Ratio   float64
+	Port    uint16
+	secret  string
+}
+
+func TestStructSetFieldConversion(t *testing.T) {
+	s := &settings{}
+	_, err := starlight.Eval([]byte(`
+s.Name = "db"
+s.Retries = 3
+s.Ratio = 2
+s.Port = 8080
+`), map[string]interface{}{"s": s}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (settings{Name: "db", Retries: 3, Ratio: 2, Port: 8080}); *s != want {
+		t.Fatalf("expected %+v, got %+v", want, *s)
+	}
+
+	globals := map[string]interface{}{"s": s}
+	tests := []fail{
+		{`s.Name = 65`, "Name: expected string, got int"},
+		{`s.Retries = 1000`, "Retries: expected int8, got int"},
+		{`s.Retries = 1.5`, "Retries: expected int8, got float"},
+		{`s.Port = -1`, "Port: expected uint16, got int"},
+		{`s.secret = "x"`, "secret is an unexported field"},
+		{`s.Missing = 1`, "go.struct<*convert_test.settings> has no .Missing field; its fields are Name, Retries, Ratio, Port"},
+	}
+	expectFails(t, tests, globals)
+	if s.Name != "db" || s.Retries != 3 || s.Port != 8080 {
+		t.Fatalf("failed assignments changed the struct: %+v", *s)
+	}
+}
+
+type apiClient struct {
+	BaseURL string `starlark:"base_url"`
+	Token   string `starlark:"-"`
+	Retries int
+}
+
+func TestStructTagNames(t *testing.T) {
+	c := &apiClient{BaseURL: "https://example.com", Token: "s3cret"}
+	s := convert.NewStruct(c)
+	names := s.AttrNames()
+	if strings.Join(names, ",") != "base_url,Retries,to_dict" {
+		t.Fatalf("unexpected attr names %q", names)
+	}
+	globals := map[string]interface{}{"c": c}
+	_, err := starlight.Eval([]byte(`
+c.base_url = "https://example.org"
+c.Retries = 2
+`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.BaseURL != "https://example.org" || c.Retries != 2 {
+		t.Fatalf("unexpected %+v", c)
+	}
+	tests := []fail{
+		{`c.Token`, "go.struct<*convert_test.apiClient> has no .Token field or method; it has base_url, Retries, to_dict"},
+		{`c.BaseURL`, "go.struct<*convert_test.apiClient> has no .BaseURL field or method; it has base_url, Retries, to_dict (did you mean .base_url?)"},
+		{`c.Token = "x"`, "go.struct<*convert_test.apiClient> has no .Token field; its fields are base_url, Retries"},
+	}
+	expectFails(t, tests, globals)
+}
+
+type session struct {
+	User  string
+	token string
+	cache map[string]int
+}
+
+func TestStructUnexportedFields(t *testing.T) {
+	s := &session{User: "bob", token: "s3cret", cache: map[string]int{}}
+	names := convert.NewStruct(s).AttrNames()
+	if strings.Join(names, ",") != "User,to_dict" {
+		t.Fatalf("unexpected attr names %q", names)
+	}
+	globals := map[string]interface{}{"s": s}
+	tests := []fail{
+		{`s.token`, "go.struct<*convert_test.session> has no .token field or method; it has User, to_dict"},
+		{`s.cache`, "go.struct<*convert_test.session> has no .cache field or method; it has User, to_dict"},
+	}
+	expectFails(t, tests, globals)
+
+	v, err := convert.ToValueWithOptions(s, convert.StructsAsDicts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != `{"User": "bob"}` {
+		t.Fatalf("unexpected dict %s", v)
+	}
+}
+
+type hitCount struct {
+	N int
+}
+
+func (c hitCount) Value() int { return c.N }
+func (c *hitCount) Incr()     { c.N++ }
+
+type gauge struct {
+	Hits hitCount
+}
+
+func TestStructMethods(t *testing.T) {
+	g := &gauge{}
+	names := convert.NewStruct(g).AttrNames()
+	if strings.Join(names, ",") != "Hits,to_dict" {
+		t.Fatalf("unexpected attr names %q", names)
+	}
+	names = convert.NewStruct(&g.Hits).AttrNames()
+	if strings.Join(names, ",") != "Incr,Value,N,to_dict" {
+		t.Fatalf("unexpected attr names %q", names)
+	}
+	out, err := starlight.Eval([]byte(`
+g.Hits.Incr()
+g.Hits.Incr()
+n = g.Hits.Value()
+`), map[string]interface{}{"g": g}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Hits.N != 2 || out["n"] != int64(2) {
+		t.Fatalf("expected 2 hits, got %d and %v", g.Hits.N, out["n"])
+	}
+
+	// a copy isn't addressable, so only value methods can be called.
+	globals := map[string]interface{}{"c": hitCount{N: 1}}
+	tests := []fail{
+		{`c.Incr()`, "go.struct<convert_test.hitCount> has no .Incr field or method; it has Value, N, to_dict"},
+	}
+	expectFails(t, tests, globals)
+}
+
+type audit struct {
+	Created string
+	Updated string
+}
+
+func (a *audit) Touch(when string) { a.Updated = when }
+
+type meta struct {
+	Created string
+	Owner   string
+}
+
+type document struct {
+	*audit
+	meta
+	Title   string
+	Created int
+}
+
+func TestStructEmbeddedFields(t *testing.T) {
+	d := &document{audit: &audit{Created: "then"}, meta: meta{Owner: "bob"}, Title: "doc", Created: 1}
+	names := convert.NewStruct(d).AttrNames()
+	if strings.Join(names, ",") != "Touch,Updated,Owner,Title,Created,to_dict" {
+		t.Fatalf("unexpected attr names %q", names)
+	}
+	out, err := starlight.Eval([]byte(`
+d.Touch("now")
+updated = d.Updated
+owner = d.Owner
+created = d.Created
+d.Owner = "mary"
+`), map[string]interface{}{"d": d}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["updated"] != "now" || out["owner"] != "bob" || out["created"] != int64(1) || d.Owner != "mary" {
+		t.Fatalf("unexpected results %v, %+v", out, d)
+	}
+
+	globals := map[string]interface{}{"d": &document{}}
+	tests := []fail{
+		{`d.Updated = "x"`, "can't set Updated: embedded audit is nil"},
+		{`d.Touch("now")`, "can't call Touch: embedded audit is nil"},
+	}
+	expectFails(t, tests, globals)
+}
+
+func TestReadOnlyStruct(t *testing.T) {
+	cfg := &shared{Name: "a", Tags: []string{"x"}, Attrs: map[string]int{"n": 1}}
+	cfg.Next = &shared{Name: "b"}
+	globals := map[string]interface{}{
+		"cfg":    convert.NewReadOnlyStruct(cfg),
+		"assert": &assert{t: t},
+	}
+	_, err := starlight.Eval([]byte(`
+assert.Eq(cfg.Name, "a")
+assert.Eq(cfg.Tags[0], "x")
+assert.Eq(cfg.Attrs["n"], 1)
+assert.Eq(cfg.Next.Name, "b")
+`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []fail{
+		{`cfg.Name = "b"`, "cannot set field of frozen struct"},
+		{`cfg.Tags.append("y")`, "cannot append to frozen slice"},
+		{`cfg.Attrs["n"] = 2`, "cannot insert into frozen map"},
+		{`cfg.Next.Name = "c"`, "cannot set field of frozen struct"},
+	}
+	expectFails(t, tests, globals)
+
+	v, err := convert.ToValueWithOptions(cfg, convert.ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.(*convert.GoStruct).SetField("Name", starlark.String("b")); err == nil {
+		t.Fatal("expected an error setting a field of a read-only struct")
+	}
+}
+
+type outcome struct {
+	Name  string
+	Tags  []string
+	Score float64
+}
+
+func TestStructEquality(t *testing.T) {
+	a := &outcome{Name: "a", Tags: []string{"x"}, Score: 1}
+	b := &outcome{Name: "a", Tags: []string{"x"}, Score: 1}
+	c := &outcome{Name: "a", Tags: []string{"y"}, Score: 1}
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"a":      a, "b": b, "c": c,
+		"p": &point{1, 2}, "q": &point{1, 2},
+	}
+	code := []byte(`
+assert.Eq(a == b, True)
+assert.Eq(a != c, True)
+assert.Eq(p == q, True)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	dict, err := convert.MakeStringDictWithOptions(map[string]interface{}{"a": a, "b": b}, convert.CompareIdentity())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		x, y string
+		want bool
+	}{{"a", "b", false}, {"a", "a", true}} {
+		eq, err := starlark.Equal(dict[test.x], dict[test.y])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if eq != test.want {
+			t.Errorf("%s == %s: expected %v, got %v", test.x, test.y, test.want, eq)
+		}
+	}
+}
+
+func TestFrozenStructHash(t *testing.T) {
+	// methods can change structs held by pointer even when they're frozen, so
+	// they're only hashable by identity.
+	p := &point{1, 2}
+	pv, err := convert.ToValueWithOptions(p, convert.ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pv.Hash(); err == nil {
+		t.Fatal("expected a frozen pointer struct to be unhashable")
+	}
+	pi, err := convert.ToValueWithOptions(p, convert.CompareIdentity())
+	if err != nil {
+		t.Fatal(err)
+	}
+	qi, err := convert.ToValueWithOptions(&point{1, 2}, convert.CompareIdentity())
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := starlark.NewSet(2)
+	for _, v := range []starlark.Value{pi, pi, qi} {
+		if err := set.Insert(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if set.Len() != 2 {
+		t.Fatalf("expected distinct pointers to be distinct set members, got %v", set)
+	}
+	p.X = 5
+	if ok, err := set.Has(pi); err != nil || !ok {
+		t.Fatalf("expected the pointer to stay in the set after it changed, got %v %v", ok, err)
+	}
+
+	// frozen structs held in place are hashable by value, unless their
+	// pointer methods could change them.
+	type twoPoints struct{ A, B point }
+	frozen, err := convert.ToValueWithOptions(&twoPoints{point{1, 2}, point{1, 2}}, convert.ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := frozen.(starlark.HasAttrs).Attr("A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := frozen.(starlark.HasAttrs).Attr("B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ha, errA := a.Hash()
+	hb, errB := b.Hash()
+	if errA != nil || errB != nil || ha != hb {
+		t.Fatalf("expected equal frozen fields to hash the same, got %v %v %v %v", ha, errA, hb, errB)
+	}
+	ptrMethods, err := convert.ToValueWithOptions(&gauge{}, convert.ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ptrMethods.(starlark.HasAttrs).Attr("Hits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Hash(); err == nil {
+		t.Fatal("expected a frozen struct with pointer methods to be unhashable")
+	}
+}
+
+func TestStructToDict(t *testing.T) {
+	o := &order{ID: 7, Customer: userRecord{UserID: 1}, Items: []orderItem{{SKU: "a1", Qty: 2}}}
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"o":      o,
+		"kw":     func(opts *fetchOptions) int { return opts.Timeout },
+		"f":      &fetchOptions{Timeout: 3},
+	}
+	code := []byte(`
+d = o.to_dict()
+assert.Eq(sorted(d.keys()), ["Customer", "ID", "Items", "Note"])
+assert.Eq(type(d["Customer"]), "dict")
+assert.Eq(d["Customer"]["UserID"], 1)
+d["ID"] = 8
+assert.Eq(kw(**f.to_dict()), 3)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if o.ID != 7 {
+		t.Fatalf("expected to_dict to return a copy, but ID changed to %d", o.ID)
+	}
+}
+
+type ring struct {
+	items []string
+}
+
+func (r *ring) Len() int        { return len(r.items) }
+func (r *ring) At(i int) string { return r.items[i] }
+func (r *ring) Push(s string)   { r.items = append(r.items, s) }
+
+type lines struct {
+	text string
+}
+
+func (l lines) All() func(yield func(string) bool) {
+	return func(yield func(string) bool) {
+		for _, s := range strings.Split(l.text, "\n") {
+			if !yield(s) {
+				return
+			}
+		}
+	}
+}
+
+type tagList []string
+
+func (t tagList) String() string { return strings.Join(t, ",") }
+
+func TestStructCollections(t *testing.T) {
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"r":      &ring{items: []string{"a", "b"}},
+		"l":      lines{text: "x\ny"},
+		"tags":   tagList{"p", "q", "r"},
+	}
+	code := []byte(`
+r.Push("c")
+assert.Eq(len(r), 3)
+assert.Eq(r[1], "b")
+assert.Eq([x for x in r], ["a", "b", "c"])
+assert.Eq(list(l), ["x", "y"])
+assert.Eq(len(tags), 3)
+assert.Eq([t for t in tags], ["p", "q", "r"])
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStructFieldCache(t *testing.T) {
+	g := &gauge{}
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"g":      g,
+		"o":      &order{Items: []orderItem{{SKU: "a"}}},
+	}
+	code := []byte(`
+h = g.Hits
+h.Incr()
+assert.Eq(g.Hits.N, 1)
+assert.Eq(o.Items[0].SKU, "a")
+o.Items = [o.Items[0], o.Items[0]]
+assert.Eq(len(o.Items), 2)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	s := convert.NewStruct(g)
+	first, _ := s.Attr("Hits")
+	second, _ := s.Attr("Hits")
+	if first != second {
+		t.Fatal("expected the same wrapper for each access to a field")
+	}
+	// Go code replacing a field is seen by the next access.
+	o := &order{Items: []orderItem{{SKU: "a"}}}
+	os := convert.NewStruct(o)
+	before, _ := os.Attr("Items")
+	o.Items = []orderItem{{SKU: "b"}, {SKU: "c"}}
+	after, _ := os.Attr("Items")
+	if before == after || after.(starlark.Sequence).Len() != 2 {
+		t.Fatalf("expected a new wrapper after Go replaced the field, got %v", after)
+	}
+	s.Freeze()
+	if err := first.(*convert.GoStruct).SetField("N", starlark.MakeInt(2)); err == nil {
+		t.Fatal("expected freezing the struct to freeze its cached fields")
+	}
+}
+
+type wideRecord struct {
+	F01, F02, F03, F04, F05, F06, F07, F08, F09, F10, F11 int
+	F12, F13, F14, F15, F16, F17, F18, F19, F20, F21, F22 int
+}
+
+func TestStructAttrErrors(t *testing.T) {
+	globals := map[string]interface{}{
+		"w":      &wideRecord{},
+		"assert": &assert{t: t},
+	}
+	// the errors must still tell hasattr the attribute is missing.
+	_, err := starlight.Eval([]byte(`assert.Eq(hasattr(w, "F23"), False)`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectFails(t, []fail{
+		{`w.F23`, "go.struct<*convert_test.wideRecord> has no .F23 field or method; it has F03, F13, F20, F21, F22, F01, F02, F04, F05, F06, F07, F08, F09, F10, F11, F12, F14, F15, F16, F17 and 3 more (did you mean .F03?)"},
+		{`w.f_22 = 1`, "go.struct<*convert_test.wideRecord> has no .f_22 field; its fields are F22, F02, F12, F20, F21, F01, F03, F04, F05, F06, F07, F08, F09, F10, F11, F13, F14, F15, F16, F17 and 2 more (did you mean .F22?)"},
+	}, globals)
+
+	// hosts reading attributes directly see the closest names first too.
+	_, err = convert.NewStruct(&wideRecord{}).Attr("to_dicts")
+	expectErr(t, err, "go.struct<*convert_test.wideRecord> has no .to_dicts field or method; it has to_dict, F01, F02, F03, F04, F05, F06, F07, F08, F09, F10, F11, F12, F13, F14, F15, F16, F17, F18, F19 and 3 more")
 }
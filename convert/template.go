@@ -0,0 +1,62 @@
+package convert
+
+import (
+	"fmt"
+	"sort"
+	"text/template"
+
+	"go.starlark.net/starlark"
+)
+
+// FuncMap converts the script functions in fns (such as the globals returned
+// by starlight.Eval) into a template.FuncMap, so that templates rendered by
+// the host can call helpers defined by scripts.  It also works with
+// html/template, whose FuncMap has the same underlying type.
+//
+// Each template function converts its arguments with ToValue, calls the script
+// function on the given thread, and converts the result with FromValue; a
+// script error fails the template execution.  Threads are not safe for
+// concurrent use, so if templates using the FuncMap may execute concurrently,
+// pass a nil thread to run each call on a new thread instead.
+func FuncMap(thread *starlark.Thread, fns map[string]interface{}) (template.FuncMap, error) {
+	names := make([]string, 0, len(fns))
+	for name := range fns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	funcs := make(template.FuncMap, len(fns))
+	for _, name := range names {
+		fn, ok := fns[name].(starlark.Callable)
+		if !ok {
+			return nil, fmt.Errorf("%s is %T, not a starlark callable", name, fns[name])
+		}
+		funcs[name] = templateFunc(thread, fn)
+	}
+	return funcs, nil
+}
+
+func templateFunc(thread *starlark.Thread, fn starlark.Callable) func(...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		t := thread
+		if t == nil {
+			t = &starlark.Thread{Name: fn.Name()}
+		}
+		sargs := make(starlark.Tuple, len(args))
+		for i, a := range args {
+			v, err := ToValueWithOptions(a, WithThread(t))
+			if err != nil {
+				return nil, fmt.Errorf("%s: argument %d: %v", fn.Name(), i+1, err)
+			}
+			sargs[i] = v
+		}
+		v, err := starlark.Call(t, fn, sargs, nil)
+		if err != nil {
+			return nil, err
+		}
+		if v == starlark.None {
+			return nil, nil
+		}
+		return FromValueErr(v)
+	}
+}
@@ -0,0 +1,50 @@
+package convert_test
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+func TestFuncMap(t *testing.T) {
+	globals, err := starlight.Eval([]byte(`
+def shout(s, n):
+    return s.upper() + "!" * n
+
+def names(people):
+    return ", ".join([p.Name for p in people])
+
+def broken():
+    fail("oops")
+`), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs, err := convert.FuncMap(&starlark.Thread{}, globals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := template.Must(template.New("t").Funcs(funcs).Parse(`{{shout "hi" 3}} {{names .}}`))
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, []contact{{Name: "bob"}, {Name: "sue"}}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "HI!!! bob, sue"; buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+
+	tmpl = template.Must(template.New("t").Funcs(funcs).Parse(`{{broken}}`))
+	if err := tmpl.Execute(&buf, nil); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Fatalf("expected script error, got %v", err)
+	}
+}
+
+func TestFuncMapNotCallable(t *testing.T) {
+	if _, err := convert.FuncMap(nil, map[string]interface{}{"x": 1}); err == nil {
+		t.Fatal("expected error for non-callable value")
+	}
+}
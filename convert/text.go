@@ -0,0 +1,57 @@
+package convert
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+
+	"go.starlark.net/starlark"
+)
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// toText converts val to a starlark string with its MarshalText method, if it
+// has one and o allows it.
+func toText(val reflect.Value, o *options) (starlark.Value, bool, error) {
+	if !o.textMarshal() || !val.CanInterface() || !val.Type().Implements(textMarshalerType) {
+		return nil, false, nil
+	}
+	b, err := val.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return nil, true, fmt.Errorf("can't convert %v to text: %v", val.Type(), err)
+	}
+	return starlark.String(b), true, nil
+}
+
+// fromText makes a new value of type t from the string or bytes v with its
+// UnmarshalText method, if it has one.
+func fromText(v starlark.Value, t reflect.Type) (reflect.Value, bool, error) {
+	var text []byte
+	switch v := v.(type) {
+	case starlark.String:
+		text = []byte(v)
+	case starlark.Bytes:
+		text = []byte(v)
+	default:
+		return reflect.Value{}, false, nil
+	}
+	var p reflect.Value
+	switch {
+	case t.Kind() == reflect.Ptr && t.Implements(textUnmarshalerType):
+		p = reflect.New(t.Elem())
+	case reflect.PtrTo(t).Implements(textUnmarshalerType):
+		p = reflect.New(t)
+	default:
+		return reflect.Value{}, false, nil
+	}
+	if err := p.Interface().(encoding.TextUnmarshaler).UnmarshalText(text); err != nil {
+		return reflect.Value{}, true, fmt.Errorf("can't convert %s to %v: %v", v.Type(), t, err)
+	}
+	if t.Kind() == reflect.Ptr {
+		return p, true, nil
+	}
+	return p.Elem(), true, nil
+}
@@ -0,0 +1,51 @@
+package convert_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+type host struct {
+	Name string
+	Addr netip.Addr
+}
+
+func TestTextMarshalers(t *testing.T) {
+	h := &host{Name: "db", Addr: netip.MustParseAddr("10.0.0.1")}
+	var got netip.Addr
+	globals, err := convert.MakeStringDictWithOptions(map[string]interface{}{
+		"assert": &assert{t: t},
+		"h":      h,
+		"ping":   func(a netip.Addr) { got = a },
+	}, convert.TextMarshalers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := `
+assert.Eq(h.Addr, "10.0.0.1")
+h.Addr = "10.0.0.2"
+ping("::1")
+`
+	if _, err := starlark.ExecFile(&starlark.Thread{}, "text.star", code, globals); err != nil {
+		t.Fatal(err)
+	}
+	if h.Addr != netip.MustParseAddr("10.0.0.2") {
+		t.Errorf("expected 10.0.0.2, got %v", h.Addr)
+	}
+	if got != netip.MustParseAddr("::1") {
+		t.Errorf("expected ::1, got %v", got)
+	}
+	_, err = starlark.ExecFile(&starlark.Thread{}, "bad.star", `ping("nope")`, globals)
+	expectErr(t, err, `arg 0: can't convert string to netip.Addr: ParseAddr("nope"): unable to parse IP`)
+
+	v, err := convert.ToValue(h.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(starlark.String); ok {
+		t.Errorf("expected %v not to be converted to a string without the option", v)
+	}
+}
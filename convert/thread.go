@@ -0,0 +1,26 @@
+package convert
+
+import (
+	"context"
+
+	"go.starlark.net/starlark"
+)
+
+// contextKey is the thread local holding the context of a run.
+const contextKey = "starlight.context"
+
+// SetThreadContext sets the context of the run on the given thread, so that
+// builtins that block or start background work can stop when the run is
+// cancelled.  It does not cancel the thread itself when ctx is done.
+func SetThreadContext(thread *starlark.Thread, ctx context.Context) {
+	thread.SetLocal(contextKey, ctx)
+}
+
+// ThreadContext returns the context set on the thread with SetThreadContext,
+// or context.Background if there is none.
+func ThreadContext(thread *starlark.Thread) context.Context {
+	if ctx, ok := thread.Local(contextKey).(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
@@ -0,0 +1,34 @@
+package convert
+
+import (
+	"reflect"
+	"time"
+
+	startime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// toTimeValue converts time.Time and time.Duration values (and non-nil
+// pointers to them) to the time and duration values of go.starlark.net/lib/time,
+// so that scripts can use them with that module.  It returns false for other
+// values.
+func toTimeValue(val reflect.Value) (starlark.Value, bool) {
+	if !val.IsValid() {
+		return nil, false
+	}
+	if val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	switch val.Type() {
+	case timeType:
+		return startime.Time(val.Interface().(time.Time)), true
+	case durationType:
+		return startime.Duration(val.Int()), true
+	}
+	return nil, false
+}
@@ -0,0 +1,84 @@
+package convert_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+	startime "go.starlark.net/lib/time"
+)
+
+type event struct {
+	At time.Time
+}
+
+func TestTimeConversion(t *testing.T) {
+	at := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	e := &event{At: at}
+	globals := map[string]interface{}{
+		"assert": &assert{t: t},
+		"time":   startime.Module,
+		"e":      e,
+		"at":     at,
+		"add":    func(t time.Time, days int) time.Time { return t.AddDate(0, 0, days) },
+	}
+	code := []byte(`
+assert.Eq(type(at), "time.time")
+assert.Eq(at.month, 3)
+assert.Eq(at.format("2006-01-02"), "2020-03-04")
+assert.Eq(add(at, 1).day, 5)
+e.At = time.from_timestamp(0)
+later = at + time.parse_duration("1h")
+`)
+	out, err := starlight.Eval(code, globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.At.Equal(time.Unix(0, 0)) {
+		t.Errorf("expected the field to be set to the epoch, got %v", e.At)
+	}
+	if later, ok := out["later"].(time.Time); !ok || !later.Equal(at.Add(time.Hour)) {
+		t.Errorf("expected later to be a time.Time an hour after at, got %#v", out["later"])
+	}
+	v, err := convert.ToValue(&at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(startime.Time); !ok {
+		t.Errorf("expected a pointer to a time to convert to a time value, got %T", v)
+	}
+}
+
+type job struct {
+	Timeout time.Duration
+}
+
+func TestDurationConversion(t *testing.T) {
+	j := &job{Timeout: time.Minute}
+	var slept time.Duration
+	globals := map[string]interface{}{
+		"assert":  &assert{t: t},
+		"time":    startime.Module,
+		"j":       j,
+		"backoff": func(n int) time.Duration { return time.Duration(n) * time.Second },
+		"sleep":   func(d time.Duration) { slept = d },
+	}
+	code := []byte(`
+assert.Eq(type(j.Timeout), "time.duration")
+assert.Eq(j.Timeout.seconds, 60.0)
+assert.Eq(backoff(2) < j.Timeout, True)
+assert.Eq(str(backoff(2) + backoff(3)), "5s")
+j.Timeout = j.Timeout * 2
+sleep(backoff(1) + time.millisecond)
+`)
+	if _, err := starlight.Eval(code, globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if j.Timeout != 2*time.Minute {
+		t.Errorf("expected timeout to be doubled, got %v", j.Timeout)
+	}
+	if slept != time.Second+time.Millisecond {
+		t.Errorf("expected to sleep 1.001s, got %v", slept)
+	}
+}
@@ -0,0 +1,206 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+
+	startime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Transfer returns a frozen deep copy of v that is safe to hand to another
+// starlark thread, or to cache and share between threads.  Starlark lists,
+// dicts, sets and structs are copied and frozen, and lists and dicts that
+// contain themselves are copied with the same cycles.  Wrapped Go values are
+// unwrapped, their data deep copied, and the copy wrapped again, with the
+// original wrapper's options, so that neither scripts nor the original Go data
+// can change it.  Functions are frozen in place, since starlark functions are
+// safe to call from other threads once frozen.  Other types can't be
+// transferred and return an error.
+func Transfer(v starlark.Value) (starlark.Value, error) {
+	tv, err := transfer(v, map[starlark.Value]starlark.Value{})
+	if err != nil {
+		return nil, err
+	}
+	// freezing the copy as a whole, rather than each part as it's copied,
+	// lets cycles be closed before the lists and dicts in them are frozen.
+	tv.Freeze()
+	return tv, nil
+}
+
+// transfer copies v for Transfer.  seen holds the copies of the lists and dicts
+// copied so far, which are the only values that can refer to themselves.
+func transfer(v starlark.Value, seen map[starlark.Value]starlark.Value) (starlark.Value, error) {
+	switch v := v.(type) {
+	case starlark.NoneType, starlark.Bool, starlark.Int, starlark.Float, starlark.String, starlark.Bytes, Decimal, startime.Time, startime.Duration:
+		return v, nil
+	case starlark.Tuple:
+		return transferAll(v, seen)
+	case *starlark.List:
+		if cp, ok := seen[v]; ok {
+			return cp, nil
+		}
+		l := starlark.NewList(nil)
+		seen[v] = l
+		for i := 0; i < v.Len(); i++ {
+			e, err := transfer(v.Index(i), seen)
+			if err != nil {
+				return nil, err
+			}
+			l.Append(e)
+		}
+		return l, nil
+	case *starlark.Dict:
+		if cp, ok := seen[v]; ok {
+			return cp, nil
+		}
+		d := starlark.NewDict(v.Len())
+		seen[v] = d
+		for _, item := range v.Items() {
+			kv, err := transferAll(item, seen)
+			if err != nil {
+				return nil, err
+			}
+			if err := d.SetKey(kv[0], kv[1]); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	case *starlark.Set:
+		s := starlark.NewSet(v.Len())
+		it := v.Iterate()
+		defer it.Done()
+		var elem starlark.Value
+		for it.Next(&elem) {
+			e, err := transfer(elem, seen)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.Insert(e); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case *starlarkstruct.Struct:
+		fields := starlark.StringDict{}
+		v.ToStringDict(fields)
+		for name, f := range fields {
+			tf, err := transfer(f, seen)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			fields[name] = tf
+		}
+		return starlarkstruct.FromStringDict(v.Constructor(), fields), nil
+	case *GoStruct:
+		return transferGo(v.v, v.opts)
+	case *GoCollection:
+		return transferGo(v.v, v.opts)
+	case *GoIterableStruct:
+		return transferGo(v.v, v.opts)
+	case *GoCallable:
+		return transferGo(v.v, v.opts)
+	case *GoMap:
+		return transferGo(v.v, v.opts)
+	case *GoSlice:
+		return transferGo(v.v, v.opts)
+	case *GoInterface:
+		return transferGo(v.v, v.opts)
+	case *starlark.Function, *starlark.Builtin:
+		return v, nil
+	case *GoChan, *GoRecvChan:
+		// channels are made for sharing.
+		return v, nil
+	}
+	return nil, fmt.Errorf("can't transfer value of type %s", v.Type())
+}
+
+func transferAll(vals []starlark.Value, seen map[starlark.Value]starlark.Value) (starlark.Tuple, error) {
+	ret := make(starlark.Tuple, len(vals))
+	for i, v := range vals {
+		tv, err := transfer(v, seen)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = tv
+	}
+	return ret, nil
+}
+
+// transferGo wraps a deep copy of v with the options o of its wrapper, so that
+// the copy has the same names and conversions, but frozen.  The copy isn't
+// tied to the thread of the original.
+func transferGo(v reflect.Value, o *options) (starlark.Value, error) {
+	cp := deepCopy(v, map[visit]reflect.Value{})
+	o = o.withFrozen(true)
+	if o.threadOrNil() != nil {
+		c := *o
+		c.thread = nil
+		o = &c
+	}
+	return toValue(cp, o)
+}
+
+// deepCopy returns a copy of v that shares no maps, slices or pointers with it.
+// Unexported struct fields are copied shallowly, since they can't be set by
+// reflection.  Functions and channels are shared.  Pointers already copied
+// (keyed by type and address in seen, since a struct and its first field share
+// an address) are reused, so cyclic data is copied faithfully.
+func deepCopy(v reflect.Value, seen map[visit]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		key := visit{v.Type(), v.Pointer()}
+		if cp, ok := seen[key]; ok {
+			return cp
+		}
+		cp := reflect.New(v.Type().Elem())
+		seen[key] = cp
+		cp.Elem().Set(deepCopy(v.Elem(), seen))
+		return cp
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(deepCopy(v.Elem(), seen))
+		return cp
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if f := cp.Field(i); f.CanSet() {
+				f.Set(deepCopy(v.Field(i), seen))
+			}
+		}
+		return cp
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+		return cp
+	case reflect.Array:
+		cp := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+		return cp
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			cp.SetMapIndex(deepCopy(k, seen), deepCopy(v.MapIndex(k), seen))
+		}
+		return cp
+	}
+	return v
+}
@@ -0,0 +1,145 @@
+package convert_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+type shared struct {
+	Name  string
+	Tags  []string
+	Attrs map[string]int
+	Next  *shared
+}
+
+func TestTransferGoValue(t *testing.T) {
+	orig := &shared{Name: "a", Tags: []string{"x"}, Attrs: map[string]int{"n": 1}}
+	orig.Next = orig
+	v, err := convert.ToValue(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tv, err := convert.Transfer(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := convert.FromValue(tv).(*shared)
+	if cp == orig || cp.Next != cp {
+		t.Fatal("expected a copy with the same shape as the original")
+	}
+	orig.Tags[0] = "changed"
+	orig.Attrs["n"] = 2
+	if cp.Tags[0] != "x" || cp.Attrs["n"] != 1 {
+		t.Fatalf("copy shares data with the original: %#v", cp)
+	}
+
+	globals := map[string]interface{}{"s": tv}
+	tests := []fail{
+		{`s.Name = "b"`, "cannot set field of frozen struct"},
+		{`s.Tags[0] = "y"`, "cannot assign to frozen slice"},
+		{`s.Attrs["n"] = 3`, "cannot insert into frozen map"},
+		{`s.Next.Name = "b"`, "cannot set field of frozen struct"},
+	}
+	expectFails(t, tests, globals)
+}
+
+func TestTransferStarlarkValue(t *testing.T) {
+	list := starlark.NewList([]starlark.Value{starlark.String("a")})
+	dict := starlark.NewDict(1)
+	dict.SetKey(starlark.String("list"), list)
+
+	tv, err := convert.Transfer(dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list.Append(starlark.String("b"))
+	if err := dict.SetKey(starlark.String("other"), starlark.None); err != nil {
+		t.Fatalf("original should not be frozen: %v", err)
+	}
+
+	cp := tv.(*starlark.Dict)
+	if cp.Len() != 1 {
+		t.Fatalf("expected 1 key, got %d", cp.Len())
+	}
+	v, _, _ := cp.Get(starlark.String("list"))
+	cpList := v.(*starlark.List)
+	if cpList.Len() != 1 {
+		t.Fatalf("expected copied list to have 1 element, got %v", cpList)
+	}
+	if err := cpList.Append(starlark.String("c")); err == nil {
+		t.Fatal("expected copied list to be frozen")
+	}
+}
+
+type span struct {
+	First, Last int
+}
+
+type aliases struct {
+	Span  *span
+	First *int
+}
+
+func TestTransferAliasedField(t *testing.T) {
+	// a struct and its first field share an address.
+	s := &span{First: 1, Last: 2}
+	v, err := convert.ToValue(&aliases{Span: s, First: &s.First})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tv, err := convert.Transfer(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := convert.FromValue(tv).(*aliases)
+	if cp.Span == s || *cp.Span != *s || *cp.First != 1 {
+		t.Fatalf("unexpected copy %#v", cp)
+	}
+}
+
+func TestTransferCycles(t *testing.T) {
+	l := starlark.NewList(nil)
+	l.Append(l)
+	d := starlark.NewDict(1)
+	d.SetKey(starlark.String("self"), d)
+	l.Append(d)
+
+	tv, err := convert.Transfer(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := tv.(*starlark.List)
+	if cp == l || cp.Index(0) != cp {
+		t.Fatal("expected a copy of the list that contains itself")
+	}
+	cpDict := cp.Index(1).(*starlark.Dict)
+	if v, _, _ := cpDict.Get(starlark.String("self")); v != cpDict {
+		t.Fatal("expected a copy of the dict that contains itself")
+	}
+	if err := cp.Append(starlark.None); err == nil {
+		t.Fatal("expected copied list to be frozen")
+	}
+}
+
+func TestTransferKeepsOptions(t *testing.T) {
+	v, err := convert.ToValueWithOptions(&userRecord{UserID: 1, Password: "secret"}, convert.Naming(strings.ToLower), convert.TagName("json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tv, err := convert.Transfer(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals := map[string]interface{}{"u": tv, "assert": &assert{t: t}}
+	if _, err := starlight.Eval([]byte(`assert.Eq(u.userid, 1)`), globals, nil); err != nil {
+		t.Fatal(err)
+	}
+	expectFails(t, []fail{
+		{`u.Password`, "go.struct<*convert_test.userRecord> has no .Password field or method; it has displayname, userid, httpproxy, mail, tags, to_dict"},
+		{`u.userid = 2`, "cannot set field of frozen struct"},
+	}, globals)
+}
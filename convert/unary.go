@@ -0,0 +1,50 @@
+package convert
+
+import (
+	"reflect"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// unaryMethods are the names of the methods that implement the unary
+// operators for wrapped Go values.
+var unaryMethods = map[syntax.Token]string{
+	syntax.MINUS: "Neg",
+	syntax.PLUS:  "Pos",
+	syntax.TILDE: "Not",
+}
+
+var (
+	_ starlark.HasUnary = (*GoStruct)(nil)
+	_ starlark.HasUnary = (*GoInterface)(nil)
+)
+
+// unary applies the unary operator op to v by calling its Neg, Pos or Not
+// method, which must take no arguments and return a value and optionally an
+// error.  It returns nil if v has no method for op.
+func unary(v reflect.Value, op syntax.Token, o *options) (starlark.Value, error) {
+	m := v.MethodByName(unaryMethods[op])
+	if !m.IsValid() {
+		return nil, nil
+	}
+	t := m.Type()
+	if t.NumIn() != 0 || t.NumOut() == 0 || t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != errType) {
+		return nil, nil
+	}
+	return makeOut(m.Call(nil), o)
+}
+
+// Unary implements the unary operators -x, +x and ~x with the struct's Neg,
+// Pos and Not methods, if it has them.  Each must take no arguments and return
+// the result, and optionally an error.
+func (g *GoStruct) Unary(op syntax.Token) (starlark.Value, error) {
+	return unary(g.receiver(), op, g.opts.nested(g.frozen))
+}
+
+// Unary implements the unary operators -x, +x and ~x with the value's Neg, Pos
+// and Not methods, if it has them, e.g. for numeric or bitset types.  Each must
+// take no arguments and return the result, and optionally an error.
+func (g *GoInterface) Unary(op syntax.Token) (starlark.Value, error) {
+	return unary(g.v, op, g.opts.child())
+}
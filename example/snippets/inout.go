@@ -32,7 +32,7 @@ def run():
   if "nate" in page.Name:
 	  # capitalize words
 	  page.Name = page.Name.title()
-  page.Name += " " + page.Date.Format("2006/01/02")
+  page.Name += " " + page.Date.format("2006/01/02")
   page.IsDraft = False
 run()
 `
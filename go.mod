@@ -0,0 +1,7 @@
+module github.com/starlight-go/starlight
+
+go 1.22
+
+require go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+
+require golang.org/x/sys v0.15.0 // indirect
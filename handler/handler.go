@@ -0,0 +1,273 @@
+// Package handler serves HTTP requests with starlight scripts, for scriptable
+// endpoints and mock servers.
+package handler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// DefaultMaxBody is the default limit on the size of request bodies.
+const DefaultMaxBody = 10 << 20
+
+// Handler is an http.Handler that runs a script for each request, and calls
+// the script's handle(req) function to make the response.
+//
+// The request is passed as a struct with these fields:
+//
+//	method   the HTTP method, e.g. "GET"
+//	url      the request URL, as a string
+//	path     the path of the URL
+//	query    a dict of query parameters to their first value
+//	headers  a dict of canonical header names to their first value
+//	body     the request body, as a string
+//	json     the decoded body if its content type is application/json, or
+//	         None
+//
+// handle returns the response, as a string body, or as a dict or struct with
+// any of these keys (or attributes):
+//
+//	status   the status code, 200 by default
+//	headers  a dict of header names to values
+//	body     the response body, as a string or bytes
+//	json     a value to send as the JSON body, instead of body
+//
+// Returning None sends an empty 204 No Content response.
+type Handler struct {
+	Cache   *starlight.Cache
+	Script  string
+	Globals map[string]interface{}
+	// Func is the name of the script function to call, "handle" if empty.
+	Func string
+	// MaxBody limits the size of request bodies, DefaultMaxBody if zero.
+	MaxBody int64
+	// MaxSteps limits the execution steps of each call of the script's
+	// function, or is zero for no limit.  The call is also cancelled when the
+	// request's context is done.
+	MaxSteps uint64
+	// OnError is called when the script fails.  By default, a 500 Internal
+	// Server Error response is sent without details.
+	OnError func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// New returns a Handler that runs the named script from the cache, with the
+// given globals.
+func New(cache *starlight.Cache, script string, globals map[string]interface{}) *Handler {
+	return &Handler{Cache: cache, Script: script, Globals: globals}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	max := h.MaxBody
+	if max == 0 {
+		max = DefaultMaxBody
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, max))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	thread := &starlark.Thread{Name: r.URL.Path}
+	convert.SetThreadContext(thread, r.Context())
+	if h.MaxSteps > 0 {
+		thread.SetMaxExecutionSteps(h.MaxSteps)
+	}
+	req, err := makeRequest(thread, r, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.serve(thread, w, r, req); err != nil {
+		if h.OnError != nil {
+			h.OnError(w, r, err)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) serve(thread *starlark.Thread, w http.ResponseWriter, r *http.Request, req starlark.Value) error {
+	globals, err := h.Cache.RunContext(r.Context(), h.Script, h.Globals)
+	if err != nil {
+		return err
+	}
+	name := h.Func
+	if name == "" {
+		name = "handle"
+	}
+	fn, ok := globals[name].(starlark.Callable)
+	if !ok {
+		return fmt.Errorf("script %s does not define a %s function", h.Script, name)
+	}
+	v, err := starlight.CallContext(r.Context(), thread, fn, starlark.Tuple{req}, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := makeResponse(thread, v)
+	if err != nil {
+		return err
+	}
+	for k, v := range resp.headers {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(resp.status)
+	if len(resp.body) == 0 {
+		return nil
+	}
+	_, err = w.Write(resp.body)
+	return err
+}
+
+func makeRequest(thread *starlark.Thread, r *http.Request, body []byte) (starlark.Value, error) {
+	query := starlark.NewDict(len(r.URL.Query()))
+	for _, k := range sortedKeys(r.URL.Query()) {
+		query.SetKey(starlark.String(k), starlark.String(r.URL.Query().Get(k)))
+	}
+	headers := starlark.NewDict(len(r.Header))
+	for _, k := range sortedKeys(r.Header) {
+		headers.SetKey(starlark.String(k), starlark.String(r.Header.Get(k)))
+	}
+	var decoded starlark.Value = starlark.None
+	if typ, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); typ == "application/json" && len(body) > 0 {
+		v, err := starlark.Call(thread, json.Module.Members["decode"], starlark.Tuple{starlark.String(body)}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON body: %v", err)
+		}
+		decoded = v
+	}
+	return starlarkstruct.FromStringDict(starlark.String("request"), starlark.StringDict{
+		"method":  starlark.String(r.Method),
+		"url":     starlark.String(r.URL.String()),
+		"path":    starlark.String(r.URL.Path),
+		"query":   query,
+		"headers": headers,
+		"body":    starlark.String(body),
+		"json":    decoded,
+	}), nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type response struct {
+	status  int
+	headers map[string]string
+	body    []byte
+}
+
+func makeResponse(thread *starlark.Thread, v starlark.Value) (*response, error) {
+	resp := &response{status: http.StatusOK, headers: map[string]string{}}
+	switch v := v.(type) {
+	case starlark.NoneType:
+		resp.status = http.StatusNoContent
+		return resp, nil
+	case starlark.String:
+		resp.body = []byte(v)
+		return resp, nil
+	case starlark.Bytes:
+		resp.body = []byte(v)
+		return resp, nil
+	}
+	get, err := getter(v)
+	if err != nil {
+		return nil, err
+	}
+	if status, err := get("status"); err != nil {
+		return nil, err
+	} else if status != nil {
+		if err := starlark.AsInt(status, &resp.status); err != nil {
+			return nil, fmt.Errorf("status: %v", err)
+		}
+	}
+	if headers, err := get("headers"); err != nil {
+		return nil, err
+	} else if headers != nil {
+		m, ok := headers.(starlark.IterableMapping)
+		if !ok {
+			return nil, fmt.Errorf("headers must be a dict, not %s", headers.Type())
+		}
+		for _, item := range m.Items() {
+			k, ok1 := starlark.AsString(item[0])
+			v, ok2 := starlark.AsString(item[1])
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("headers must map strings to strings, got %s: %s", item[0].Type(), item[1].Type())
+			}
+			resp.headers[k] = v
+		}
+	}
+	if j, err := get("json"); err != nil {
+		return nil, err
+	} else if j != nil {
+		s, err := starlark.Call(thread, json.Module.Members["encode"], starlark.Tuple{j}, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp.body = []byte(s.(starlark.String))
+		if _, ok := resp.headers["Content-Type"]; !ok {
+			resp.headers["Content-Type"] = "application/json"
+		}
+		return resp, nil
+	}
+	if body, err := get("body"); err != nil {
+		return nil, err
+	} else if body != nil {
+		switch body := body.(type) {
+		case starlark.String:
+			resp.body = []byte(body)
+		case starlark.Bytes:
+			resp.body = []byte(body)
+		default:
+			return nil, fmt.Errorf("body must be a string or bytes, not %s", body.Type())
+		}
+	}
+	return resp, nil
+}
+
+// getter returns a function that gets the named response key of v, which may
+// be a dict or a value with attributes, such as a struct.  Go struct fields
+// may be capitalized.  It returns nil for keys that are not set.
+func getter(v starlark.Value) (func(name string) (starlark.Value, error), error) {
+	switch v := v.(type) {
+	case starlark.Mapping:
+		return func(name string) (starlark.Value, error) {
+			val, found, err := v.Get(starlark.String(name))
+			if err != nil || !found || val == starlark.None {
+				return nil, err
+			}
+			return val, nil
+		}, nil
+	case starlark.HasAttrs:
+		return func(name string) (starlark.Value, error) {
+			for _, n := range []string{name, strings.ToUpper(name[:1]) + name[1:]} {
+				val, err := v.Attr(n)
+				if err != nil {
+					if _, ok := err.(starlark.NoSuchAttrError); ok {
+						continue
+					}
+					return nil, err
+				}
+				if val != nil && val != starlark.None {
+					return val, nil
+				}
+			}
+			return nil, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("handle must return a string, dict, struct or None, not %s", v.Type())
+}
@@ -0,0 +1,143 @@
+package handler_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/handler"
+)
+
+const script = `
+def handle(req):
+    if req.path == "/hello":
+        return "hello " + req.query.get("name", "nobody")
+    if req.path == "/echo":
+        return {
+            "status": 201,
+            "headers": {"X-Method": req.method},
+            "json": {"got": req.json, "agent": req.headers.get("User-Agent")},
+        }
+    if req.path == "/empty":
+        return None
+    if req.path == "/bytes":
+        return {"status": 200, "body": b"raw"}
+    if req.path == "/struct":
+        return reply
+    if req.path == "/forever":
+        for i in range(1 << 62):
+            pass
+    fail("unknown path " + req.path)
+`
+
+type reply struct {
+	Status  int
+	Headers map[string]string
+}
+
+func newHandler(t *testing.T) (*handler.Handler, func()) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "api.star"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := handler.New(starlight.New(dir), "api.star", map[string]interface{}{
+		"reply": &reply{Status: 418, Headers: map[string]string{"X-Tea": "yes"}},
+	})
+	return h, func() { os.RemoveAll(dir) }
+}
+
+func TestHandler(t *testing.T) {
+	h, cleanup := newHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		headers            map[string]string
+		respBody           string
+	}{
+		{"GET", "/hello?name=bob", "", 200, nil, "hello bob"},
+		{"POST", "/echo", `{"a": [1, 2]}`, 201, map[string]string{"X-Method": "POST", "Content-Type": "application/json"}, `{"agent":"test","got":{"a":[1,2]}}`},
+		{"GET", "/empty", "", 204, nil, ""},
+		{"GET", "/bytes", "", 200, nil, "raw"},
+		{"GET", "/struct", "", 418, map[string]string{"X-Tea": "yes"}, ""},
+		{"GET", "/missing", "", 500, nil, "Internal Server Error\n"},
+		{"POST", "/echo", `{bad`, 400, nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			r.Header.Set("User-Agent", "test")
+			if test.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body)
+			}
+			for k, v := range test.headers {
+				if got := w.Header().Get(k); got != v {
+					t.Errorf("expected header %s to be %q, got %q", k, v, got)
+				}
+			}
+			if test.status != 400 && w.Body.String() != test.respBody {
+				t.Errorf("expected body %q, got %q", test.respBody, w.Body)
+			}
+		})
+	}
+}
+
+func TestHandlerOnError(t *testing.T) {
+	h, cleanup := newHandler(t)
+	defer cleanup()
+	var got error
+	h.OnError = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if w.Code != http.StatusBadGateway || got == nil || !strings.Contains(got.Error(), "unknown path /missing") {
+		t.Fatalf("expected error handler to be called, got status %d and error %v", w.Code, got)
+	}
+}
+
+func TestHandlerLimits(t *testing.T) {
+	h, cleanup := newHandler(t)
+	defer cleanup()
+	var got error
+	h.OnError = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	// the script stops when the request's context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/forever", nil).WithContext(ctx))
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("expected the script to stop at the deadline, it ran for %v", d)
+	}
+	if got == nil || !strings.Contains(got.Error(), "context deadline exceeded") {
+		t.Fatalf("expected a deadline error, got %v", got)
+	}
+
+	h.MaxSteps = 1000
+	got = nil
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/forever", nil))
+	if got == nil || !strings.Contains(got.Error(), "too many steps") {
+		t.Fatalf("expected a step limit error, got %v", got)
+	}
+}
@@ -0,0 +1,420 @@
+// Package introspect describes the Go values made available to starlight
+// scripts, as seen from the script side.
+package introspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+var (
+	errType    = reflect.TypeOf((*error)(nil)).Elem()
+	valueType  = reflect.TypeOf((*starlark.Value)(nil)).Elem()
+	threadType = reflect.TypeOf((*starlark.Thread)(nil))
+)
+
+// Environment describes everything a set of globals makes available to
+// scripts.  It is suitable for encoding as JSON, for consumption by editors and
+// language servers.
+type Environment struct {
+	Globals []*Symbol `json:"globals"`
+	// Classes holds the Go types with fields or methods that are reachable from
+	// the globals, sorted by name.
+	Classes []*Class `json:"classes"`
+
+	classes map[string]*Class
+	// names maps Go types (not pointers) to their class names.
+	names map[reflect.Type]string
+	// opts are the options the globals are converted with.
+	opts []convert.Option
+}
+
+// Symbol kinds.
+const (
+	KindModule   = "module"
+	KindFunction = "function"
+	KindBuiltin  = "builtin"
+	KindValue    = "value"
+)
+
+// Symbol is a global, or a member of a module.
+type Symbol struct {
+	Name string `json:"name"`
+	// Kind is one of the Kind constants.
+	Kind string `json:"kind"`
+	// Type is the script-side type of a value, in python type hint syntax.
+	Type string `json:"type,omitempty"`
+	// GoType is the Go type of a value or function, if it is a Go value.
+	GoType  string     `json:"goType,omitempty"`
+	Func    *Signature `json:"func,omitempty"`
+	Members []*Symbol  `json:"members,omitempty"`
+	// Doc is the documentation of the Go function, if known.  See AddDocs.
+	// Builtins made with convert.Document have their own documentation.
+	Doc string `json:"doc,omitempty"`
+	// Params describe the parameters of a documented builtin.
+	Params []*Param `json:"params,omitempty"`
+
+	// goName is the qualified name of a Go function, e.g. "fmt.Sprint".
+	goName string
+}
+
+// Signature describes the parameters and results of a function as seen by
+// scripts.  A trailing error result is not included, since it is reported as a
+// script error.  Builtins written directly against the starlark API have no
+// known parameters and are marked variadic.
+type Signature struct {
+	Params   []string `json:"params"`
+	Variadic bool     `json:"variadic,omitempty"`
+	Results  []string `json:"results"`
+
+	// decls are the python parameter declarations of builtin methods, whose
+	// parameters have names and defaults.
+	decls []string
+}
+
+// Param describes a parameter of a builtin made with convert.Document.
+type Param struct {
+	Name string `json:"name"`
+	Doc  string `json:"doc,omitempty"`
+}
+
+// Class describes a Go type with fields or methods.
+type Class struct {
+	Name    string    `json:"name"`
+	GoType  string    `json:"goType"`
+	Fields  []*Field  `json:"fields,omitempty"`
+	Methods []*Method `json:"methods,omitempty"`
+	Doc     string    `json:"doc,omitempty"`
+
+	ptr bool
+	// goName is the qualified name of the Go type, e.g. "net/url.URL".
+	goName string
+}
+
+// Field is a struct field visible to scripts.  ReadOnly fields can't be set by
+// scripts, because the struct is held by value or converted with the ReadOnly
+// option.
+type Field struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	GoType   string `json:"goType"`
+	ReadOnly bool   `json:"readOnly"`
+	Doc      string `json:"doc,omitempty"`
+
+	// goName is the Go name of the field, which scripts may call differently.
+	goName string
+}
+
+// Method is a method visible to scripts.
+type Method struct {
+	Name string     `json:"name"`
+	Func *Signature `json:"func"`
+	Doc  string     `json:"doc,omitempty"`
+
+	// goName is the Go name of the method, or "" for builtin methods.
+	goName string
+}
+
+// Describe returns a description of the given globals as seen by scripts when
+// they're converted with the given options, which decide the names scripts use
+// for fields and methods, the types of values, and whether fields can be set.
+func Describe(globals map[string]interface{}, opts ...convert.Option) *Environment {
+	env := &Environment{
+		classes: map[string]*Class{},
+		names:   map[reflect.Type]string{},
+		opts:    opts,
+	}
+	for _, name := range sortedKeys(globals) {
+		env.Globals = append(env.Globals, env.symbol(name, globals[name]))
+	}
+	names := make([]string, 0, len(env.classes))
+	for name := range env.classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env.Classes = append(env.Classes, env.classes[name])
+	}
+	return env
+}
+
+// WriteJSON writes the indented JSON description of globals to w.
+func WriteJSON(w io.Writer, globals map[string]interface{}, opts ...convert.Option) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Describe(globals, opts...))
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (env *Environment) symbol(name string, v interface{}) *Symbol {
+	sym := &Symbol{Name: name, Kind: KindValue}
+	switch v := v.(type) {
+	case *starlarkstruct.Module:
+		sym.Kind = KindModule
+		sym.Type = "module"
+		members := make(map[string]interface{}, len(v.Members))
+		for k, m := range v.Members {
+			members[k] = m
+		}
+		for _, k := range sortedKeys(members) {
+			sym.Members = append(sym.Members, env.symbol(k, members[k]))
+		}
+		return sym
+	case *convert.DocBuiltin:
+		sym.Kind = KindBuiltin
+		sym.Type = v.Type()
+		sym.Func = &Signature{Variadic: true, Results: []string{"Any"}}
+		sym.Doc = v.Doc
+		for _, p := range v.Params {
+			sym.Params = append(sym.Params, &Param{Name: p.Name, Doc: p.Doc})
+		}
+		return sym
+	case starlark.Callable:
+		sym.Kind = KindBuiltin
+		sym.Type = v.Type()
+		sym.Func = &Signature{Variadic: true, Results: []string{"Any"}}
+		return sym
+	case starlark.Value:
+		sym.Type = v.Type()
+		return sym
+	}
+	t := reflect.TypeOf(v)
+	if t == nil {
+		sym.Type = "None"
+		return sym
+	}
+	sym.GoType = t.String()
+	if t.Kind() == reflect.Func {
+		sym.Kind = KindFunction
+		sym.Func = env.signature(t, 0)
+		if f := runtime.FuncForPC(reflect.ValueOf(v).Pointer()); f != nil {
+			sym.goName = f.Name()
+		}
+		return sym
+	}
+	sym.Type = env.typeName(t)
+	return sym
+}
+
+// signature describes a function type, skipping the first skip parameters
+// (i.e. method receivers), and a *starlark.Thread parameter after them, which
+// scripts don't pass.
+func (env *Environment) signature(t reflect.Type, skip int) *Signature {
+	sig := &Signature{Variadic: t.IsVariadic(), Params: []string{}, Results: []string{}}
+	if t.NumIn() > skip && t.In(skip) == threadType {
+		skip++
+	}
+	for i := skip; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if sig.Variadic && i == t.NumIn()-1 {
+			in = in.Elem()
+		}
+		sig.Params = append(sig.Params, env.typeName(in))
+	}
+	n := t.NumOut()
+	if n > 0 && t.Out(n-1) == errType {
+		n--
+	}
+	for i := 0; i < n; i++ {
+		sig.Results = append(sig.Results, env.typeName(t.Out(i)))
+	}
+	return sig
+}
+
+// typeName returns the script-side name for values of the given Go type,
+// registering classes for types with fields or methods.
+func (env *Environment) typeName(t reflect.Type) string {
+	if t.Implements(valueType) {
+		return "Any"
+	}
+	if name, ok := convert.ScriptType(t, env.opts...); ok {
+		return name
+	}
+	elem := t
+	if t.Kind() == reflect.Ptr {
+		elem = t.Elem()
+	}
+	if elem.Kind() == reflect.Struct || (t.NumMethod() > 0 && isBasic(elem.Kind())) {
+		return env.class(t)
+	}
+	switch elem.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.String:
+		return "str"
+	case reflect.Slice, reflect.Array:
+		return fmt.Sprintf("list[%s]", env.typeName(elem.Elem()))
+	case reflect.Map:
+		return fmt.Sprintf("dict[%s, %s]", env.typeName(elem.Key()), env.typeName(elem.Elem()))
+	case reflect.Chan:
+		if elem.ChanDir() == reflect.RecvDir {
+			// functions return these as iterables.
+			return fmt.Sprintf("Iterable[%s]", env.typeName(elem.Elem()))
+		}
+	case reflect.Func:
+		if yield, ok := seqYield(elem); ok {
+			if yield.NumIn() == 2 {
+				return fmt.Sprintf("Iterable[tuple[%s, %s]]", env.typeName(yield.In(0)), env.typeName(yield.In(1)))
+			}
+			return fmt.Sprintf("Iterable[%s]", env.typeName(yield.In(0)))
+		}
+		sig := env.signature(elem, 0)
+		return fmt.Sprintf("Callable[[%s], %s]", strings.Join(sig.Params, ", "), sig.Result())
+	}
+	return "Any"
+}
+
+// seqYield returns the yield function type of t, if t is an iterator function
+// such as iter.Seq.
+func seqYield(t reflect.Type) (reflect.Type, bool) {
+	if t.NumIn() != 1 || t.NumOut() != 0 {
+		return nil, false
+	}
+	yield := t.In(0)
+	if yield.Kind() != reflect.Func || (yield.NumIn() != 1 && yield.NumIn() != 2) ||
+		yield.NumOut() != 1 || yield.Out(0).Kind() != reflect.Bool {
+		return nil, false
+	}
+	return yield, true
+}
+
+func isBasic(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.String,
+		reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// class registers the struct or named type t (or the type it points to) and
+// returns its class name.  Values and pointers share a class; the class gets
+// the pointer's method set and settable fields if the pointer is ever seen.
+func (env *Environment) class(t reflect.Type) string {
+	ptr := t.Kind() == reflect.Ptr
+	elem := t
+	if ptr {
+		elem = t.Elem()
+	}
+	if name, ok := env.names[elem]; ok {
+		c := env.classes[name]
+		if ptr && !c.ptr {
+			c.ptr = true
+			for i, f := range convert.ScriptFields(elem, env.opts...) {
+				c.Fields[i].ReadOnly = f.ReadOnly
+			}
+			env.methods(c, t)
+		}
+		return name
+	}
+	name := elem.Name()
+	if name == "" {
+		// anonymous struct
+		name = "struct"
+	}
+	if _, ok := env.classes[name]; ok {
+		base := sanitize(elem.PkgPath()) + "_" + name
+		name = base
+		for i := 2; env.classes[name] != nil; i++ {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+	}
+	c := &Class{Name: name, GoType: elem.String(), ptr: ptr}
+	if elem.Name() != "" {
+		c.goName = elem.PkgPath() + "." + elem.Name()
+	}
+	env.names[elem] = name
+	env.classes[name] = c
+
+	if elem.Kind() == reflect.Struct {
+		for _, f := range convert.ScriptFields(elem, env.opts...) {
+			c.Fields = append(c.Fields, &Field{
+				Name:   f.Name,
+				Type:   env.typeName(f.Type),
+				GoType: f.Type.String(),
+				// fields of a struct held by value can't be changed by scripts.
+				ReadOnly: !ptr || f.ReadOnly,
+				goName:   f.StructField.Name,
+			})
+		}
+	}
+	env.methods(c, t)
+	return name
+}
+
+// methods sets the methods of c to the method set of t, and the builtin
+// methods of structs.
+func (env *Environment) methods(c *Class, t reflect.Type) {
+	c.Methods = c.Methods[:0]
+	names := map[string]bool{}
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		name := convert.ScriptName(m.Name, env.opts...)
+		names[name] = true
+		c.Methods = append(c.Methods, &Method{Name: name, Func: env.signature(m.Type, 1), goName: m.Name})
+	}
+	for _, f := range c.Fields {
+		names[f.Name] = true
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// a field or method called to_dict hides the builtin, as in GoStruct.
+	if t.Kind() == reflect.Struct && !names["to_dict"] {
+		c.Methods = append(c.Methods, &Method{
+			Name: "to_dict",
+			Func: &Signature{
+				Params:  []string{"bool"},
+				Results: []string{"dict[str, Any]"},
+				decls:   []string{"omit_empty: bool = False"},
+			},
+			Doc: "Returns a dict of the struct's fields, leaving out zero fields if omit_empty is true.",
+		})
+	}
+}
+
+func sanitize(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// Result returns the script-side result type of the function, in python type
+// hint syntax.
+func (s *Signature) Result() string {
+	switch len(s.Results) {
+	case 0:
+		return "None"
+	case 1:
+		return s.Results[0]
+	}
+	return fmt.Sprintf("tuple[%s]", strings.Join(s.Results, ", "))
+}
@@ -0,0 +1,198 @@
+package introspect_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/starlight-go/starlight/convert"
+	"github.com/starlight-go/starlight/introspect"
+	"go.starlark.net/starlark"
+)
+
+func TestDescribe(t *testing.T) {
+	env := introspect.Describe(map[string]interface{}{
+		"contact": contact{},
+		// the thread is passed by MakeStarFn, not by scripts.
+		"greet": func(thread *starlark.Thread, name string, n int) (string, error) { return "", nil },
+	})
+	if len(env.Globals) != 2 {
+		t.Fatalf("expected 2 globals, got %d", len(env.Globals))
+	}
+	c, fn := env.Globals[0], env.Globals[1]
+	if c.Kind != introspect.KindValue || c.Type != "contact" || c.GoType != "introspect_test.contact" {
+		t.Errorf("unexpected contact symbol: %#v", c)
+	}
+	if fn.Kind != introspect.KindFunction {
+		t.Fatalf("expected greet to be a function, got %q", fn.Kind)
+	}
+	if len(fn.Func.Params) != 2 || fn.Func.Params[0] != "str" || fn.Func.Params[1] != "int" {
+		t.Errorf("unexpected params: %q", fn.Func.Params)
+	}
+	if fn.Func.Result() != "str" {
+		t.Errorf("expected result str, got %q", fn.Func.Result())
+	}
+
+	var class *introspect.Class
+	for _, cl := range env.Classes {
+		if cl.Name == "contact" {
+			class = cl
+		}
+	}
+	if class == nil {
+		t.Fatalf("contact class not found in %#v", env.Classes)
+	}
+	for _, f := range class.Fields {
+		if !f.ReadOnly {
+			t.Errorf("field %s of struct passed by value should be read only", f.Name)
+		}
+	}
+	// contact is passed by value, so the pointer method Greet isn't visible.
+	if len(class.Methods) != 1 || class.Methods[0].Name != "to_dict" {
+		t.Errorf("expected only the to_dict builtin method, got %d methods", len(class.Methods))
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := introspect.WriteJSON(&buf, map[string]interface{}{"contact": &contact{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Globals []struct {
+			Name string
+			Kind string
+			Type string
+		}
+		Classes []struct {
+			Name   string
+			Fields []struct {
+				Name     string
+				ReadOnly bool
+			}
+			Methods []struct{ Name string }
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Globals) != 1 || out.Globals[0].Name != "contact" || out.Globals[0].Type != "contact" {
+		t.Fatalf("unexpected globals: %s", buf.String())
+	}
+	for _, c := range out.Classes {
+		if c.Name != "contact" {
+			continue
+		}
+		if len(c.Methods) != 2 || c.Methods[0].Name != "Greet" || c.Methods[1].Name != "to_dict" {
+			t.Fatalf("unexpected methods: %s", buf.String())
+		}
+		for _, f := range c.Fields {
+			if f.ReadOnly {
+				t.Errorf("field %s of struct pointer should be settable", f.Name)
+			}
+		}
+		return
+	}
+	t.Fatalf("contact class not found: %s", buf.String())
+}
+
+func TestDescribeStreams(t *testing.T) {
+	env := introspect.Describe(map[string]interface{}{
+		"lines": func() <-chan string { return nil },
+		"pairs": func() func(func(string, int) bool) { return nil },
+	})
+	for i, want := range []string{"Iterable[str]", "Iterable[tuple[str, int]]"} {
+		if got := env.Globals[i].Func.Result(); got != want {
+			t.Errorf("%s: expected result %s, got %s", env.Globals[i].Name, want, got)
+		}
+	}
+}
+
+type audit struct {
+	CreatedBy string
+}
+
+type account struct {
+	audit
+	UserID   int
+	Email    string `json:"mail"`
+	Nickname string `starlark:"nick"`
+	Token    string `starlark:"-"`
+	Password string `json:"-"`
+}
+
+func (a *account) ResetPassword() {}
+
+func TestDescribeFieldNames(t *testing.T) {
+	globals := map[string]interface{}{"acct": &account{}}
+	tests := []struct {
+		opts    []convert.Option
+		fields  []string
+		methods []string
+	}{
+		{nil, []string{"CreatedBy", "UserID", "Email", "nick", "Password"}, []string{"ResetPassword", "to_dict"}},
+		{[]convert.Option{convert.Naming(convert.SnakeCase), convert.TagName("json")}, []string{"created_by", "user_id", "mail", "nick"}, []string{"reset_password", "to_dict"}},
+	}
+	for _, test := range tests {
+		env := introspect.Describe(globals, test.opts...)
+		var class *introspect.Class
+		for _, c := range env.Classes {
+			if c.Name == "account" {
+				class = c
+			}
+		}
+		if class == nil {
+			t.Fatalf("account class not found in %#v", env.Classes)
+		}
+		var fields, methods []string
+		for _, f := range class.Fields {
+			fields = append(fields, f.Name)
+		}
+		for _, m := range class.Methods {
+			methods = append(methods, m.Name)
+		}
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("expected fields %q, got %q", test.fields, fields)
+		}
+		if !reflect.DeepEqual(methods, test.methods) {
+			t.Errorf("expected methods %q, got %q", test.methods, methods)
+		}
+	}
+}
+
+type event struct {
+	At      time.Time
+	Payload []byte
+	Took    time.Duration
+}
+
+func TestDescribeConvertedTypes(t *testing.T) {
+	globals := map[string]interface{}{"ev": &event{}}
+	tests := []struct {
+		opts     []convert.Option
+		types    []string
+		readOnly bool
+	}{
+		{nil, []string{"time", "bytes", "duration"}, false},
+		{[]convert.Option{convert.BytesAsString(), convert.ReadOnly()}, []string{"time", "str", "duration"}, true},
+	}
+	for _, test := range tests {
+		env := introspect.Describe(globals, test.opts...)
+		if len(env.Classes) != 1 || env.Classes[0].Name != "event" {
+			t.Fatalf("expected only the event class, got %#v", env.Classes)
+		}
+		var types []string
+		for _, f := range env.Classes[0].Fields {
+			types = append(types, f.Type)
+			if f.ReadOnly != test.readOnly {
+				t.Errorf("expected field %s to have ReadOnly %v", f.Name, test.readOnly)
+			}
+		}
+		if !reflect.DeepEqual(types, test.types) {
+			t.Errorf("expected field types %q, got %q", test.types, types)
+		}
+	}
+}
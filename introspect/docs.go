@@ -0,0 +1,208 @@
+package introspect
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"strings"
+)
+
+// Docs holds Go documentation comments, keyed by qualified name: the import
+// path and name of a function or type ("net/url.Parse", "net/url.URL"), with
+// the method or field name appended for members ("net/url.URL.Host").
+type Docs map[string]string
+
+// AddPackage parses the Go package with the given import path from the source
+// in dir and adds its documentation to d.  Unexported declarations are
+// included, since unexported types are often what gets passed to scripts.
+func (d Docs) AddPackage(importPath, dir string) error {
+	fset := token.NewFileSet()
+	notTest := func(fi os.FileInfo) bool { return !strings.HasSuffix(fi.Name(), "_test.go") }
+	pkgs, err := parser.ParseDir(fset, dir, notTest, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		files := make([]*ast.File, 0, len(pkg.Files))
+		for _, f := range pkg.Files {
+			files = append(files, f)
+		}
+		p, err := doc.NewFromFiles(fset, files, importPath, doc.AllDecls|doc.AllMethods)
+		if err != nil {
+			return err
+		}
+		d.addPackage(importPath, p)
+	}
+	return nil
+}
+
+func (d Docs) addPackage(path string, p *doc.Package) {
+	for _, f := range p.Funcs {
+		d[path+"."+f.Name] = f.Doc
+	}
+	for _, t := range p.Types {
+		name := path + "." + t.Name
+		d[name] = t.Doc
+		for _, f := range t.Funcs {
+			d[path+"."+f.Name] = f.Doc
+		}
+		for _, m := range t.Methods {
+			d[name+"."+m.Name] = m.Doc
+		}
+		for _, spec := range t.Decl.Specs {
+			ts, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			for _, field := range st.Fields.List {
+				text := field.Doc.Text()
+				if text == "" {
+					text = field.Comment.Text()
+				}
+				for _, n := range field.Names {
+					d[name+"."+n.Name] = text
+				}
+			}
+		}
+	}
+}
+
+// AddDocs fills in the documentation of the environment's Go functions,
+// classes, fields, and methods from docs.
+func (env *Environment) AddDocs(docs Docs) {
+	var syms func([]*Symbol)
+	syms = func(list []*Symbol) {
+		for _, s := range list {
+			if s.goName != "" {
+				s.Doc = docs[s.goName]
+			}
+			syms(s.Members)
+		}
+	}
+	syms(env.Globals)
+	for _, c := range env.Classes {
+		if c.goName == "" {
+			continue
+		}
+		c.Doc = docs[c.goName]
+		for _, f := range c.Fields {
+			f.Doc = docs[c.goName+"."+f.goName]
+		}
+		for _, m := range c.Methods {
+			if m.goName != "" {
+				m.Doc = docs[c.goName+"."+m.goName]
+			}
+		}
+	}
+}
+
+// WriteMarkdown writes human-readable reference documentation of the
+// environment to w, as markdown.  Call AddDocs first to include the Go
+// documentation comments.
+func (env *Environment) WriteMarkdown(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# Script API")
+	if len(env.Globals) > 0 {
+		fmt.Fprintln(bw)
+		fmt.Fprintln(bw, "## Globals")
+		for _, s := range env.Globals {
+			writeSymbolDoc(bw, "", s)
+		}
+	}
+	if len(env.Classes) > 0 {
+		fmt.Fprintln(bw)
+		fmt.Fprintln(bw, "## Types")
+		for _, c := range env.Classes {
+			fmt.Fprintln(bw)
+			fmt.Fprintf(bw, "### %s\n", c.Name)
+			writeDoc(bw, c.Doc)
+			for _, f := range c.Fields {
+				ro := ""
+				if f.ReadOnly {
+					ro = ", read-only"
+				}
+				fmt.Fprintf(bw, "\n- `%s: %s`%s%s\n", f.Name, f.Type, ro, indentDoc(f.Doc))
+			}
+			for _, m := range c.Methods {
+				fmt.Fprintf(bw, "\n- `%s(%s) -> %s`%s\n", m.Name, params(m.Func, false), m.Func.Result(), indentDoc(m.Doc))
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func writeSymbolDoc(w io.Writer, prefix string, s *Symbol) {
+	fmt.Fprintln(w)
+	switch s.Kind {
+	case KindModule:
+		fmt.Fprintf(w, "### %s%s (module)\n", prefix, s.Name)
+		for _, m := range s.Members {
+			writeSymbolDoc(w, prefix+s.Name+".", m)
+		}
+		return
+	case KindFunction:
+		fmt.Fprintf(w, "### %s%s(%s) -> %s\n", prefix, s.Name, params(s.Func, false), s.Func.Result())
+	case KindBuiltin:
+		if len(s.Params) == 0 {
+			fmt.Fprintf(w, "### %s%s(...)\n", prefix, s.Name)
+			break
+		}
+		names := make([]string, len(s.Params))
+		for i, p := range s.Params {
+			names[i] = p.Name
+		}
+		fmt.Fprintf(w, "### %s%s(%s)\n", prefix, s.Name, strings.Join(names, ", "))
+	default:
+		fmt.Fprintf(w, "### %s%s: %s\n", prefix, s.Name, s.Type)
+	}
+	writeDoc(w, s.Doc)
+	for _, p := range s.Params {
+		fmt.Fprintf(w, "\n- `%s`%s\n", p.Name, indentDoc(p.Doc))
+	}
+}
+
+// WriteBuiltinDocs writes markdown reference documentation of the functions
+// and builtins in globals, including those in modules, to w, e.g. to publish
+// the documentation of builtins made with convert.Document for script authors.
+func WriteBuiltinDocs(w io.Writer, globals map[string]interface{}) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# Builtins")
+	var write func(prefix string, list []*Symbol)
+	write = func(prefix string, list []*Symbol) {
+		for _, s := range list {
+			switch s.Kind {
+			case KindModule:
+				write(prefix+s.Name+".", s.Members)
+			case KindFunction, KindBuiltin:
+				writeSymbolDoc(bw, prefix, s)
+			}
+		}
+	}
+	write("", Describe(globals).Globals)
+	return bw.Flush()
+}
+
+func writeDoc(w io.Writer, text string) {
+	if text = strings.TrimSpace(text); text != "" {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, text)
+	}
+}
+
+// indentDoc formats text to follow a markdown list item.
+func indentDoc(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+	return "\n\n  " + strings.Replace(text, "\n", "\n  ", -1)
+}
@@ -0,0 +1,89 @@
+package introspect_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/starlight-go/starlight/convert"
+	"github.com/starlight-go/starlight/introspect"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+func TestDocs(t *testing.T) {
+	docs := introspect.Docs{}
+	if err := docs.AddPackage("strings", filepath.Join(runtime.GOROOT(), "src", "strings")); err != nil {
+		t.Fatal(err)
+	}
+	env := introspect.Describe(map[string]interface{}{
+		"upper":   strings.ToUpper,
+		"builder": &strings.Builder{},
+	})
+	env.AddDocs(docs)
+
+	if !strings.HasPrefix(env.Globals[1].Doc, "ToUpper returns") {
+		t.Errorf("unexpected doc for upper: %q", env.Globals[1].Doc)
+	}
+	var buf bytes.Buffer
+	if err := env.WriteMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{
+		"### upper(arg0: str) -> str\n\nToUpper returns",
+		"### builder: Builder",
+		"### Builder\n\nA Builder is used",
+		"- `WriteString(arg0: str) -> int`\n\n  WriteString appends",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output does not contain %q:\n%s", s, out)
+		}
+	}
+}
+
+func TestDocumentedBuiltins(t *testing.T) {
+	fetch := convert.Document(
+		convert.MakeNamedStarFn("fetch", func(url string, retries int) string { return url }, "url", "retries"),
+		"fetch downloads url.",
+		convert.ParamDoc{Name: "url", Doc: "the address to download"},
+		convert.ParamDoc{Name: "retries", Doc: "how many times to retry"},
+	)
+	globals := map[string]interface{}{
+		"http":  &starlarkstruct.Module{Name: "http", Members: starlark.StringDict{"fetch": fetch}},
+		"upper": strings.ToUpper,
+		"limit": 5,
+	}
+	env := introspect.Describe(globals)
+	env.AddDocs(introspect.Docs{})
+	sym := env.Globals[0].Members[0]
+	if sym.Doc != "fetch downloads url." || len(sym.Params) != 2 || sym.Params[1].Name != "retries" {
+		t.Errorf("unexpected description of fetch: %+v", sym)
+	}
+
+	var buf bytes.Buffer
+	if err := introspect.WriteBuiltinDocs(&buf, globals); err != nil {
+		t.Fatal(err)
+	}
+	want := `# Builtins
+
+### http.fetch(url, retries)
+
+fetch downloads url.
+
+- ` + "`url`" + `
+
+  the address to download
+
+- ` + "`retries`" + `
+
+  how many times to retry
+
+### upper(arg0: str) -> str
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
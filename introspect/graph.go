@@ -0,0 +1,341 @@
+package introspect
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// MaxGraphElems is the number of elements of each map or slice included in a
+// Graph.  The rest are counted in Node.Truncated.
+const MaxGraphElems = 100
+
+// Node kinds, besides the Kind constants for symbols.
+const (
+	KindGlobals   = "globals"
+	KindStruct    = "struct"
+	KindMap       = "map"
+	KindSlice     = "slice"
+	KindInterface = "interface"
+	KindChan      = "chan"
+	KindStarlark  = "starlark"
+)
+
+// Graph is the graph of Go data reachable by scripts from a set of globals, so
+// that it can be reviewed before scripts are given access to it.  Node 0 is
+// the globals, with an edge to each global.
+//
+// Unlike Describe, which describes types, Graph walks the values themselves,
+// so it shows which values are shared (and can be changed through more than
+// one path) and where the data has cycles.
+type Graph struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []*Edge `json:"edges"`
+}
+
+// Node is a value reachable by scripts that holds other values: a struct, map,
+// slice, function or channel, a Go value with methods, or a module.  Scalar
+// fields and elements are listed in Scalars rather than having nodes of their
+// own.
+type Node struct {
+	ID int `json:"id"`
+	// Kind is one of the Kind constants.
+	Kind string `json:"kind"`
+	// Type is the script-side type of the value, e.g. "go.map<map[string]int>".
+	Type   string `json:"type"`
+	GoType string `json:"goType,omitempty"`
+	// Scalars lists the scalar fields or elements, e.g. "Name: string".
+	Scalars []string `json:"scalars,omitempty"`
+	// Methods lists the Go methods scripts can call on the value.
+	Methods []string `json:"methods,omitempty"`
+	// Truncated is the number of map or slice elements left out of the graph.
+	Truncated int `json:"truncated,omitempty"`
+	// Shared is true if the value can be reached by more than one edge.
+	Shared bool `json:"shared,omitempty"`
+}
+
+// Edge is a reference from one node to another, labeled with the field name,
+// index, key or global name that scripts use to follow it.
+type Edge struct {
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+	Label string `json:"label"`
+	// Cycle is true if the edge leads back to a node that reaches it.
+	Cycle bool `json:"cycle,omitempty"`
+}
+
+// MakeGraph returns the graph of data reachable from the given globals when
+// they're converted with the given options, which decide the names scripts use
+// for fields and methods.
+func MakeGraph(globals map[string]interface{}, opts ...convert.Option) *Graph {
+	w := &grapher{
+		g:       &Graph{},
+		ids:     map[nodeKey]int{},
+		onStack: map[int]bool{},
+		opts:    opts,
+	}
+	root := w.add(&Node{Kind: KindGlobals, Type: "globals"})
+	for _, name := range sortedKeys(globals) {
+		w.member(root, name, globals[name])
+	}
+	incoming := map[int]int{}
+	for _, e := range w.g.Edges {
+		incoming[e.To]++
+	}
+	for _, n := range w.g.Nodes {
+		n.Shared = incoming[n.ID] > 1
+	}
+	return w.g
+}
+
+// nodeKey identifies values with identity, i.e. anything held by reference.
+type nodeKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+type grapher struct {
+	g       *Graph
+	ids     map[nodeKey]int
+	onStack map[int]bool
+	opts    []convert.Option
+}
+
+func (w *grapher) add(n *Node) int {
+	n.ID = len(w.g.Nodes)
+	w.g.Nodes = append(w.g.Nodes, n)
+	return n.ID
+}
+
+func (w *grapher) edge(from, to int, label string) {
+	w.g.Edges = append(w.g.Edges, &Edge{From: from, To: to, Label: label, Cycle: w.onStack[to]})
+}
+
+// member adds the value v, reached from the node parent by label, which may
+// be a Go value or a starlark value.
+func (w *grapher) member(parent int, label string, v interface{}) {
+	sv, ok := v.(starlark.Value)
+	if !ok {
+		w.goValue(parent, label, reflect.ValueOf(v))
+		return
+	}
+	switch sv := sv.(type) {
+	case *starlarkstruct.Module:
+		id := w.add(&Node{Kind: KindModule, Type: sv.Type()})
+		w.edge(parent, id, label)
+		w.onStack[id] = true
+		members := make(map[string]interface{}, len(sv.Members))
+		for k, m := range sv.Members {
+			members[k] = m
+		}
+		for _, k := range sortedKeys(members) {
+			w.member(id, k, members[k])
+		}
+		delete(w.onStack, id)
+	case *convert.GoStruct, *convert.GoCollection, *convert.GoIterableStruct, *convert.GoCallable, *convert.GoMap, *convert.GoSlice, *convert.GoInterface, *convert.GoChan, *convert.GoRecvChan:
+		w.goValue(parent, label, reflect.ValueOf(convert.FromValue(sv)))
+	case starlark.Callable:
+		w.edge(parent, w.add(&Node{Kind: KindBuiltin, Type: sv.Type()}), label)
+	default:
+		w.edge(parent, w.add(&Node{Kind: KindStarlark, Type: sv.Type()}), label)
+	}
+}
+
+// goValue adds the Go value v, reached from the node parent by label.
+func (w *grapher) goValue(parent int, label string, v reflect.Value) {
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || isNilValue(v) {
+		w.scalar(parent, label, "None")
+		return
+	}
+	if _, ok := v.Interface().(starlark.Value); ok {
+		w.member(parent, label, v.Interface())
+		return
+	}
+	kind, ok := nodeKind(v)
+	if !ok {
+		w.scalar(parent, label, scriptType(v))
+		return
+	}
+	var key nodeKey
+	identity := false
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Func, reflect.Chan:
+		key, identity = nodeKey{ptr: v.Pointer(), typ: v.Type()}, true
+	case reflect.Slice:
+		key, identity = nodeKey{ptr: v.Pointer(), typ: v.Type(), len: v.Len()}, true
+	}
+	if identity {
+		if id, ok := w.ids[key]; ok {
+			w.edge(parent, id, label)
+			return
+		}
+	}
+	n := &Node{Kind: kind, Type: scriptType(v), GoType: v.Type().String()}
+	for i := 0; i < v.NumMethod(); i++ {
+		n.Methods = append(n.Methods, convert.ScriptName(v.Type().Method(i).Name, w.opts...))
+	}
+	id := w.add(n)
+	if identity {
+		w.ids[key] = id
+	}
+	w.edge(parent, id, label)
+	w.onStack[id] = true
+	w.children(id, v)
+	delete(w.onStack, id)
+}
+
+// children adds the fields or elements of v to the node id.
+func (w *grapher) children(id int, v reflect.Value) {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	n := w.g.Nodes[id]
+	switch v.Kind() {
+	case reflect.Struct:
+		for _, f := range convert.ScriptFields(v.Type(), w.opts...) {
+			fv, err := v.FieldByIndexErr(f.Index)
+			if err != nil {
+				// promoted through a nil embedded pointer.
+				w.scalar(id, f.Name, "None")
+				continue
+			}
+			w.goValue(id, f.Name, fv)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if i == MaxGraphElems {
+				n.Truncated = v.Len() - i
+				break
+			}
+			w.goValue(id, fmt.Sprintf("[%d]", i), v.Index(i))
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for i, k := range keys {
+			if i == MaxGraphElems {
+				n.Truncated = len(keys) - i
+				break
+			}
+			w.goValue(id, fmt.Sprintf("[%#v]", k.Interface()), v.MapIndex(k))
+		}
+	}
+}
+
+func (w *grapher) scalar(parent int, label, typ string) {
+	n := w.g.Nodes[parent]
+	n.Scalars = append(n.Scalars, label+": "+typ)
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
+
+// nodeKind returns the node kind for v, or false if v is a scalar.
+func nodeKind(v reflect.Value) (string, bool) {
+	elem := v
+	if v.Kind() == reflect.Ptr {
+		elem = v.Elem()
+	}
+	switch elem.Kind() {
+	case reflect.Struct:
+		return KindStruct, true
+	case reflect.Map:
+		return KindMap, true
+	case reflect.Slice, reflect.Array:
+		return KindSlice, true
+	case reflect.Func:
+		return KindFunction, true
+	case reflect.Chan:
+		return KindChan, true
+	}
+	if v.NumMethod() > 0 {
+		return KindInterface, true
+	}
+	return "", false
+}
+
+// scriptType returns the type scripts see for v.
+func scriptType(v reflect.Value) string {
+	sv, err := convert.ToValue(v.Interface())
+	if err != nil {
+		return "unsupported"
+	}
+	return sv.Type()
+}
+
+// WriteJSON writes the graph as indented JSON.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// WriteDOT writes the graph in Graphviz's DOT language.  Shared values are
+// drawn with a double border, and edges that close cycles are dashed.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph starlight {")
+	fmt.Fprintln(bw, "\tnode [shape=record];")
+	for _, n := range g.Nodes {
+		fields := []string{dotEscape(n.Type)}
+		var lines []string
+		for _, s := range n.Scalars {
+			lines = append(lines, dotEscape(s)+`\l`)
+		}
+		for _, m := range n.Methods {
+			lines = append(lines, dotEscape(m+"()")+`\l`)
+		}
+		if n.Truncated > 0 {
+			lines = append(lines, fmt.Sprintf(`(%d more)\l`, n.Truncated))
+		}
+		if len(lines) > 0 {
+			fields = append(fields, strings.Join(lines, ""))
+		}
+		attrs := ""
+		if n.Shared {
+			attrs = ", peripheries=2"
+		}
+		fmt.Fprintf(bw, "\tn%d [label=\"{%s}\"%s];\n", n.ID, strings.Join(fields, "|"), attrs)
+	}
+	for _, e := range g.Edges {
+		attrs := ""
+		if e.Cycle {
+			attrs = ", style=dashed"
+		}
+		fmt.Fprintf(bw, "\tn%d -> n%d [label=%q%s];\n", e.From, e.To, e.Label, attrs)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// dotEscape escapes the characters that are special in record labels.
+func dotEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '{', '}', '|', '<', '>', '"', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
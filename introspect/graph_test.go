@@ -0,0 +1,106 @@
+package introspect_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/starlight-go/starlight/convert"
+	"github.com/starlight-go/starlight/introspect"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+type team struct {
+	Name    string
+	Lead    *member
+	Members []*member
+}
+
+type member struct {
+	Name string
+	Team *team
+}
+
+func TestMakeGraph(t *testing.T) {
+	lead := &member{Name: "bob"}
+	tm := &team{Name: "core", Lead: lead, Members: []*member{lead, {Name: "sue"}}}
+	lead.Team = tm
+	g := introspect.MakeGraph(map[string]interface{}{
+		"team": tm,
+		"mod": &starlarkstruct.Module{Name: "mod", Members: starlark.StringDict{
+			"len": starlark.Universe["len"],
+		}},
+	})
+
+	byLabel := map[string]*introspect.Edge{}
+	for _, e := range g.Edges {
+		byLabel[e.Label] = e
+	}
+	root := g.Nodes[0]
+	if root.Kind != introspect.KindGlobals {
+		t.Fatalf("expected first node to be the globals, got %#v", root)
+	}
+	teamNode := g.Nodes[byLabel["team"].To]
+	if teamNode.Kind != introspect.KindStruct || teamNode.Type != "go.struct<*introspect_test.team>" {
+		t.Errorf("unexpected team node %#v", teamNode)
+	}
+	if len(teamNode.Scalars) != 1 || teamNode.Scalars[0] != "Name: string" {
+		t.Errorf("unexpected team scalars %q", teamNode.Scalars)
+	}
+	leadNode := g.Nodes[byLabel["Lead"].To]
+	if !leadNode.Shared {
+		t.Error("expected the lead to be shared, since it is also a member")
+	}
+	if e := byLabel["Team"]; e == nil || !e.Cycle || e.To != teamNode.ID {
+		t.Errorf("expected Team to be a cycle back to the team, got %#v", e)
+	}
+	if n := g.Nodes[byLabel["len"].To]; n.Kind != introspect.KindBuiltin {
+		t.Errorf("expected len to be a builtin, got %#v", n)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	for _, s := range []string{
+		"digraph starlight {",
+		`label="{go.struct\<*introspect_test.team\>|Name: string\l}"`,
+		"peripheries=2",
+		`[label="Team", style=dashed]`,
+	} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("expected DOT output to contain %q:\n%s", s, dot)
+		}
+	}
+}
+
+func TestMakeGraphTruncates(t *testing.T) {
+	g := introspect.MakeGraph(map[string]interface{}{
+		"nums": make([]int, introspect.MaxGraphElems+5),
+	})
+	if n := g.Nodes[1]; n.Truncated != 5 || len(n.Scalars) != introspect.MaxGraphElems {
+		t.Fatalf("expected %d scalars and 5 truncated, got %d and %d", introspect.MaxGraphElems, len(n.Scalars), n.Truncated)
+	}
+}
+
+type profile struct {
+	*owner
+	Handle string `starlark:"handle"`
+	Token  string `starlark:"-"`
+}
+
+type owner struct {
+	Name string
+}
+
+func TestMakeGraphFieldNames(t *testing.T) {
+	g := introspect.MakeGraph(map[string]interface{}{"profile": &profile{}}, convert.Naming(strings.ToLower))
+	n := g.Nodes[1]
+	// the nil embedded owner's promoted Name is None, like nil pointer fields.
+	want := []string{"name: None", "handle: string"}
+	if strings.Join(n.Scalars, ", ") != strings.Join(want, ", ") {
+		t.Errorf("expected scalars %q, got %q", want, n.Scalars)
+	}
+}
@@ -0,0 +1,102 @@
+package introspect
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/starlight-go/starlight/convert"
+)
+
+// WriteStubs writes a .pyi style stub file describing the given globals, as
+// they will be seen by scripts, so that script authors can get autocompletion
+// and type hints in their editors.  Go structs and types with methods become
+// classes, Go functions become functions with positional parameters (Go
+// doesn't record parameter names, so they are named by position), and modules
+// become classes with a single instance.  The options are those the globals
+// are converted with, as for Describe.
+func WriteStubs(w io.Writer, globals map[string]interface{}, opts ...convert.Option) error {
+	env := Describe(globals, opts...)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# Code generated by starlight introspect. DO NOT EDIT.")
+	fmt.Fprintln(bw)
+	fmt.Fprintln(bw, "from typing import Any, Callable, Iterable")
+
+	for _, c := range env.Classes {
+		fmt.Fprintln(bw)
+		fmt.Fprintf(bw, "class %s:\n", c.Name)
+		fmt.Fprintf(bw, "    \"\"\"Go type %s.\"\"\"\n", c.GoType)
+		for _, f := range c.Fields {
+			fmt.Fprintf(bw, "    %s: %s\n", f.Name, f.Type)
+		}
+		for _, m := range c.Methods {
+			fmt.Fprintf(bw, "    def %s(self%s) -> %s: ...\n", m.Name, params(m.Func, true), m.Func.Result())
+		}
+	}
+
+	for _, sym := range env.Globals {
+		if sym.Kind == KindModule {
+			fmt.Fprintln(bw)
+			writeModule(bw, sym)
+		}
+	}
+	fmt.Fprintln(bw)
+	for _, sym := range env.Globals {
+		writeSymbol(bw, "", sym)
+	}
+	return bw.Flush()
+}
+
+func writeModule(w io.Writer, mod *Symbol) {
+	for _, m := range mod.Members {
+		if m.Kind == KindModule {
+			writeModule(w, m)
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprintf(w, "class %s:\n", moduleClass(mod))
+	if len(mod.Members) == 0 {
+		fmt.Fprintln(w, "    pass")
+	}
+	for _, m := range mod.Members {
+		writeSymbol(w, "    ", m)
+	}
+}
+
+func moduleClass(mod *Symbol) string {
+	return "_" + mod.Name + "_module"
+}
+
+func writeSymbol(w io.Writer, indent string, sym *Symbol) {
+	switch sym.Kind {
+	case KindModule:
+		fmt.Fprintf(w, "%s%s: %s\n", indent, sym.Name, moduleClass(sym))
+	case KindBuiltin:
+		fmt.Fprintf(w, "%sdef %s(*args: Any, **kwargs: Any) -> Any: ...\n", indent, sym.Name)
+	case KindFunction:
+		fmt.Fprintf(w, "%sdef %s(%s) -> %s: ...\n", indent, sym.Name, params(sym.Func, false), sym.Func.Result())
+	default:
+		fmt.Fprintf(w, "%s%s: %s\n", indent, sym.Name, sym.Type)
+	}
+}
+
+// params returns the parameter list of sig.  If method is true, the list
+// continues after self.
+func params(sig *Signature, method bool) string {
+	ps := make([]string, len(sig.Params))
+	for i, p := range sig.Params {
+		if sig.decls != nil {
+			ps[i] = sig.decls[i]
+		} else if sig.Variadic && i == len(sig.Params)-1 {
+			ps[i] = "*args: " + p
+		} else {
+			ps[i] = fmt.Sprintf("arg%d: %s", i, p)
+		}
+	}
+	s := strings.Join(ps, ", ")
+	if method && s != "" {
+		s = ", " + s
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package introspect_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/starlight-go/starlight/convert"
+	"github.com/starlight-go/starlight/introspect"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+type address struct {
+	Street string
+	Number int
+}
+
+type contact struct {
+	Name    string
+	Emails  []string
+	Address address
+	secret  string
+}
+
+func (c *contact) Greet(greeting string, times int) (string, error) {
+	return greeting + " " + c.Name, nil
+}
+
+func TestWriteStubs(t *testing.T) {
+	globals := map[string]interface{}{
+		"contact": &contact{},
+		"sprint":  fmt.Sprint,
+		"count":   5,
+		"store": &starlarkstruct.Module{Name: "store", Members: starlark.StringDict{
+			"get": convert.MakeStarFn("get", func(key string) (int, bool) { return 0, false }),
+		}},
+	}
+	var buf bytes.Buffer
+	if err := introspect.WriteStubs(&buf, globals); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# Code generated by starlight introspect. DO NOT EDIT.
+
+from typing import Any, Callable, Iterable
+
+class address:
+    """Go type introspect_test.address."""
+    Street: str
+    Number: int
+    def to_dict(self, omit_empty: bool = False) -> dict[str, Any]: ...
+
+class contact:
+    """Go type introspect_test.contact."""
+    Name: str
+    Emails: list[str]
+    Address: address
+    def Greet(self, arg0: str, arg1: int) -> str: ...
+    def to_dict(self, omit_empty: bool = False) -> dict[str, Any]: ...
+
+class _store_module:
+    def get(*args: Any, **kwargs: Any) -> Any: ...
+
+contact: contact
+count: int
+def sprint(*args: Any) -> str: ...
+store: _store_module
+`
+	if buf.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,103 @@
+// Package env provides an "env" module that gives scripts access to an
+// allowlist of environment variables and to metadata from the host, so scripts
+// can branch on their deployment environment without seeing the whole
+// environment.
+package env
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Module returns an "env" module with these members:
+//
+//	get(name, default=None)  returns the value of the allowed environment
+//	                         variable, or default if it is not set.  It fails
+//	                         for variables that are not allowed.
+//	names()                  returns the sorted names of the allowed variables
+//	                         that are set.
+//	meta                     the host's metadata, e.g. a struct with the
+//	                         service name and region, converted with
+//	                         convert.ToValue and frozen.  It is None if meta is
+//	                         nil.
+//
+// An allowed name ending in * allows every variable with that prefix, e.g.
+// "APP_*".  Variables are read when scripts ask for them.
+func Module(allow []string, meta interface{}) (*starlarkstruct.Module, error) {
+	m := starlark.Value(starlark.None)
+	if meta != nil {
+		v, err := convert.ToValue(meta)
+		if err != nil {
+			return nil, err
+		}
+		if m, err = convert.Transfer(v); err != nil {
+			return nil, err
+		}
+	}
+	e := &env{allow: allow}
+	return &starlarkstruct.Module{
+		Name: "env",
+		Members: starlark.StringDict{
+			"get":   starlark.NewBuiltin("get", e.get),
+			"names": starlark.NewBuiltin("names", e.names),
+			"meta":  m,
+		},
+	}, nil
+}
+
+type env struct {
+	allow []string
+}
+
+func (e *env) allowed(name string) bool {
+	for _, a := range e.allow {
+		if a == name || (strings.HasSuffix(a, "*") && strings.HasPrefix(name, a[:len(a)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *env) get(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var def starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "name", &name, "default?", &def); err != nil {
+		return nil, err
+	}
+	if !e.allowed(name) {
+		return nil, fmt.Errorf("%s: %q is not an allowed environment variable", fn.Name(), name)
+	}
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return def, nil
+	}
+	return starlark.String(v), nil
+}
+
+func (e *env) names(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, kv := range os.Environ() {
+		name := kv
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			name = kv[:i]
+		}
+		if e.allowed(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	vals := make([]starlark.Value, len(names))
+	for i, n := range names {
+		vals[i] = starlark.String(n)
+	}
+	return starlark.NewList(vals), nil
+}
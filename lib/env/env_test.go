@@ -0,0 +1,60 @@
+package env_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/lib/env"
+)
+
+type deployment struct {
+	Service string
+	Region  string
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv("STARLIGHT_TEST_STAGE", "prod")
+	t.Setenv("STARLIGHT_APP_A", "1")
+	t.Setenv("STARLIGHT_SECRET", "hunter2")
+	mod, err := env.Module(
+		[]string{"STARLIGHT_TEST_STAGE", "STARLIGHT_TEST_MISSING", "STARLIGHT_APP_*"},
+		deployment{Service: "api", Region: "eu"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals := map[string]interface{}{"env": mod}
+	out, err := starlight.Eval([]byte(`
+stage = env.get("STARLIGHT_TEST_STAGE")
+missing = env.get("STARLIGHT_TEST_MISSING", "dev")
+app = env.get("STARLIGHT_APP_A")
+names = env.names()
+region = env.meta.Region
+`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"stage":   "prod",
+		"missing": "dev",
+		"app":     "1",
+		"names":   []interface{}{"STARLIGHT_APP_A", "STARLIGHT_TEST_STAGE"},
+		"region":  "eu",
+	}
+	for k, v := range expected {
+		if !reflect.DeepEqual(out[k], v) {
+			t.Errorf("expected %s to be %#v, got %#v", k, v, out[k])
+		}
+	}
+
+	_, err = starlight.Eval([]byte(`env.get("STARLIGHT_SECRET")`), globals, nil)
+	if err == nil || !strings.Contains(err.Error(), "not an allowed environment variable") {
+		t.Fatalf("expected allowlist error, got %v", err)
+	}
+	_, err = starlight.Eval([]byte(`env.meta.Region = "us"`), globals, nil)
+	if err == nil || !strings.Contains(err.Error(), "frozen") {
+		t.Fatalf("expected frozen error, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Package locks provides mutexes and semaphores that hosts can share between
+// scripts running concurrently against the same Go values, so that the scripts
+// can coordinate their critical sections.
+package locks
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+// Semaphore is a counting semaphore for scripts.  Create one per shared
+// resource and pass the same value to every run that uses the resource.
+// Scripts use these methods:
+//
+//	acquire(timeout=None)  waits for a slot, returning True.  With a timeout in
+//	                       seconds, it returns False if no slot was free in
+//	                       time.
+//	release()              frees a slot taken by acquire.
+//	do(fn, *args, **kwargs)
+//	                       calls fn while holding a slot, and returns its
+//	                       result.  The slot is freed even if fn fails.
+//
+// Waiting stops with an error when the context of the run is done (see
+// convert.ThreadContext).  Semaphores are not reentrant: a script that
+// acquires a mutex it already holds waits forever, or until its run is
+// cancelled.
+type Semaphore struct {
+	name  string
+	slots chan struct{}
+}
+
+// NewSemaphore returns a semaphore that lets at most n holders in at once.  It
+// panics if n is less than 1.
+func NewSemaphore(n int) *Semaphore {
+	if n < 1 {
+		panic(fmt.Errorf("semaphore size must be at least 1, but was %d", n))
+	}
+	return &Semaphore{name: "semaphore", slots: make(chan struct{}, n)}
+}
+
+// NewMutex returns a semaphore that lets one holder in at a time.
+func NewMutex() *Semaphore {
+	return &Semaphore{name: "mutex", slots: make(chan struct{}, 1)}
+}
+
+// Attr returns the method with the given name.
+func (s *Semaphore) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "acquire":
+		return starlark.NewBuiltin(name, s.acquire), nil
+	case "release":
+		return starlark.NewBuiltin(name, s.release), nil
+	case "do":
+		return starlark.NewBuiltin(name, s.do), nil
+	}
+	return nil, nil
+}
+
+// AttrNames returns the names of the semaphore's methods.
+func (s *Semaphore) AttrNames() []string {
+	return []string{"acquire", "do", "release"}
+}
+
+func (s *Semaphore) acquire(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var timeout starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "timeout?", &timeout); err != nil {
+		return nil, err
+	}
+	var expired <-chan time.Time
+	if timeout != starlark.None {
+		secs, ok := starlark.AsFloat(timeout)
+		if !ok {
+			return nil, fmt.Errorf("%s: timeout must be a number, got %s", fn.Name(), timeout.Type())
+		}
+		t := time.NewTimer(time.Duration(secs * float64(time.Second)))
+		defer t.Stop()
+		expired = t.C
+	}
+	ctx := convert.ThreadContext(thread)
+	select {
+	case s.slots <- struct{}{}:
+		return starlark.True, nil
+	case <-expired:
+		return starlark.False, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %v", fn.Name(), ctx.Err())
+	}
+}
+
+func (s *Semaphore) release(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	select {
+	case <-s.slots:
+		return starlark.None, nil
+	default:
+		return nil, fmt.Errorf("%s: %s is not held", fn.Name(), s.name)
+	}
+}
+
+func (s *Semaphore) do(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s: missing function argument", fn.Name())
+	}
+	ctx := convert.ThreadContext(thread)
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %v", fn.Name(), ctx.Err())
+	}
+	defer func() { <-s.slots }()
+	return starlark.Call(thread, args[0], args[1:], kwargs)
+}
+
+// String returns the string representation of the value.
+func (s *Semaphore) String() string {
+	return fmt.Sprintf("<%s %d/%d>", s.name, len(s.slots), cap(s.slots))
+}
+
+// Type returns a short string describing the value's type.
+func (s *Semaphore) Type() string { return s.name }
+
+// Freeze is a no-op, semaphores are safe for concurrent use.
+func (s *Semaphore) Freeze() {}
+
+// Truth returns the truth value of an object.
+func (s *Semaphore) Truth() starlark.Bool { return true }
+
+// Hash returns a function of x such that Equals(x, y) => Hash(x) == Hash(y).
+func (s *Semaphore) Hash() (uint32, error) {
+	return 0, errors.New(s.name + " is not hashable")
+}
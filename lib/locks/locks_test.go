@@ -0,0 +1,77 @@
+package locks_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/lib/locks"
+)
+
+type counter struct {
+	N int
+}
+
+func TestMutexSerializesScripts(t *testing.T) {
+	c := &counter{}
+	mu := locks.NewMutex()
+	code := []byte(`
+def incr():
+    n = c.N
+    c.N = n + 1
+
+def run():
+    for i in range(100):
+        mu.do(incr)
+    mu.acquire()
+    c.N = c.N + 1
+    mu.release()
+
+run()
+`)
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := starlight.Eval(code, map[string]interface{}{"c": c, "mu": mu}, nil)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.N != 404 {
+		t.Fatalf("expected 404, got %d", c.N)
+	}
+}
+
+func TestSemaphoreTimeout(t *testing.T) {
+	sem := locks.NewSemaphore(2)
+	out, err := starlight.Eval([]byte(`
+a = sem.acquire()
+b = sem.acquire()
+c = sem.acquire(timeout=0.01)
+sem.release()
+d = sem.acquire(timeout=0.01)
+`), map[string]interface{}{"sem": sem}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["a"] != true || out["b"] != true || out["c"] != false || out["d"] != true {
+		t.Fatalf("unexpected results %v", out)
+	}
+}
+
+func TestReleaseNotHeld(t *testing.T) {
+	_, err := starlight.Eval([]byte(`mu.release()`), map[string]interface{}{"mu": locks.NewMutex()}, nil)
+	if err == nil || !strings.Contains(err.Error(), "release: mutex is not held") {
+		t.Fatalf("expected not held error, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package math provides a "math" module for scripts, made by wrapping the
+// functions and constants of Go's math package with convert.MakeStarFn.  Names
+// follow python's math module, e.g. sqrt, floor and pi.  Arguments may be ints
+// or floats; they are converted to the Go parameter types.
+package math
+
+import (
+	"math"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// functions maps script names to the Go functions they wrap.
+var functions = map[string]interface{}{
+	"abs":       math.Abs,
+	"acos":      math.Acos,
+	"acosh":     math.Acosh,
+	"asin":      math.Asin,
+	"asinh":     math.Asinh,
+	"atan":      math.Atan,
+	"atan2":     math.Atan2,
+	"atanh":     math.Atanh,
+	"cbrt":      math.Cbrt,
+	"ceil":      math.Ceil,
+	"copysign":  math.Copysign,
+	"cos":       math.Cos,
+	"cosh":      math.Cosh,
+	"dim":       math.Dim,
+	"erf":       math.Erf,
+	"erfc":      math.Erfc,
+	"exp":       math.Exp,
+	"exp2":      math.Exp2,
+	"expm1":     math.Expm1,
+	"floor":     math.Floor,
+	"fma":       math.FMA,
+	"frexp":     math.Frexp,
+	"gamma":     math.Gamma,
+	"hypot":     math.Hypot,
+	"inf":       math.Inf,
+	"isinf":     math.IsInf,
+	"isnan":     math.IsNaN,
+	"ldexp":     math.Ldexp,
+	"log":       math.Log,
+	"log10":     math.Log10,
+	"log1p":     math.Log1p,
+	"log2":      math.Log2,
+	"max":       math.Max,
+	"min":       math.Min,
+	"mod":       math.Mod,
+	"modf":      math.Modf,
+	"nan":       math.NaN,
+	"nextafter": math.Nextafter,
+	"pow":       math.Pow,
+	"remainder": math.Remainder,
+	"round":     math.Round,
+	"sin":       math.Sin,
+	"sinh":      math.Sinh,
+	"sqrt":      math.Sqrt,
+	"tan":       math.Tan,
+	"tanh":      math.Tanh,
+	"trunc":     math.Trunc,
+}
+
+// constants maps script names to the Go constants they expose.
+var constants = map[string]float64{
+	"e":              math.E,
+	"pi":             math.Pi,
+	"phi":            math.Phi,
+	"sqrt2":          math.Sqrt2,
+	"ln2":            math.Ln2,
+	"ln10":           math.Ln10,
+	"max_float":      math.MaxFloat64,
+	"smallest_float": math.SmallestNonzeroFloat64,
+	"tau":            2 * math.Pi,
+}
+
+// Module returns a new "math" module.
+func Module() *starlarkstruct.Module {
+	members := make(starlark.StringDict, len(functions)+len(constants))
+	for name, fn := range functions {
+		members[name] = convert.MakeStarFn(name, fn)
+	}
+	for name, c := range constants {
+		members[name] = starlark.Float(c)
+	}
+	return &starlarkstruct.Module{Name: "math", Members: members}
+}
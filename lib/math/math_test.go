@@ -0,0 +1,36 @@
+package math_test
+
+import (
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/lib/math"
+)
+
+func TestMath(t *testing.T) {
+	out, err := starlight.Eval([]byte(`
+root = math.sqrt(16)
+floor = math.floor(2.7)
+power = math.pow(2, 10)
+frac, exp = math.frexp(8)
+big = math.isinf(math.inf(1), 0)
+circle = math.round(math.pi * 100)
+`), map[string]interface{}{"math": math.Module()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"root":   4.0,
+		"floor":  2.0,
+		"power":  1024.0,
+		"frac":   0.5,
+		"exp":    int64(4),
+		"big":    true,
+		"circle": 314.0,
+	}
+	for k, v := range expected {
+		if out[k] != v {
+			t.Errorf("expected %s to be %#v, got %#v", k, v, out[k])
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package path provides a "path" module for scripts that manipulate file paths
+// but must stay inside a sandbox directory, such as build and deploy scripts.
+//
+// Scripts see slash-separated paths relative to the sandbox root; a leading
+// slash also means the root.  Paths that would leave the root, e.g. "../etc",
+// are errors, and globbing never returns files outside of it, even through
+// symlinks.
+package path
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Module returns a "path" module confined to the directory root, with these
+// functions:
+//
+//	join(*elems)           joins and cleans path elements
+//	clean(p)               returns the shortest equivalent of p
+//	base(p), dir(p), ext(p)
+//	                       return the parts of p, like Go's path package
+//	match(pattern, name)   reports whether name matches the shell pattern
+//	glob(pattern)          returns the sorted paths of the files under root
+//	                       that match pattern
+func Module(root string) (*starlarkstruct.Module, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	s := &sandbox{root: real}
+	return &starlarkstruct.Module{
+		Name: "path",
+		Members: starlark.StringDict{
+			"join":  starlark.NewBuiltin("join", s.join),
+			"clean": convert.MakeStarFn("clean", s.clean),
+			"base":  convert.MakeStarFn("base", path.Base),
+			"dir":   convert.MakeStarFn("dir", s.dir),
+			"ext":   convert.MakeStarFn("ext", path.Ext),
+			"match": convert.MakeStarFn("match", path.Match),
+			"glob":  convert.MakeStarFn("glob", s.glob),
+		},
+	}, nil
+}
+
+type sandbox struct {
+	root string
+}
+
+// clean cleans p as a path relative to the root, failing if it leaves the
+// root.
+func (s *sandbox) clean(p string) (string, error) {
+	rel := strings.TrimPrefix(p, "/")
+	c := path.Clean(rel)
+	if c == ".." || strings.HasPrefix(c, "../") {
+		return "", fmt.Errorf("path %q is outside of the sandbox", p)
+	}
+	return c, nil
+}
+
+func (s *sandbox) join(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("%s: unexpected keyword arguments", fn.Name())
+	}
+	elems := make([]string, len(args))
+	for i, a := range args {
+		str, ok := starlark.AsString(a)
+		if !ok {
+			return nil, fmt.Errorf("%s: element %d is %s, not a string", fn.Name(), i, a.Type())
+		}
+		elems[i] = str
+	}
+	p, err := s.clean(path.Join(elems...))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.String(p), nil
+}
+
+func (s *sandbox) dir(p string) (string, error) {
+	c, err := s.clean(p)
+	if err != nil {
+		return "", err
+	}
+	return path.Dir(c), nil
+}
+
+func (s *sandbox) glob(pattern string) ([]interface{}, error) {
+	c, err := s.clean(pattern)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(filepath.Join(s.root, filepath.FromSlash(c)))
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]interface{}, 0, len(matches))
+	sort.Strings(matches)
+	for _, m := range matches {
+		real, err := filepath.EvalSymlinks(m)
+		if err != nil || !s.contains(real) {
+			continue
+		}
+		rel, err := filepath.Rel(s.root, m)
+		if err != nil {
+			continue
+		}
+		ret = append(ret, filepath.ToSlash(rel))
+	}
+	return ret, nil
+}
+
+func (s *sandbox) contains(p string) bool {
+	rel, err := filepath.Rel(s.root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
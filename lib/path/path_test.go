@@ -0,0 +1,80 @@
+package path_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/lib/path"
+)
+
+func TestPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outside, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	for _, name := range []string{"a.go", "b.go", "sub/c.go", "readme.md"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.go"), filepath.Join(dir, "link.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	mod, err := path.Module(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals := map[string]interface{}{"path": mod}
+	out, err := starlight.Eval([]byte(`
+joined = path.join("sub", "x", "..", "c.go")
+cleaned = path.clean("/sub//c.go")
+gos = path.glob("*.go")
+nested = path.glob("sub/*.go")
+matched = path.match("*.go", "main.go")
+ext = path.ext(joined)
+dir = path.dir(joined)
+`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"joined":  "sub/c.go",
+		"cleaned": "sub/c.go",
+		"gos":     []interface{}{"a.go", "b.go"},
+		"nested":  []interface{}{"sub/c.go"},
+		"matched": true,
+		"ext":     ".go",
+		"dir":     "sub",
+	}
+	for k, v := range expected {
+		if !reflect.DeepEqual(out[k], v) {
+			t.Errorf("expected %s to be %#v, got %#v", k, v, out[k])
+		}
+	}
+
+	for _, code := range []string{`path.join("..", "etc")`, `path.glob("../*")`, `path.clean("a/../../b")`} {
+		_, err := starlight.Eval([]byte(code), globals, nil)
+		if err == nil || !strings.Contains(err.Error(), "outside of the sandbox") {
+			t.Errorf("%s: expected sandbox error, got %v", code, err)
+		}
+	}
+}
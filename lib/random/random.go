@@ -0,0 +1,111 @@
+// Package random provides a "random" module for scripts, backed by
+// math/rand/v2.  Hosts choose the source of randomness, so that scripts such as
+// simulations can be made reproducible by seeding it.
+package random
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Module returns a "random" module that draws from src, with these functions:
+//
+//	random()        returns a float in [0.0, 1.0)
+//	randint(a, b)   returns an int in [a, b], including both ends
+//	choice(seq)     returns a random element of a non-empty list, tuple, or
+//	                wrapped Go slice
+//	shuffle(list)   shuffles a list or wrapped Go slice in place
+//
+// The module is safe for concurrent use, though runs that share a module also
+// share its sequence of numbers.
+func Module(src rand.Source) *starlarkstruct.Module {
+	r := &random{rand: rand.New(src)}
+	return &starlarkstruct.Module{
+		Name: "random",
+		Members: starlark.StringDict{
+			"random":  starlark.NewBuiltin("random", r.random),
+			"randint": starlark.NewBuiltin("randint", r.randint),
+			"choice":  starlark.NewBuiltin("choice", r.choice),
+			"shuffle": starlark.NewBuiltin("shuffle", r.shuffle),
+		},
+	}
+}
+
+// Seeded returns a "random" module whose sequence of numbers is determined by
+// seed, so that runs using it are reproducible.
+func Seeded(seed uint64) *starlarkstruct.Module {
+	return Module(rand.NewPCG(seed, seed))
+}
+
+type random struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (r *random) random(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return starlark.Float(r.rand.Float64()), nil
+}
+
+func (r *random) randint(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var a, b int64
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &a, &b); err != nil {
+		return nil, err
+	}
+	if b < a {
+		return nil, fmt.Errorf("%s: empty range [%d, %d]", fn.Name(), a, b)
+	}
+	// The span is computed in uint64 so that wide ranges such as
+	// randint(-2**63, 2**63-1) don't overflow.
+	span := uint64(b) - uint64(a)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if span == math.MaxUint64 {
+		return starlark.MakeInt64(int64(r.rand.Uint64())), nil
+	}
+	return starlark.MakeInt64(a + int64(r.rand.Uint64N(span+1))), nil
+}
+
+func (r *random) choice(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var seq starlark.Indexable
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &seq); err != nil {
+		return nil, err
+	}
+	if seq.Len() == 0 {
+		return nil, fmt.Errorf("%s: empty sequence", fn.Name())
+	}
+	r.mu.Lock()
+	i := r.rand.IntN(seq.Len())
+	r.mu.Unlock()
+	return seq.Index(i), nil
+}
+
+func (r *random) shuffle(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var seq starlark.HasSetIndex
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &seq); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	perm := r.rand.Perm(seq.Len())
+	r.mu.Unlock()
+	// read everything first, since wrapped Go slices return live values.
+	vals := make([]starlark.Value, seq.Len())
+	for i := range vals {
+		vals[i] = seq.Index(i)
+	}
+	for i, j := range perm {
+		if err := seq.SetIndex(i, vals[j]); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+	}
+	return starlark.None, nil
+}
@@ -0,0 +1,90 @@
+package random_test
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/lib/random"
+)
+
+const script = `
+def run():
+    rolls = [random.randint(1, 6) for i in range(20)]
+    for r in rolls:
+        if r < 1 or r > 6:
+            fail("roll out of range: %d" % r)
+    f = random.random()
+    if f < 0 or f >= 1:
+        fail("random out of range: %f" % f)
+    names = ["a", "b", "c", "d"]
+    random.shuffle(names)
+    random.shuffle(nums)
+    return rolls, random.choice(names), names
+
+rolls, pick, names = run()
+`
+
+func runScript(t *testing.T, seed uint64) (map[string]interface{}, []int) {
+	nums := []int{1, 2, 3, 4, 5}
+	out, err := starlight.Eval([]byte(script), map[string]interface{}{
+		"random": random.Seeded(seed),
+		"nums":   nums,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(out, "run")
+	return out, nums
+}
+
+func TestSeededIsReproducible(t *testing.T) {
+	out1, nums1 := runScript(t, 42)
+	out2, nums2 := runScript(t, 42)
+	if !reflect.DeepEqual(out1, out2) || !reflect.DeepEqual(nums1, nums2) {
+		t.Fatalf("expected same results for the same seed, got %v %v and %v %v", out1, nums1, out2, nums2)
+	}
+	sorted := append([]int(nil), nums1...)
+	sort.Ints(sorted)
+	if !reflect.DeepEqual(sorted, []int{1, 2, 3, 4, 5}) {
+		t.Fatalf("shuffle lost elements: %v", nums1)
+	}
+}
+
+func TestChoiceEmpty(t *testing.T) {
+	_, err := starlight.Eval([]byte(`random.choice([])`), map[string]interface{}{"random": random.Seeded(1)}, nil)
+	if err == nil || err.Error() != "choice: empty sequence" {
+		t.Fatalf("expected empty sequence error, got %v", err)
+	}
+}
+
+func TestRandintWideRanges(t *testing.T) {
+	out, err := starlight.Eval([]byte(`
+full = [random.randint(lo, hi) for i in range(10)]
+top = [random.randint(hi-1, hi) for i in range(10)]
+bottom = [random.randint(lo, lo+1) for i in range(10)]
+same = random.randint(lo, lo)
+`), map[string]interface{}{
+		"random": random.Seeded(7),
+		"lo":     int64(math.MinInt64),
+		"hi":     int64(math.MaxInt64),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range out["top"].([]interface{}) {
+		if n := v.(int64); n < math.MaxInt64-1 {
+			t.Fatalf("randint(2**63-2, 2**63-1) returned %d", n)
+		}
+	}
+	for _, v := range out["bottom"].([]interface{}) {
+		if n := v.(int64); n > math.MinInt64+1 {
+			t.Fatalf("randint(-2**63, -2**63+1) returned %d", n)
+		}
+	}
+	if n := out["same"].(int64); n != math.MinInt64 {
+		t.Fatalf("randint(-2**63, -2**63) returned %d", n)
+	}
+}
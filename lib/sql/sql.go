@@ -0,0 +1,268 @@
+// Package sql provides an optional "sql" module that lets scripts run
+// parameterized queries against a database provided by the host.
+//
+// Query results are converted to lists of dicts of column names to values, or
+// to lists of Go structs of a type the host has registered.  Script arguments
+// are converted to Go values and passed to the driver as query parameters, so
+// scripts never need to build SQL from strings.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Config controls what scripts may do with the database.
+type Config struct {
+	// ReadOnly runs queries in read-only transactions and removes exec from
+	// the module.  The driver must support read-only transactions.
+	ReadOnly bool
+	// MaxRows makes queries that return more than MaxRows rows fail.  Zero
+	// means no limit.
+	MaxRows int
+	// Types maps names to struct values (or pointers to them) whose types
+	// scripts may ask for query results as, with query(..., into=name).
+	// Columns are matched to fields by their `db` tag, or else by
+	// case-insensitive field name.
+	Types map[string]interface{}
+}
+
+// Module returns a module named "sql" with these functions, which use db:
+//
+//	query(query, *args, into=None)  runs query with the given parameters and
+//	                                returns its rows, as dicts of column names
+//	                                to values, or as structs of the type
+//	                                registered under the name into.
+//	exec(query, *args)              runs a statement that returns no rows, and
+//	                                returns the number of rows affected.  It
+//	                                is not available if the config is
+//	                                ReadOnly.
+//
+// Queries are cancelled with the context of the run (see
+// convert.ThreadContext).
+func Module(db *sql.DB, cfg Config) (*starlarkstruct.Module, error) {
+	m := &module{db: db, cfg: cfg, types: map[string]reflect.Type{}}
+	for name, v := range cfg.Types {
+		t := reflect.TypeOf(v)
+		if t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t == nil || t.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("type %q is %T, not a struct", name, v)
+		}
+		m.types[name] = t
+	}
+	members := starlark.StringDict{
+		"query": starlark.NewBuiltin("query", m.query),
+	}
+	if !cfg.ReadOnly {
+		members["exec"] = starlark.NewBuiltin("exec", m.exec)
+	}
+	return &starlarkstruct.Module{Name: "sql", Members: members}, nil
+}
+
+type module struct {
+	db    *sql.DB
+	cfg   Config
+	types map[string]reflect.Type
+}
+
+// querier is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (m *module) query(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var into string
+	if err := starlark.UnpackArgs(fn.Name(), nil, kwargs, "into?", &into); err != nil {
+		return nil, err
+	}
+	query, params, err := unpack(fn, args)
+	if err != nil {
+		return nil, err
+	}
+	var typ reflect.Type
+	if into != "" {
+		var ok bool
+		if typ, ok = m.types[into]; !ok {
+			return nil, fmt.Errorf("%s: unknown type %q", fn.Name(), into)
+		}
+	}
+
+	ctx := convert.ThreadContext(thread)
+	var q querier = m.db
+	if m.cfg.ReadOnly {
+		tx, err := m.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		// nothing should have changed, so there is nothing to commit.
+		defer tx.Rollback()
+		q = tx
+	}
+	rows, err := q.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	defer rows.Close()
+
+	var results []interface{}
+	if typ == nil {
+		results, err = m.scanMaps(rows)
+	} else {
+		results, err = m.scanStructs(rows, typ)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	list := make([]starlark.Value, len(results))
+	for i, r := range results {
+		v, err := convert.ToValueWithOptions(r, convert.WithThread(thread))
+		if err != nil {
+			return nil, fmt.Errorf("%s: row %d: %v", fn.Name(), i, err)
+		}
+		list[i] = v
+	}
+	return starlark.NewList(list), nil
+}
+
+func (m *module) exec(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("%s: unexpected keyword arguments", fn.Name())
+	}
+	query, params, err := unpack(fn, args)
+	if err != nil {
+		return nil, err
+	}
+	res, err := m.db.ExecContext(convert.ThreadContext(thread), query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	return starlark.MakeInt64(n), nil
+}
+
+// unpack returns the query and the Go values of the parameters from args.
+func unpack(fn *starlark.Builtin, args starlark.Tuple) (string, []interface{}, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("%s: missing argument for query", fn.Name())
+	}
+	query, ok := starlark.AsString(args[0])
+	if !ok {
+		return "", nil, fmt.Errorf("%s: query must be a string, not %s", fn.Name(), args[0].Type())
+	}
+	params := make([]interface{}, len(args)-1)
+	for i, a := range args[1:] {
+		switch a := a.(type) {
+		case starlark.NoneType:
+			params[i] = nil
+		case starlark.Bytes:
+			params[i] = []byte(a)
+		default:
+			params[i] = convert.FromValue(a)
+		}
+	}
+	return query, params, nil
+}
+
+// checkLimit returns an error if n rows is too many.
+func (m *module) checkLimit(n int) error {
+	if m.cfg.MaxRows > 0 && n > m.cfg.MaxRows {
+		return fmt.Errorf("query returned more than %d rows", m.cfg.MaxRows)
+	}
+	return nil
+}
+
+func (m *module) scanMaps(rows *sql.Rows) ([]interface{}, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var results []interface{}
+	for rows.Next() {
+		if err := m.checkLimit(len(results) + 1); err != nil {
+			return nil, err
+		}
+		vals := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			// most drivers return text as bytes, which scripts expect as
+			// strings.
+			if b, ok := vals[i].([]byte); ok {
+				vals[i] = string(b)
+			}
+			row[col] = vals[i]
+		}
+		results = append(results, row)
+	}
+	return results, rows.Err()
+}
+
+func (m *module) scanStructs(rows *sql.Rows, typ reflect.Type) ([]interface{}, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	fields := make([][]int, len(cols))
+	for i, col := range cols {
+		f, ok := field(typ, col)
+		if !ok {
+			return nil, fmt.Errorf("column %q has no matching field in %s", col, typ)
+		}
+		fields[i] = f
+	}
+	var results []interface{}
+	for rows.Next() {
+		if err := m.checkLimit(len(results) + 1); err != nil {
+			return nil, err
+		}
+		v := reflect.New(typ)
+		ptrs := make([]interface{}, len(cols))
+		for i, f := range fields {
+			ptrs[i] = v.Elem().FieldByIndex(f).Addr().Interface()
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		results = append(results, v.Interface())
+	}
+	return results, rows.Err()
+}
+
+// field returns the index of the exported field of typ for the column.
+func field(typ reflect.Type, col string) ([]int, bool) {
+	var match []int
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if tag, ok := f.Tag.Lookup("db"); ok {
+			if tag == col {
+				return f.Index, true
+			}
+			continue
+		}
+		if match == nil && strings.EqualFold(f.Name, col) {
+			match = f.Index
+		}
+	}
+	return match, match != nil
+}
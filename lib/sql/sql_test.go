@@ -0,0 +1,171 @@
+package sql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	sqlmod "github.com/starlight-go/starlight/lib/sql"
+)
+
+// fakeDriver answers every query with the same users table, and records the
+// statements it is asked to run.
+type fakeDriver struct {
+	mu       sync.Mutex
+	args     []driver.Value
+	readOnly bool
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.d, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c *fakeConn) Commit() error                             { return nil }
+func (c *fakeConn) Rollback() error                           { return nil }
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.d.mu.Lock()
+	c.d.readOnly = opts.ReadOnly
+	c.d.mu.Unlock()
+	return c, nil
+}
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	s.d.args = args
+	s.d.mu.Unlock()
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	s.d.args = args
+	s.d.mu.Unlock()
+	if strings.Contains(s.query, "bad") {
+		return nil, fmt.Errorf("syntax error")
+	}
+	return &fakeRows{data: [][]driver.Value{
+		{int64(1), []byte("bob"), nil},
+		{int64(2), []byte("sue"), []byte("sue@example.com")},
+	}}, nil
+}
+
+type fakeRows struct {
+	data [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id", "name", "email_address"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.data) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.data[0])
+	r.data = r.data[1:]
+	return nil
+}
+
+var (
+	fake     = &fakeDriver{}
+	register sync.Once
+)
+
+func open(t *testing.T) *sql.DB {
+	register.Do(func() { sql.Register("starlight_fake", fake) })
+	db, err := sql.Open("starlight_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+type user struct {
+	ID    int64
+	Name  string
+	Email sql.NullString `db:"email_address"`
+}
+
+func TestQuery(t *testing.T) {
+	db := open(t)
+	defer db.Close()
+	m, err := sqlmod.Module(db, sqlmod.Config{Types: map[string]interface{}{"user": user{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := []byte(`
+rows = sql.query("select * from users where id > ? and name != ?", 0, None)
+names = [r["name"] for r in rows]
+email = rows[0]["email_address"]
+users = sql.query("select * from users", into="user")
+first = users[1].Name
+changed = sql.exec("update users set name = ? where id = ?", "bob", 1)
+`)
+	globals, err := starlight.Eval(code, map[string]interface{}{"sql": m}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := globals["names"]; !reflect.DeepEqual(names, []interface{}{"bob", "sue"}) {
+		t.Errorf("expected names to be bob and sue, got %#v", names)
+	}
+	if first := globals["first"]; first != "sue" {
+		t.Errorf("expected first to be sue, got %#v", first)
+	}
+	if changed := globals["changed"]; changed != int64(2) {
+		t.Errorf("expected 2 rows changed, got %#v", changed)
+	}
+	if !reflect.DeepEqual(fake.args, []driver.Value{"bob", int64(1)}) {
+		t.Errorf("unexpected exec args %#v", fake.args)
+	}
+}
+
+func TestGuards(t *testing.T) {
+	db := open(t)
+	defer db.Close()
+	m, err := sqlmod.Module(db, sqlmod.Config{ReadOnly: true, MaxRows: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		code, err string
+	}{
+		{`sql.exec("delete from users")`, "module has no .exec field or method"},
+		{`sql.query("select * from users")`, "query: query returned more than 1 rows"},
+		{`sql.query("bad")`, "query: syntax error"},
+		{`sql.query("select * from users", into="user")`, `query: unknown type "user"`},
+	}
+	for _, test := range tests {
+		_, err := starlight.Eval([]byte(test.code), map[string]interface{}{"sql": m}, nil)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, got %v", test.code, test.err, err)
+		}
+	}
+	if !fake.readOnly {
+		t.Error("expected queries to run in a read-only transaction")
+	}
+}
+
+func TestBadType(t *testing.T) {
+	_, err := sqlmod.Module(nil, sqlmod.Config{Types: map[string]interface{}{"n": 1}})
+	if err == nil {
+		t.Fatal("expected error registering a non-struct type")
+	}
+}
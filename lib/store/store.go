@@ -0,0 +1,309 @@
+// Package store provides an optional "store" module that lets scripts keep
+// values between runs.  The module is backed by a Backend, so hosts can keep
+// the values in memory, or persist them in a database such as bbolt or Redis
+// by implementing Backend over their client of choice.
+//
+// Values are stored as JSON, so scripts can store None, bools, numbers,
+// strings, and lists, tuples, sets and dicts of them, along with Go values that
+// convert to those.  Values come back as the JSON types they're stored as:
+// tuples and sets come back as lists, and dict keys as strings.  Ints come back
+// as ints of any size.  Lists and dicts that contain themselves can't be
+// stored.
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Backend persists the encoded values of a store.  Implementations must be
+// safe for concurrent use, since scripts run concurrently.
+type Backend interface {
+	// Get returns the value stored under key, and whether it was found.
+	Get(key string) ([]byte, bool, error)
+	// Put stores the value under key, replacing any existing value.
+	Put(key string, value []byte) error
+	// Delete removes key from the store.  It is not an error if the key
+	// doesn't exist.
+	Delete(key string) error
+	// List returns the keys that start with prefix, in any order.
+	List(prefix string) ([]string, error)
+}
+
+// Module returns a module named "store" with these functions, which read and
+// write values in b:
+//
+//	get(key, default=None)  returns the value stored under key, or default
+//	put(key, value)         stores value under key
+//	delete(key)             removes key
+//	list(prefix="")         returns the sorted keys starting with prefix
+func Module(b Backend) *starlarkstruct.Module {
+	return &starlarkstruct.Module{
+		Name: "store",
+		Members: starlark.StringDict{
+			"get": starlark.NewBuiltin("get", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var key string
+				var def starlark.Value = starlark.None
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key, "default?", &def); err != nil {
+					return nil, err
+				}
+				data, ok, err := b.Get(key)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+				}
+				if !ok {
+					return def, nil
+				}
+				v, err := decode(data)
+				if err != nil {
+					return nil, fmt.Errorf("%s: can't decode value of %q: %v", fn.Name(), key, err)
+				}
+				return v, nil
+			}),
+			"put": starlark.NewBuiltin("put", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var key string
+				var val starlark.Value
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key, "value", &val); err != nil {
+					return nil, err
+				}
+				data, err := encode(val)
+				if err != nil {
+					return nil, fmt.Errorf("%s: can't store value of %q: %v", fn.Name(), key, err)
+				}
+				if err := b.Put(key, data); err != nil {
+					return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+				}
+				return starlark.None, nil
+			}),
+			"delete": starlark.NewBuiltin("delete", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var key string
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key); err != nil {
+					return nil, err
+				}
+				if err := b.Delete(key); err != nil {
+					return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+				}
+				return starlark.None, nil
+			}),
+			"list": starlark.NewBuiltin("list", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				var prefix string
+				if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "prefix?", &prefix); err != nil {
+					return nil, err
+				}
+				keys, err := b.List(prefix)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+				}
+				sort.Strings(keys)
+				vals := make([]starlark.Value, len(keys))
+				for i, k := range keys {
+					vals[i] = starlark.String(k)
+				}
+				return starlark.NewList(vals), nil
+			}),
+		},
+	}
+}
+
+func encode(v starlark.Value) ([]byte, error) {
+	data, err := plain(v, map[starlark.Value]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
+
+// plain converts v into values encoding/json can encode.  onStack holds the
+// lists and dicts v is inside of, to catch values that contain themselves.
+func plain(v starlark.Value, onStack map[starlark.Value]bool) (interface{}, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return i, nil
+		}
+		// *big.Int encodes as a JSON number with all its digits.
+		return v.BigInt(), nil
+	case *starlark.List:
+		if err := enter(v, onStack); err != nil {
+			return nil, err
+		}
+		defer delete(onStack, v)
+		return plainElems(v, onStack)
+	case starlark.Tuple, *starlark.Set:
+		return plainElems(v.(starlark.Iterable), onStack)
+	case *starlark.Dict:
+		if err := enter(v, onStack); err != nil {
+			return nil, err
+		}
+		defer delete(onStack, v)
+		ret := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			k, err := convert.FromValueErr(item[0])
+			if err != nil {
+				return nil, err
+			}
+			p, err := plain(item[1], onStack)
+			if err != nil {
+				return nil, err
+			}
+			ret[fmt.Sprint(k)] = p
+		}
+		return ret, nil
+	}
+	g, err := convert.FromValueErr(v)
+	if err != nil {
+		return nil, err
+	}
+	if g, ok := g.(starlark.Value); ok {
+		return nil, fmt.Errorf("can't store value of type %s", g.Type())
+	}
+	return g, nil
+}
+
+// enter adds the list or dict v to onStack, or returns an error if it's
+// already there, since then v contains itself.
+func enter(v starlark.Value, onStack map[starlark.Value]bool) error {
+	if onStack[v] {
+		return fmt.Errorf("can't store %s that contains itself", v.Type())
+	}
+	onStack[v] = true
+	return nil
+}
+
+// plainElems converts the elements of a list, tuple or set into a slice that
+// encoding/json can encode.
+func plainElems(v starlark.Iterable, onStack map[starlark.Value]bool) ([]interface{}, error) {
+	ret := []interface{}{}
+	iter := v.Iterate()
+	defer iter.Done()
+	var elem starlark.Value
+	for iter.Next(&elem) {
+		p, err := plain(elem, onStack)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
+func decode(data []byte) (starlark.Value, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return toValue(v)
+}
+
+// toValue converts decoded JSON into starlark values, keeping integers as ints
+// of any size.
+func toValue(v interface{}) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return starlark.MakeInt64(i), nil
+		}
+		// ints too big for an int64 are stored with all their digits.
+		if i, ok := new(big.Int).SetString(string(v), 10); ok {
+			return starlark.MakeBigInt(i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return starlark.Float(f), nil
+	case []interface{}:
+		vals := make([]starlark.Value, len(v))
+		for i := range v {
+			val, err := toValue(v[i])
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = val
+		}
+		return starlark.NewList(vals), nil
+	case map[string]interface{}:
+		d := starlark.NewDict(len(v))
+		for k, val := range v {
+			sv, err := toValue(val)
+			if err != nil {
+				return nil, err
+			}
+			if err := d.SetKey(starlark.String(k), sv); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	}
+	return convert.ToValue(v)
+}
+
+// Memory is a Backend that keeps values in memory, for hosts that only need
+// values to outlive a single run, and for tests.
+type Memory struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemory returns an empty in-memory Backend.
+func NewMemory() *Memory {
+	return &Memory{data: map[string][]byte{}}
+}
+
+// Get implements Backend.
+func (m *Memory) Get(key string) ([]byte, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v, ok := m.data[key]
+	return v, ok, nil
+}
+
+// Put implements Backend.
+func (m *Memory) Put(key string, value []byte) error {
+	m.mu.Lock()
+	m.data[key] = append([]byte(nil), value...)
+	m.mu.Unlock()
+	return nil
+}
+
+// Delete implements Backend.
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	delete(m.data, key)
+	m.mu.Unlock()
+	return nil
+}
+
+// List implements Backend.
+func (m *Memory) List(prefix string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var keys []string
+	for k := range m.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
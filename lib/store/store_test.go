@@ -0,0 +1,118 @@
+package store_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/lib/store"
+)
+
+type visit struct {
+	Page  string
+	Count int
+}
+
+func TestStoreAcrossRuns(t *testing.T) {
+	globals := map[string]interface{}{
+		"store": store.Module(store.NewMemory()),
+		"visit": visit{Page: "home", Count: 3},
+	}
+	_, err := starlight.Eval([]byte(`
+store.put("count", 1)
+store.put("user:bob", {"name": "bob", "tags": ["a", "b"], "score": 1.5})
+store.put("user:alice", None)
+store.put("visit", [visit.Page, visit.Count])
+`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := starlight.Eval([]byte(`
+count = store.get("count") + 1
+user = store.get("user:bob")
+bob = [user["name"], user["tags"], user["score"]]
+users = store.list("user:")
+store.delete("user:alice")
+missing = store.get("user:alice", "gone")
+visit = store.get("visit")
+`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["count"] != int64(2) {
+		t.Errorf("expected count 2, got %#v", out["count"])
+	}
+	expected := []interface{}{"bob", []interface{}{"a", "b"}, 1.5}
+	if !reflect.DeepEqual(out["bob"], expected) {
+		t.Errorf("expected %#v, got %#v", expected, out["bob"])
+	}
+	if !reflect.DeepEqual(out["users"], []interface{}{"user:alice", "user:bob"}) {
+		t.Errorf("unexpected users %#v", out["users"])
+	}
+	if out["missing"] != "gone" {
+		t.Errorf(`expected "gone", got %#v`, out["missing"])
+	}
+	if !reflect.DeepEqual(out["visit"], []interface{}{"home", int64(3)}) {
+		t.Errorf("unexpected visit %#v", out["visit"])
+	}
+}
+
+func TestStoreUnsupportedValue(t *testing.T) {
+	globals := map[string]interface{}{"store": store.Module(store.NewMemory())}
+	_, err := starlight.Eval([]byte(`store.put("f", len)`), globals, nil)
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	expected := `put: can't store value of "f": can't store value of type builtin_function_or_method`
+	if err.Error() != expected {
+		t.Fatalf("expected error %q, got %q", expected, err)
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	globals := map[string]interface{}{"store": store.Module(store.NewMemory())}
+	_, err := starlight.Eval([]byte(`
+store.put("big", 123456789012345678901234567890)
+store.put("neg", -123456789012345678901234567890)
+store.put("shapes", {"tuple": (1, 2), "set": set(["a"])})
+`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = starlight.Eval([]byte(`
+def check():
+	big = store.get("big")
+	if big != 123456789012345678901234567890 or type(big) != "int":
+		fail("unexpected big int", big)
+	if store.get("neg") != -123456789012345678901234567890:
+		fail("unexpected negative big int", store.get("neg"))
+	# tuples and sets come back as lists.
+	if store.get("shapes") != {"tuple": [1, 2], "set": ["a"]}:
+		fail("unexpected shapes", store.get("shapes"))
+check()
+`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreCycles(t *testing.T) {
+	globals := map[string]interface{}{"store": store.Module(store.NewMemory())}
+	tests := []struct {
+		code, err string
+	}{
+		{"x = [1]\nx.append(x)\nstore.put('x', x)", `put: can't store value of "x": can't store list that contains itself`},
+		{"d = {}\nd['self'] = [d]\nstore.put('d', d)", `put: can't store value of "d": can't store dict that contains itself`},
+	}
+	for _, test := range tests {
+		_, err := starlight.Eval([]byte(test.code), globals, nil)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("expected error %q, got %v", test.err, err)
+		}
+	}
+	// the same list can be stored twice, as long as it doesn't contain itself.
+	if _, err := starlight.Eval([]byte("x = [1]\nstore.put('x', [x, x])"), globals, nil); err != nil {
+		t.Fatal(err)
+	}
+}
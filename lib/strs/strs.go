@@ -0,0 +1,95 @@
+// Package strs provides a "strs" module of string utilities for scripts,
+// wrapped from Go's strings and unicode packages with convert.MakeStarFn.  It
+// fills the everyday gaps in starlark's string methods, such as cutting,
+// splitting on whitespace runs, and case-insensitive comparison.  Names are the
+// Go names in snake case, e.g. has_prefix and equal_fold.
+package strs
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// functions maps script names to the Go functions they wrap.
+var functions = map[string]interface{}{
+	"contains":     strings.Contains,
+	"contains_any": strings.ContainsAny,
+	"count":        strings.Count,
+	"cut":          strings.Cut,
+	"equal_fold":   strings.EqualFold,
+	"fields":       strings.Fields,
+	"has_prefix":   strings.HasPrefix,
+	"has_suffix":   strings.HasSuffix,
+	"index":        strings.Index,
+	"join":         join,
+	"last_index":   strings.LastIndex,
+	"repeat":       strings.Repeat,
+	"replace":      strings.Replace,
+	"replace_all":  strings.ReplaceAll,
+	"split":        strings.Split,
+	"split_n":      strings.SplitN,
+	"to_lower":     strings.ToLower,
+	"to_title":     strings.ToTitle,
+	"to_upper":     strings.ToUpper,
+	"trim":         strings.Trim,
+	"trim_left":    strings.TrimLeft,
+	"trim_prefix":  strings.TrimPrefix,
+	"trim_right":   strings.TrimRight,
+	"trim_space":   strings.TrimSpace,
+	"trim_suffix":  strings.TrimSuffix,
+
+	"is_digit":  all(unicode.IsDigit),
+	"is_letter": all(unicode.IsLetter),
+	"is_lower":  all(unicode.IsLower),
+	"is_space":  all(unicode.IsSpace),
+	"is_upper":  all(unicode.IsUpper),
+}
+
+// Module returns a new "strs" module.
+func Module() *starlarkstruct.Module {
+	members := make(starlark.StringDict, len(functions))
+	for name, fn := range functions {
+		members[name] = convert.MakeStarFn(name, fn)
+	}
+	return &starlarkstruct.Module{Name: "strs", Members: members}
+}
+
+// join is strings.Join for any list of strings a script may pass, which are
+// converted to []interface{} rather than []string.
+func join(elems interface{}, sep string) (string, error) {
+	var strs []string
+	switch elems := elems.(type) {
+	case []string:
+		strs = elems
+	case []interface{}:
+		strs = make([]string, len(elems))
+		for i, e := range elems {
+			s, ok := e.(string)
+			if !ok {
+				return "", fmt.Errorf("join: element %d is %T, not a string", i, e)
+			}
+			strs[i] = s
+		}
+	default:
+		return "", fmt.Errorf("join: expected a list of strings, got %T", elems)
+	}
+	return strings.Join(strs, sep), nil
+}
+
+// all turns a unicode rune class function into one that reports whether a
+// string is non-empty and made up only of runes in the class.
+func all(is func(rune) bool) func(string) bool {
+	return func(s string) bool {
+		for _, r := range s {
+			if !is(r) {
+				return false
+			}
+		}
+		return s != ""
+	}
+}
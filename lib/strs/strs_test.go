@@ -0,0 +1,52 @@
+package strs_test
+
+import (
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/lib/strs"
+)
+
+func TestStrs(t *testing.T) {
+	out, err := starlight.Eval([]byte(`
+fields = strs.join(strs.fields("  a  b c "), ",")
+parts = len(strs.split("a/b/c", "/"))
+before, after, found = strs.cut("key=value", "=")
+same = strs.equal_fold("Go", "GO")
+trimmed = strs.trim_suffix(strs.trim_space("  main.go "), ".go")
+upper = strs.to_upper("hi")
+digits = strs.is_digit("123")
+empty = strs.is_digit("")
+replaced = strs.replace("aaa", "a", "b", 2)
+joined = strs.join(["x", "y"], "-")
+`), map[string]interface{}{"strs": strs.Module()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"fields":   "a,b,c",
+		"parts":    int64(3),
+		"before":   "key",
+		"after":    "value",
+		"found":    true,
+		"same":     true,
+		"trimmed":  "main",
+		"upper":    "HI",
+		"digits":   true,
+		"empty":    false,
+		"replaced": "bba",
+		"joined":   "x-y",
+	}
+	for k, v := range expected {
+		if out[k] != v {
+			t.Errorf("expected %s to be %#v, got %#v", k, v, out[k])
+		}
+	}
+}
+
+func TestJoinNonString(t *testing.T) {
+	_, err := starlight.Eval([]byte(`strs.join(["a", 1], ",")`), map[string]interface{}{"strs": strs.Module()}, nil)
+	if err == nil || err.Error() != "join: element 1 is int64, not a string" {
+		t.Fatalf("expected element error, got %v", err)
+	}
+}
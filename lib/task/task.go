@@ -0,0 +1,183 @@
+// Package task provides an opt-in spawn builtin, which lets scripts run
+// functions in the background and wait for their results, e.g. to call several
+// slow host functions in parallel.
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+// Spawn returns a builtin called spawn, which scripts call as spawn(fn, *args,
+// **kwargs) to run fn on a new goroutine, with its own starlark thread.  spawn
+// returns a future, with these methods:
+//
+//	wait(timeout=None)  waits for fn to finish and returns its result, or
+//	                    fails with its error.  With a timeout in seconds, it
+//	                    fails if fn hasn't finished in time.
+//	done()              reports whether fn has finished.
+//
+// At most limit functions run at once; spawn blocks until a slot is free.  A
+// limit less than 1 means no limit.  The arguments and results are passed
+// between threads with convert.Transfer, so they are frozen copies.  Since fn
+// may run while the spawning script is still running, it should not use
+// globals that the script changes.  Spawned threads are cancelled when the
+// context of the spawning thread (see convert.SetThreadContext) is done.
+func Spawn(limit int) *starlark.Builtin {
+	var slots chan struct{}
+	if limit > 0 {
+		slots = make(chan struct{}, limit)
+	}
+	return starlark.NewBuiltin("spawn", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s: missing function argument", fn.Name())
+		}
+		call, ok := args[0].(starlark.Callable)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected callable, got %s", fn.Name(), args[0].Type())
+		}
+		targs, err := transferTuple(args[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		tkwargs := make([]starlark.Tuple, len(kwargs))
+		for i, kv := range kwargs {
+			if tkwargs[i], err = transferTuple(kv); err != nil {
+				return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+			}
+		}
+		if _, err := convert.Transfer(call); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+
+		ctx, cancel := context.WithCancel(convert.ThreadContext(thread))
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				cancel()
+				return nil, fmt.Errorf("%s: %v", fn.Name(), ctx.Err())
+			}
+		}
+
+		child := &starlark.Thread{
+			Name:  thread.Name + "/spawn",
+			Print: thread.Print,
+			Load:  thread.Load,
+		}
+		convert.SetThreadContext(child, ctx)
+		f := &future{done: make(chan struct{}), cancel: cancel}
+		go func() {
+			select {
+			case <-ctx.Done():
+				child.Cancel(ctx.Err().Error())
+			case <-f.done:
+			}
+		}()
+		go func() {
+			defer cancel()
+			if slots != nil {
+				defer func() { <-slots }()
+			}
+			defer close(f.done)
+			v, err := starlark.Call(child, call, targs, tkwargs)
+			if err == nil {
+				v, err = convert.Transfer(v)
+			}
+			f.val, f.err = v, err
+		}()
+		return f, nil
+	})
+}
+
+func transferTuple(t starlark.Tuple) (starlark.Tuple, error) {
+	ret := make(starlark.Tuple, len(t))
+	for i, v := range t {
+		tv, err := convert.Transfer(v)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = tv
+	}
+	return ret, nil
+}
+
+// future is the result of a spawned function.
+type future struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	val    starlark.Value
+	err    error
+}
+
+// Attr returns the method with the given name.
+func (f *future) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "wait":
+		return starlark.NewBuiltin("wait", f.wait), nil
+	case "done":
+		return starlark.NewBuiltin("done", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+				return nil, err
+			}
+			select {
+			case <-f.done:
+				return starlark.True, nil
+			default:
+				return starlark.False, nil
+			}
+		}), nil
+	}
+	return nil, nil
+}
+
+func (f *future) wait(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var timeout starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "timeout?", &timeout); err != nil {
+		return nil, err
+	}
+	var expired <-chan time.Time
+	if timeout != starlark.None {
+		secs, ok := starlark.AsFloat(timeout)
+		if !ok {
+			return nil, fmt.Errorf("%s: timeout must be a number, got %s", fn.Name(), timeout.Type())
+		}
+		t := time.NewTimer(time.Duration(secs * float64(time.Second)))
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-expired:
+		return nil, fmt.Errorf("%s: timed out", fn.Name())
+	case <-convert.ThreadContext(thread).Done():
+		f.cancel()
+		return nil, fmt.Errorf("%s: %v", fn.Name(), convert.ThreadContext(thread).Err())
+	}
+}
+
+// AttrNames returns the names of the future's methods.
+func (f *future) AttrNames() []string {
+	return []string{"done", "wait"}
+}
+
+// String returns the string representation of the value.
+func (f *future) String() string { return "<future>" }
+
+// Type returns a short string describing the value's type.
+func (f *future) Type() string { return "future" }
+
+// Freeze is a no-op, futures are safe for concurrent use.
+func (f *future) Freeze() {}
+
+// Truth returns the truth value of an object.
+func (f *future) Truth() starlark.Bool { return true }
+
+// Hash returns a function of x such that Equals(x, y) => Hash(x) == Hash(y).
+func (f *future) Hash() (uint32, error) { return 0, errors.New("future is not hashable") }
@@ -0,0 +1,103 @@
+package task_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+	"github.com/starlight-go/starlight/lib/task"
+	"go.starlark.net/starlark"
+)
+
+func TestSpawn(t *testing.T) {
+	var running, most int32
+	slow := func(n int64) int64 {
+		cur := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if cur <= m || atomic.CompareAndSwapInt32(&most, m, cur) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return n * 2
+	}
+	globals := map[string]interface{}{
+		"spawn": task.Spawn(2),
+		"slow":  slow,
+	}
+	out, err := starlight.Eval([]byte(`
+def double(n, extra=0):
+    return slow(n) + extra
+
+futures = [spawn(double, n, extra=1) for n in range(5)]
+results = [f.wait() for f in futures]
+done = futures[0].done()
+`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{int64(1), int64(3), int64(5), int64(7), int64(9)}
+	assertEq(t, expected, out["results"])
+	assertEq(t, true, out["done"])
+	if most > 2 {
+		t.Fatalf("expected at most 2 concurrent calls, got %d", most)
+	}
+}
+
+func TestSpawnError(t *testing.T) {
+	globals := map[string]interface{}{"spawn": task.Spawn(0)}
+	_, err := starlight.Eval([]byte(`
+def boom():
+    fail("boom")
+
+spawn(boom).wait()
+`), globals, nil)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expected boom error, got %v", err)
+	}
+}
+
+func TestSpawnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	thread := &starlark.Thread{}
+	convert.SetThreadContext(thread, ctx)
+	globals := starlark.StringDict{"spawn": task.Spawn(0)}
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := starlark.ExecFile(thread, "test.star", `
+def forever():
+    for i in range(1000000000):
+        pass
+
+f = spawn(forever)
+f.wait()
+`, globals)
+	if err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	globals := map[string]interface{}{
+		"spawn": task.Spawn(0),
+		"sleep": func() { time.Sleep(50 * time.Millisecond) },
+	}
+	_, err := starlight.Eval([]byte(`spawn(sleep).wait(timeout=0.001)`), globals, nil)
+	if err == nil || !strings.Contains(err.Error(), "wait: timed out") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
+
+func assertEq(t *testing.T, expected, got interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %#v, got %#v", expected, got)
+	}
+}
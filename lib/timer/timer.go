@@ -0,0 +1,87 @@
+// Package timer provides a "timer" module with sleep and deadline helpers for
+// scripts, e.g. for waiting between retries.  The helpers honor the context of
+// the run (see starlight.EvalContext and convert.ThreadContext), so a sleeping
+// script can still be cancelled, and never sleeps past the run's deadline.
+package timer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Module returns a module named "timer" with these functions:
+//
+//	sleep(seconds)  pauses the script.  It fails with the context's error if
+//	                the run is cancelled, or if its deadline would pass
+//	                before the sleep is over (after waiting until then).
+//	remaining()     returns the seconds left until the run's deadline, as a
+//	                float, or None if the run has no deadline.
+//
+// Time spent sleeping does not count towards the thread's execution steps.
+func Module() *starlarkstruct.Module {
+	return &starlarkstruct.Module{
+		Name: "timer",
+		Members: starlark.StringDict{
+			"sleep":     starlark.NewBuiltin("sleep", sleep),
+			"remaining": starlark.NewBuiltin("remaining", remaining),
+		},
+	}
+}
+
+func sleep(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var secs starlark.Value
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "seconds", &secs); err != nil {
+		return nil, err
+	}
+	f, ok := starlark.AsFloat(secs)
+	if !ok {
+		return nil, fmt.Errorf("%s: seconds must be a number, got %s", fn.Name(), secs.Type())
+	}
+	if f < 0 {
+		return nil, fmt.Errorf("%s: seconds must not be negative", fn.Name())
+	}
+	ctx := convert.ThreadContext(thread)
+	d := time.Duration(f * float64(time.Second))
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		// no point waiting for a sleep that can't finish, wait for the
+		// deadline instead so the error comes at the usual time.
+		d = time.Until(deadline)
+		if d < 0 {
+			d = 0
+		}
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+		}
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%s: %v", fn.Name(), context.DeadlineExceeded)
+		}
+		return starlark.None, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %v", fn.Name(), ctx.Err())
+	}
+}
+
+func remaining(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	deadline, ok := convert.ThreadContext(thread).Deadline()
+	if !ok {
+		return starlark.None, nil
+	}
+	left := time.Until(deadline)
+	if left < 0 {
+		left = 0
+	}
+	return starlark.Float(left.Seconds()), nil
+}
@@ -0,0 +1,60 @@
+package timer_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/lib/timer"
+)
+
+func TestSleep(t *testing.T) {
+	globals := map[string]interface{}{"timer": timer.Module()}
+	start := time.Now()
+	out, err := starlight.Eval([]byte(`
+timer.sleep(0.01)
+no_deadline = timer.remaining() == None
+`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 10*time.Millisecond {
+		t.Fatal("expected sleep to take at least 10ms")
+	}
+	if out["no_deadline"] != true {
+		t.Fatal("expected no deadline")
+	}
+}
+
+func TestSleepPastDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	globals := map[string]interface{}{"timer": timer.Module()}
+	start := time.Now()
+	_, err := starlight.EvalContext(ctx, []byte(`
+def run():
+    if timer.remaining() > 1:
+        fail("too much time left")
+    timer.sleep(60)
+
+run()
+`), globals, nil)
+	if err == nil || !strings.Contains(err.Error(), "sleep: context deadline exceeded") {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("sleep waited past the deadline")
+	}
+}
+
+func TestSleepCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	globals := map[string]interface{}{"timer": timer.Module()}
+	_, err := starlight.EvalContext(ctx, []byte(`timer.sleep(60)`), globals, nil)
+	if err == nil || !strings.Contains(err.Error(), "sleep: context canceled") {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+}
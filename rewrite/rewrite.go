@@ -0,0 +1,223 @@
+// Package rewrite updates starlight scripts after the Go values exposed to them
+// have been renamed, so that renaming a Go field or function doesn't strand the
+// scripts that use it.
+package rewrite
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/syntax"
+)
+
+func init() {
+	resolve.AllowNestedDef = true // allow def statements within function bodies
+	resolve.AllowLambda = true    // allow lambda expressions
+	resolve.AllowFloat = true     // allow floating point literals, the 'float' built-in, and x / y
+	resolve.AllowSet = true       // allow the 'set' built-in
+	resolve.AllowBitwise = true   // allow bitwise operations
+}
+
+// Renames maps old names to new names.  There are three forms of key:
+//
+//	"name"         renames the global name wherever the script refers to it,
+//	               unless the script defines its own variable of that name.
+//	"global.Attr"  renames the attribute Attr where it is accessed directly on
+//	               the global (e.g. global.Attr or global.Other.Attr for the
+//	               key "global.Other.Attr").
+//	".Attr"        renames every attribute named Attr, whatever the receiver.
+//
+// Only the last element of a key is renamed, so the new name is a single
+// identifier, e.g. {"contact.Name": "FullName"}.
+type Renames map[string]string
+
+// Site is a reference that might need renaming, but that can't be rewritten
+// safely, such as an attribute accessed on a local variable that may hold a
+// renamed global.
+type Site struct {
+	Pos    syntax.Position
+	Name   string
+	Reason string
+}
+
+// String returns the site in the usual file:line:col: message format.
+func (s Site) String() string {
+	return fmt.Sprintf("%s: %s: %s", s.Pos, s.Name, s.Reason)
+}
+
+// Source rewrites the references to renamed names in the script src, leaving
+// the rest of the source exactly as it was.  It returns the rewritten source
+// and the sites it found ambiguous, which are not rewritten and should be
+// checked by hand.
+func Source(filename string, src []byte, renames Renames) ([]byte, []Site, error) {
+	f, err := syntax.Parse(filename, src, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Names not defined by the script are assumed to be globals from Go.
+	always := func(string) bool { return true }
+	if err := resolve.File(f, always, always); err != nil {
+		return nil, nil, err
+	}
+
+	r := &rewriter{renames: renames, attrs: map[string]bool{}}
+	for key := range renames {
+		if i := strings.LastIndexByte(key, '.'); i >= 0 {
+			r.attrs[key[i+1:]] = true
+		}
+	}
+	syntax.Walk(f, r.visit)
+
+	out, err := apply(src, r.edits)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(r.sites, func(i, j int) bool {
+		a, b := r.sites[i].Pos, r.sites[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+	return out, r.sites, nil
+}
+
+type edit struct {
+	pos  syntax.Position
+	old  string
+	name string
+}
+
+type rewriter struct {
+	renames Renames
+	// attrs holds the attribute names that are renamed for some receiver.
+	attrs map[string]bool
+	edits []edit
+	sites []Site
+}
+
+func (r *rewriter) visit(n syntax.Node) bool {
+	switch n := n.(type) {
+	case *syntax.Ident:
+		b, ok := n.Binding.(*resolve.Binding)
+		if !ok || (b.Scope != resolve.Predeclared && b.Scope != resolve.Universal) {
+			return true
+		}
+		if name, ok := r.renames[n.Name]; ok {
+			r.edits = append(r.edits, edit{pos: n.NamePos, old: n.Name, name: name})
+		}
+	case *syntax.DotExpr:
+		r.dot(n)
+	case *syntax.CallExpr:
+		r.call(n)
+	}
+	return true
+}
+
+func (r *rewriter) dot(n *syntax.DotExpr) {
+	attr := n.Name.Name
+	if !r.attrs[attr] {
+		return
+	}
+	if name, ok := r.renames["."+attr]; ok {
+		r.edits = append(r.edits, edit{pos: n.Name.NamePos, old: attr, name: name})
+		return
+	}
+	if path, ok := globalPath(n.X); ok {
+		if name, ok := r.renames[path+"."+attr]; ok {
+			r.edits = append(r.edits, edit{pos: n.Name.NamePos, old: attr, name: name})
+		}
+		// an attribute of some other global is not a renamed one.
+		return
+	}
+	r.sites = append(r.sites, Site{
+		Pos:    n.Name.NamePos,
+		Name:   attr,
+		Reason: "attribute of a value that can't be traced to a global",
+	})
+}
+
+// call reports getattr and hasattr calls that use a renamed attribute name.
+func (r *rewriter) call(n *syntax.CallExpr) {
+	fn, ok := n.Fn.(*syntax.Ident)
+	if !ok || (fn.Name != "getattr" && fn.Name != "hasattr") || len(n.Args) < 2 {
+		return
+	}
+	lit, ok := n.Args[1].(*syntax.Literal)
+	if !ok || lit.Token != syntax.STRING {
+		return
+	}
+	if attr, _ := lit.Value.(string); r.attrs[attr] {
+		r.sites = append(r.sites, Site{
+			Pos:    lit.TokenPos,
+			Name:   attr,
+			Reason: fmt.Sprintf("attribute name used as a string in %s", fn.Name),
+		})
+	}
+}
+
+// globalPath returns the dotted path of e if it is a global or a chain of
+// attributes of one, e.g. "contact.Address".
+func globalPath(e syntax.Expr) (string, bool) {
+	switch e := e.(type) {
+	case *syntax.Ident:
+		b, ok := e.Binding.(*resolve.Binding)
+		if !ok || (b.Scope != resolve.Predeclared && b.Scope != resolve.Universal) {
+			return "", false
+		}
+		return e.Name, true
+	case *syntax.DotExpr:
+		path, ok := globalPath(e.X)
+		if !ok {
+			return "", false
+		}
+		return path + "." + e.Name.Name, true
+	}
+	return "", false
+}
+
+// apply makes the given edits to src.
+func apply(src []byte, edits []edit) ([]byte, error) {
+	var lines []int // byte offset of the start of each line
+	lines = append(lines, 0)
+	for i, c := range src {
+		if c == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	type span struct {
+		start, end int
+		name       string
+	}
+	spans := make([]span, 0, len(edits))
+	for _, e := range edits {
+		line := int(e.pos.Line) - 1
+		if line < 0 || line >= len(lines) {
+			return nil, fmt.Errorf("%s: position out of range", e.pos)
+		}
+		off := lines[line]
+		for col := int32(1); col < e.pos.Col && off < len(src); col++ {
+			_, size := utf8.DecodeRune(src[off:])
+			off += size
+		}
+		if !bytes.HasPrefix(src[off:], []byte(e.old)) {
+			return nil, fmt.Errorf("%s: expected %q in source", e.pos, e.old)
+		}
+		spans = append(spans, span{start: off, end: off + len(e.old), name: e.name})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var buf bytes.Buffer
+	last := 0
+	for _, s := range spans {
+		buf.Write(src[last:s.start])
+		buf.WriteString(s.name)
+		last = s.end
+	}
+	buf.Write(src[last:])
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,78 @@
+package rewrite_test
+
+import (
+	"testing"
+
+	"github.com/starlight-go/starlight/rewrite"
+)
+
+func TestRewrite(t *testing.T) {
+	src := `
+# greet is renamed, but not in comments
+x = greet(contact.Name)  # keep this spacing
+y = contact.Address.Name
+def f(greet):
+    return greet(1)
+c = contact
+z = c.Name
+w = getattr(contact, "Name")
+v = other.Email
+`
+	expected := `
+# greet is renamed, but not in comments
+x = hello(contact.FullName)  # keep this spacing
+y = contact.Address.Name
+def f(greet):
+    return greet(1)
+c = contact
+z = c.Name
+w = getattr(contact, "Name")
+v = other.Contact
+`
+	out, sites, err := rewrite.Source("test.star", []byte(src), rewrite.Renames{
+		"greet":        "hello",
+		"contact.Name": "FullName",
+		".Email":       "Contact",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+	expectedSites := []string{
+		"test.star:8:7: Name: attribute of a value that can't be traced to a global",
+		`test.star:9:22: Name: attribute name used as a string in getattr`,
+	}
+	if len(sites) != len(expectedSites) {
+		t.Fatalf("expected %d sites, got %v", len(expectedSites), sites)
+	}
+	for i, s := range sites {
+		if s.String() != expectedSites[i] {
+			t.Errorf("expected site %q, got %q", expectedSites[i], s)
+		}
+	}
+}
+
+func TestRewriteShadowedGlobal(t *testing.T) {
+	src := "greet = 1\nx = greet\n"
+	out, _, err := rewrite.Source("test.star", []byte(src), rewrite.Renames{"greet": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != src {
+		t.Fatalf("expected script to be unchanged, got:\n%s", out)
+	}
+}
+
+func TestRewriteUnicode(t *testing.T) {
+	src := `x = ("héllo", contact.Name)` + "\n"
+	out, _, err := rewrite.Source("test.star", []byte(src), rewrite.Renames{"contact.Name": "FullName"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `x = ("héllo", contact.FullName)` + "\n"
+	if string(out) != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+}
@@ -0,0 +1,177 @@
+package starlight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+// RuntimeConfig configures a Runtime.
+type RuntimeConfig struct {
+	// Globals are passed to every script run by the runtime, and to the
+	// modules they load.
+	Globals map[string]interface{}
+	// Convert configures the conversion of globals for scripts.
+	Convert []convert.Option
+	Sandbox Sandbox
+	// Load overrides how scripts load modules.  By default, modules are read
+	// from the sandbox directories.
+	Load   LoadFunc
+	Limits Limits
+	// Labels identify the runtime, e.g. by tenant, in the stats passed to
+	// OnRun.
+	Labels map[string]string
+	// OnRun, if not nil, is called after each run, e.g. to record metrics.
+	OnRun func(RunStats)
+}
+
+// Sandbox restricts what the scripts of a runtime can reach.
+type Sandbox struct {
+	// Dirs are the directories scripts and their modules are read from.
+	Dirs []string
+	// DisableLoad makes load() fail.
+	DisableLoad bool
+	// Print handles the output of print().  If nil, the output is discarded,
+	// so that one tenant's scripts can't write to the host's output.
+	Print func(thread *starlark.Thread, msg string)
+}
+
+// Limits limits the resources each run of a script may use.  Zero values mean
+// no limit.
+type Limits struct {
+	// MaxSteps is the maximum number of execution steps of a run.
+	MaxSteps uint64
+	// Timeout is the maximum duration of a run.
+	Timeout time.Duration
+}
+
+// RunStats describes a finished run, for metrics.
+type RunStats struct {
+	Script string
+	// Labels are the labels of the runtime.  They must not be modified.
+	Labels   map[string]string
+	Duration time.Duration
+	Steps    uint64
+	Err      error
+}
+
+// Runtime runs scripts with a fixed configuration, so that a multi-tenant host
+// can make one Runtime per tenant instead of juggling globals and options for
+// each run.  Each runtime has its own cache of scripts and loaded modules, so
+// tenants never share script state.  A Runtime is safe for concurrent use.
+type Runtime struct {
+	cache   *Cache
+	globals map[string]interface{}
+	convert []convert.Option
+	print   func(thread *starlark.Thread, msg string)
+	load    LoadFunc
+	limits  Limits
+	labels  map[string]string
+	onRun   func(RunStats)
+}
+
+// NewRuntime returns a runtime with the given configuration, which is copied,
+// so later changes to it don't affect the runtime.
+func NewRuntime(cfg RuntimeConfig) (*Runtime, error) {
+	if len(cfg.Sandbox.Dirs) == 0 {
+		return nil, errors.New("no directories given")
+	}
+	r := &Runtime{
+		globals: copyGlobals(cfg.Globals),
+		convert: append([]convert.Option(nil), cfg.Convert...),
+		print:   cfg.Sandbox.Print,
+		limits:  cfg.Limits,
+		labels:  make(map[string]string, len(cfg.Labels)),
+		onRun:   cfg.OnRun,
+	}
+	for k, v := range cfg.Labels {
+		r.labels[k] = v
+	}
+	if r.print == nil {
+		r.print = func(*starlark.Thread, string) {}
+	}
+	g, err := convert.MakeStringDictWithOptions(r.globals, r.convert...)
+	if err != nil {
+		return nil, err
+	}
+	r.cache = newCache(append([]string(nil), cfg.Sandbox.Dirs...), g)
+	r.cache.cache.print = r.print
+	switch {
+	case cfg.Sandbox.DisableLoad:
+		r.load = func(_ *starlark.Thread, module string) (starlark.StringDict, error) {
+			return nil, fmt.Errorf("cannot load %s: load is disabled", module)
+		}
+	case cfg.Load != nil:
+		r.load = cfg.Load
+	default:
+		r.load = r.cache.load
+	}
+	return r, nil
+}
+
+func copyGlobals(m map[string]interface{}) map[string]interface{} {
+	cp := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
+
+// Run runs the script with the given filename from the sandbox directories,
+// like Cache.RunContext, with the runtime's globals merged under the given
+// globals.
+func (r *Runtime) Run(ctx context.Context, filename string, globals map[string]interface{}) (ret map[string]interface{}, err error) {
+	thread := &starlark.Thread{Name: filename, Print: r.print, Load: r.load}
+	start := time.Now()
+	if r.onRun != nil {
+		defer func() {
+			r.onRun(RunStats{
+				Script:   filename,
+				Labels:   r.labels,
+				Duration: time.Since(start),
+				Steps:    thread.ExecutionSteps(),
+				Err:      err,
+			})
+		}()
+	}
+
+	merged := copyGlobals(r.globals)
+	for k, v := range globals {
+		merged[k] = v
+	}
+	s, err := r.cache.script(filename, merged)
+	if err != nil {
+		return nil, err
+	}
+	merged = r.cache.withAPI(s.api, merged)
+
+	if r.limits.MaxSteps > 0 {
+		thread.SetMaxExecutionSteps(r.limits.MaxSteps)
+		thread.SetLocal(maxStepsKey, r.limits.MaxSteps)
+	}
+	if r.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.limits.Timeout)
+		defer cancel()
+	}
+	defer watch(ctx, thread)()
+	opts := append([]convert.Option{convert.WithThread(thread)}, r.convert...)
+	g, err := convert.MakeStringDictWithOptions(merged, opts...)
+	if err != nil {
+		return nil, err
+	}
+	dict, err := s.prog.Init(thread, g)
+	if err != nil {
+		return nil, err
+	}
+	return convert.FromStringDict(dict), nil
+}
+
+// Reset clears the runtime's cached scripts and modules.
+func (r *Runtime) Reset() {
+	r.cache.Reset()
+}
@@ -0,0 +1,151 @@
+package starlight
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+func TestRuntime(t *testing.T) {
+	dir, cleanup := makeScript(t, "main.star", `
+load("lib.star", "double")
+print("hi from", tenant)
+output = double(input)
+`)
+	defer cleanup()
+	writeScript(t, dir, "lib.star", `
+print("loading lib")
+def double(x):
+    return x * 2
+`)
+
+	var mu sync.Mutex
+	var printed []string
+	var stats []RunStats
+	r, err := NewRuntime(RuntimeConfig{
+		Globals: map[string]interface{}{"tenant": "acme"},
+		Sandbox: Sandbox{
+			Dirs: []string{dir},
+			Print: func(_ *starlark.Thread, msg string) {
+				mu.Lock()
+				printed = append(printed, msg)
+				mu.Unlock()
+			},
+		},
+		Labels: map[string]string{"tenant": "acme"},
+		OnRun:  func(s RunStats) { stats = append(stats, s) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := r.Run(context.Background(), "main.star", map[string]interface{}{"input": 21})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["output"] != int64(42) {
+		t.Errorf("expected output 42, got %#v", out["output"])
+	}
+	if strings.Join(printed, "\n") != "loading lib\nhi from acme" {
+		t.Errorf("unexpected output %q", printed)
+	}
+	if len(stats) != 1 || stats[0].Labels["tenant"] != "acme" || stats[0].Script != "main.star" || stats[0].Steps == 0 || stats[0].Err != nil {
+		t.Errorf("unexpected stats %#v", stats)
+	}
+}
+
+func TestRuntimeLimits(t *testing.T) {
+	dir, cleanup := makeScript(t, "loop.star", `
+def loop():
+    for i in range(1000000):
+        pass
+loop()
+`)
+	defer cleanup()
+	writeScript(t, dir, "load.star", `load("loop.star", "loop")`)
+
+	r, err := NewRuntime(RuntimeConfig{
+		Sandbox: Sandbox{Dirs: []string{dir}, DisableLoad: true},
+		Limits:  Limits{MaxSteps: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Run(context.Background(), "loop.star", nil)
+	if err == nil || !strings.Contains(err.Error(), "too many steps") {
+		t.Errorf("expected step limit error, got %v", err)
+	}
+	_, err = r.Run(context.Background(), "load.star", nil)
+	if err == nil || !strings.Contains(err.Error(), "load is disabled") {
+		t.Errorf("expected load to be disabled, got %v", err)
+	}
+}
+
+func TestNewRuntimeNoDirs(t *testing.T) {
+	if _, err := NewRuntime(RuntimeConfig{}); err == nil {
+		t.Fatal("expected error with no directories")
+	}
+}
+
+func TestRuntimeLimitsLoadedModules(t *testing.T) {
+	dir, cleanup := makeScript(t, "main.star", `load("slow.star", "x")`)
+	defer cleanup()
+	writeScript(t, dir, "slow.star", `
+def loop():
+    for i in range(100000000):
+        pass
+loop()
+x = 1
+`)
+	r, err := NewRuntime(RuntimeConfig{
+		Sandbox: Sandbox{Dirs: []string{dir}},
+		Limits:  Limits{MaxSteps: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Run(context.Background(), "main.star", nil)
+	if err == nil || !strings.Contains(err.Error(), "too many steps") {
+		t.Errorf("expected step limit error, got %v", err)
+	}
+
+	r, err = NewRuntime(RuntimeConfig{
+		Sandbox: Sandbox{Dirs: []string{dir}},
+		Limits:  Limits{Timeout: 20 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Run(context.Background(), "main.star", nil)
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
+
+func TestRuntimeOutsideDirs(t *testing.T) {
+	dir, cleanup := makeScript(t, "secret.star", `x = "secret"`)
+	defer cleanup()
+	scripts := filepath.Join(dir, "scripts")
+	if err := os.Mkdir(scripts, 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeScript(t, scripts, "main.star", `load("../secret.star", "x")`)
+	r, err := NewRuntime(RuntimeConfig{Sandbox: Sandbox{Dirs: []string{scripts}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"main.star", "../secret.star", "a/../../secret.star"} {
+		_, err := r.Run(context.Background(), name, nil)
+		if err == nil || !strings.Contains(err.Error(), "outside the configured directories") {
+			t.Errorf("%s: expected error reading outside the directories, got %v", name, err)
+		}
+	}
+	if _, err := New(scripts).Run("../secret.star", nil); err == nil {
+		t.Error("expected error running a script outside the directories")
+	}
+}
@@ -2,14 +2,17 @@
 package starlight
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/starlight-go/starlight/convert"
 	"go.starlark.net/resolve"
 	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
 )
 
 func init() {
@@ -27,13 +30,21 @@ type LoadFunc func(thread *starlark.Thread, module string) (starlark.StringDict,
 // Eval evaluates the starlark source with the given global variables. The type
 // of the argument for the src parameter must be string (filename), []byte, or io.Reader.
 func Eval(src interface{}, globals map[string]interface{}, load LoadFunc) (map[string]interface{}, error) {
-	dict, err := convert.MakeStringDict(globals)
-	if err != nil {
-		return nil, err
-	}
+	return EvalContext(context.Background(), src, globals, load)
+}
+
+// EvalContext is like Eval, but cancels the script when ctx is done.  The
+// context is available to builtins through convert.ThreadContext, so that they
+// can stop waiting when the script is cancelled.
+func EvalContext(ctx context.Context, src interface{}, globals map[string]interface{}, load LoadFunc) (map[string]interface{}, error) {
 	thread := &starlark.Thread{
 		Load: load,
 	}
+	defer watch(ctx, thread)()
+	dict, err := convert.MakeStringDictWithOptions(globals, convert.WithThread(thread))
+	if err != nil {
+		return nil, err
+	}
 	filename, ok := src.(string)
 	if ok {
 		dict, err = starlark.ExecFile(thread, filename, nil, dict)
@@ -46,21 +57,40 @@ func Eval(src interface{}, globals map[string]interface{}, load LoadFunc) (map[s
 	return convert.FromStringDict(dict), nil
 }
 
+// CallContext calls fn, e.g. a function defined by a script that Run returned,
+// on the given thread, and cancels the thread if ctx is done before fn returns,
+// as RunContext does for the scripts it runs.  Limits set on the thread, such
+// as its maximum execution steps, apply to the call.
+func CallContext(ctx context.Context, thread *starlark.Thread, fn starlark.Callable, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	defer watch(ctx, thread)()
+	return starlark.Call(thread, fn, args, kwargs)
+}
+
 // Cache is a cache of scripts to avoid re-reading files and reparsing them.
 type Cache struct {
 	dirs  []string
 	cache *cache
 
-	mu      sync.Mutex
-	scripts map[string]*starlark.Program
+	mu         sync.Mutex
+	scripts    map[string]*script
+	apis       map[string]map[string]interface{}
+	defaultAPI string
 }
 
-func run(p *starlark.Program, globals map[string]interface{}, load LoadFunc) (map[string]interface{}, error) {
-	g, err := convert.MakeStringDict(globals)
+// script is a compiled script and the API version it was compiled against.
+type script struct {
+	prog *starlark.Program
+	api  string
+}
+
+func run(ctx context.Context, p *starlark.Program, globals map[string]interface{}, load LoadFunc) (map[string]interface{}, error) {
+	thread := &starlark.Thread{Load: load}
+	defer watch(ctx, thread)()
+	g, err := convert.MakeStringDictWithOptions(globals, convert.WithThread(thread))
 	if err != nil {
 		return nil, err
 	}
-	ret, err := p.Init(&starlark.Thread{Load: load}, g)
+	ret, err := p.Init(thread, g)
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +126,8 @@ func WithGlobals(globals map[string]interface{}, dirs ...string) (*Cache, error)
 func newCache(dirs []string, globals starlark.StringDict) *Cache {
 	c := &Cache{
 		dirs:    dirs,
-		scripts: map[string]*starlark.Program{},
+		scripts: map[string]*script{},
+		apis:    map[string]map[string]interface{}{},
 	}
 	c.cache = &cache{
 		cache:    make(map[string]*entry),
@@ -106,44 +137,107 @@ func newCache(dirs []string, globals starlark.StringDict) *Cache {
 	return c
 }
 
+// watch sets ctx as the context of the thread, and cancels the thread if ctx is
+// done before the returned function is called.
+func watch(ctx context.Context, thread *starlark.Thread) (stop func()) {
+	convert.SetThreadContext(thread, ctx)
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
 // Run looks for a file with the given filename, and runs it with the given globals
 // passed to the script's global namespace. The return value is all convertible
 // global variables from the script, which may include the passed-in globals.
+// If the script declares an API version (see DefineAPI), the globals of that
+// version are passed to the script as well, with the given globals taking
+// precedence.
 func (c *Cache) Run(filename string, globals map[string]interface{}) (map[string]interface{}, error) {
-	dict, err := convert.MakeStringDict(globals)
+	return c.RunContext(context.Background(), filename, globals)
+}
+
+// RunContext is like Run, but cancels the script when ctx is done.  The context
+// is available to builtins through convert.ThreadContext.
+func (c *Cache) RunContext(ctx context.Context, filename string, globals map[string]interface{}) (map[string]interface{}, error) {
+	s, err := c.script(filename, globals)
 	if err != nil {
 		return nil, err
 	}
+	return run(ctx, s.prog, c.withAPI(s.api, globals), c.load)
+}
+
+// script returns the compiled script with the given filename, compiling it
+// against the given globals if it isn't cached.
+func (c *Cache) script(filename string, globals map[string]interface{}) (*script, error) {
 	c.mu.Lock()
-	if p, ok := c.scripts[filename]; ok {
-		c.mu.Unlock()
-		return run(p, globals, c.load)
+	s, ok := c.scripts[filename]
+	c.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+	s, err := c.compile(filename, globals)
+	if err != nil {
+		return nil, err
 	}
+	c.mu.Lock()
+	c.scripts[filename] = s
 	c.mu.Unlock()
+	return s, nil
+}
 
+func (c *Cache) compile(filename string, globals map[string]interface{}) (*script, error) {
 	b, err := c.readFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	_, p, err := starlark.SourceProgram(filename, b, dict.Has)
+	f, err := syntax.Parse(filename, b, 0)
 	if err != nil {
 		return nil, err
 	}
-	c.mu.Lock()
-	c.scripts[filename] = p
-	c.mu.Unlock()
-	return run(p, globals, c.load)
+	api, err := c.scriptAPI(f)
+	if err != nil {
+		return nil, err
+	}
+	apiGlobals := c.api(api)
+	isPredeclared := func(name string) bool {
+		if _, ok := globals[name]; ok {
+			return true
+		}
+		_, ok := apiGlobals[name]
+		return ok
+	}
+	p, err := starlark.FileProgram(f, isPredeclared)
+	if err != nil {
+		return nil, err
+	}
+	return &script{prog: p, api: api}, nil
 }
 
-func (c *Cache) load(_ *starlark.Thread, module string) (starlark.StringDict, error) {
-	return c.cache.Load(module)
+func (c *Cache) load(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	return c.cache.Load(thread, module)
 }
 
+// readFile reads the file with the given name from the first of the
+// directories that has it.  Names that lead outside the directories, such as
+// "../secret.star", are rejected.
 func (c *Cache) readFile(filename string) ([]byte, error) {
 	var err error
 	var b []byte
 	for _, d := range c.dirs {
-		b, err = ioutil.ReadFile(filepath.Join(d, filename))
+		path := filepath.Join(d, filename)
+		if !within(d, path) {
+			return nil, fmt.Errorf("cannot read file %q: it is outside the configured directories", filename)
+		}
+		b, err = ioutil.ReadFile(path)
 		if err == nil {
 			return b, nil
 		}
@@ -153,10 +247,16 @@ func (c *Cache) readFile(filename string) ([]byte, error) {
 	return nil, fmt.Errorf("cannot find file %q in any of the configured directories %q", filename, c.dirs)
 }
 
+// within reports whether path, which is cleaned, is in the directory dir.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 // Reset clears all cached scripts.
 func (c *Cache) Reset() {
 	c.mu.Lock()
-	c.scripts = map[string]*starlark.Program{}
+	c.scripts = map[string]*script{}
 	c.cache.reset()
 	c.mu.Unlock()
 }
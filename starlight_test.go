@@ -1,11 +1,14 @@
 package starlight
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestConversion(t *testing.T) {
@@ -168,3 +171,18 @@ func makeScript(t *testing.T, name, data string) (dir string, cleanup func()) {
 	}
 	return dir, func() { os.RemoveAll(dir) }
 }
+
+func TestEvalContextCancels(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := EvalContext(ctx, []byte(`
+def forever():
+    for i in range(1000000000):
+        pass
+
+forever()
+`), nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+}
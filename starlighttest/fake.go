@@ -0,0 +1,245 @@
+// Package starlighttest provides utilities for testing starlight scripts and
+// the Go values exposed to them.
+package starlighttest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Call is a single recorded call of a Fake from a script.
+type Call struct {
+	Args   []interface{}
+	Kwargs []convert.Kwarg
+}
+
+// Fake is a stand-in for a Go function exposed to scripts.  It records every
+// call made to it and returns canned values, so that scripts can be unit tested
+// without triggering the side effects of the real function.
+type Fake struct {
+	name string
+
+	mu      sync.Mutex
+	calls   []Call
+	returns []interface{}
+	err     error
+}
+
+// NewFake returns a Fake with the given name that returns the given values when
+// called.  Like functions wrapped with convert.MakeStarFn, no values returns
+// None, a single value is returned as-is, and multiple values are returned as a
+// tuple.
+func NewFake(name string, returns ...interface{}) *Fake {
+	return &Fake{name: name, returns: returns}
+}
+
+// Returns sets the values returned by subsequent calls to the fake.
+func (f *Fake) Returns(vals ...interface{}) *Fake {
+	f.mu.Lock()
+	f.returns = vals
+	f.err = nil
+	f.mu.Unlock()
+	return f
+}
+
+// Fails makes subsequent calls to the fake return the given error to the
+// script.
+func (f *Fake) Fails(err error) *Fake {
+	f.mu.Lock()
+	f.err = err
+	f.mu.Unlock()
+	return f
+}
+
+// Calls returns the calls made to the fake so far, in order.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Reset clears the recorded calls.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	f.calls = nil
+	f.mu.Unlock()
+}
+
+// CallInternal implements starlark.Callable.
+func (f *Fake) CallInternal(thread *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	kw, err := convert.FromKwargs(kwargs)
+	if err != nil {
+		return starlark.None, err
+	}
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{Args: convert.FromTuple(args), Kwargs: kw})
+	returns, ferr := f.returns, f.err
+	f.mu.Unlock()
+
+	if ferr != nil {
+		return starlark.None, ferr
+	}
+	switch len(returns) {
+	case 0:
+		return starlark.None, nil
+	case 1:
+		return convert.ToValue(returns[0])
+	}
+	tup := make(starlark.Tuple, len(returns))
+	for i, r := range returns {
+		v, err := convert.ToValue(r)
+		if err != nil {
+			return starlark.None, err
+		}
+		tup[i] = v
+	}
+	return tup, nil
+}
+
+// Name returns the name of the fake.
+func (f *Fake) Name() string { return f.name }
+
+// String returns the string representation of the value.
+func (f *Fake) String() string { return fmt.Sprintf("<fake %s>", f.name) }
+
+// Type returns a short string describing the value's type.
+func (f *Fake) Type() string { return "fake" }
+
+// Freeze is a no-op, fakes are safe for concurrent use.
+func (f *Fake) Freeze() {}
+
+// Truth returns the truth value of an object.
+func (f *Fake) Truth() starlark.Bool { return true }
+
+// Hash returns a function of x such that Equals(x, y) => Hash(x) == Hash(y).
+func (f *Fake) Hash() (uint32, error) { return 0, errors.New("fake is not hashable") }
+
+// FakeModule returns a module value with the given members, for replacing a
+// whole module or namespace global with fakes.  Members are converted with
+// convert.ToValue.
+func FakeModule(name string, members map[string]interface{}) (starlark.Value, error) {
+	dict, err := convert.MakeStringDict(members)
+	if err != nil {
+		return nil, err
+	}
+	return &starlarkstruct.Module{Name: name, Members: dict}, nil
+}
+
+// Override returns a copy of globals with the named entries replaced by the
+// given fakes, for use in a single run.  A name of the form "client.Send"
+// replaces only the Send attribute of the global client, leaving the rest of
+// its fields and methods intact.  It is an error to override an attribute of a
+// global that does not exist or has no attributes.
+func Override(globals map[string]interface{}, fakes map[string]interface{}) (map[string]interface{}, error) {
+	ret := make(map[string]interface{}, len(globals))
+	for k, v := range globals {
+		ret[k] = v
+	}
+	nested := map[string]map[string]interface{}{}
+	for name, fake := range fakes {
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			ret[name] = fake
+			continue
+		}
+		root := name[:i]
+		if nested[root] == nil {
+			nested[root] = map[string]interface{}{}
+		}
+		nested[root][name[i+1:]] = fake
+	}
+	for root, members := range nested {
+		base, ok := ret[root]
+		if !ok {
+			return nil, fmt.Errorf("can't override attributes of %q: no such global", root)
+		}
+		v, err := overlay(root, base, members)
+		if err != nil {
+			return nil, err
+		}
+		ret[root] = v
+	}
+	return ret, nil
+}
+
+func overlay(name string, base interface{}, fakes map[string]interface{}) (starlark.Value, error) {
+	v, err := convert.ToValue(base)
+	if err != nil {
+		return nil, err
+	}
+	attrs, ok := v.(starlark.HasAttrs)
+	if !ok {
+		return nil, fmt.Errorf("can't override attributes of %q: %s has no attributes", name, v.Type())
+	}
+	o := &overlayValue{HasAttrs: attrs, members: map[string]starlark.Value{}}
+	nested := map[string]map[string]interface{}{}
+	for attr, fake := range fakes {
+		i := strings.IndexByte(attr, '.')
+		if i < 0 {
+			fv, err := convert.ToValue(fake)
+			if err != nil {
+				return nil, err
+			}
+			o.members[attr] = fv
+			continue
+		}
+		root := attr[:i]
+		if nested[root] == nil {
+			nested[root] = map[string]interface{}{}
+		}
+		nested[root][attr[i+1:]] = fake
+	}
+	for attr, members := range nested {
+		child, err := attrs.Attr(attr)
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			return nil, fmt.Errorf("can't override attributes of %q: no such attribute", name+"."+attr)
+		}
+		fv, err := overlay(name+"."+attr, child, members)
+		if err != nil {
+			return nil, err
+		}
+		o.members[attr] = fv
+	}
+	return o, nil
+}
+
+// overlayValue wraps a value with attributes, replacing some of them.
+type overlayValue struct {
+	starlark.HasAttrs
+	members map[string]starlark.Value
+}
+
+func (o *overlayValue) Attr(name string) (starlark.Value, error) {
+	if v, ok := o.members[name]; ok {
+		return v, nil
+	}
+	return o.HasAttrs.Attr(name)
+}
+
+func (o *overlayValue) AttrNames() []string {
+	names := o.HasAttrs.AttrNames()
+	for name := range o.members {
+		found := false
+		for _, n := range names {
+			if n == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
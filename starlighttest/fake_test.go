@@ -0,0 +1,111 @@
+package starlighttest_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/starlight-go/starlight"
+	"github.com/starlight-go/starlight/convert"
+	"github.com/starlight-go/starlight/starlighttest"
+)
+
+type mailer struct {
+	From string
+	sent int
+}
+
+func (m *mailer) Send(to, body string) error {
+	m.sent++
+	return nil
+}
+
+func (m *mailer) Count() int {
+	return m.sent
+}
+
+func TestFakeRecordsCalls(t *testing.T) {
+	fake := starlighttest.NewFake("send", "ok")
+	globals := map[string]interface{}{"send": fake}
+
+	out, err := starlight.Eval([]byte(`out = send("bob", 2, urgent=True)`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["out"] != "ok" {
+		t.Fatalf(`expected "ok" but got %#v`, out["out"])
+	}
+	expected := []starlighttest.Call{{
+		Args:   []interface{}{"bob", int64(2)},
+		Kwargs: []convert.Kwarg{{Name: "urgent", Value: true}},
+	}}
+	if !reflect.DeepEqual(fake.Calls(), expected) {
+		t.Fatalf("expected calls %#v, got %#v", expected, fake.Calls())
+	}
+}
+
+func TestFakeFails(t *testing.T) {
+	fake := starlighttest.NewFake("send").Fails(errors.New("boom"))
+	_, err := starlight.Eval([]byte(`send()`), map[string]interface{}{"send": fake}, nil)
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if len(fake.Calls()) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(fake.Calls()))
+	}
+}
+
+func TestOverrideMember(t *testing.T) {
+	m := &mailer{From: "alice"}
+	fake := starlighttest.NewFake("Send")
+	globals, err := starlighttest.Override(map[string]interface{}{"mail": m}, map[string]interface{}{
+		"mail.Send": fake,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := starlight.Eval([]byte(`
+mail.Send("bob", "hi")
+sender = mail.From
+count = mail.Count()
+`), globals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.sent != 0 {
+		t.Fatalf("real Send was called %d times", m.sent)
+	}
+	if len(fake.Calls()) != 1 {
+		t.Fatalf("expected 1 call to fake, got %d", len(fake.Calls()))
+	}
+	if out["sender"] != "alice" {
+		t.Fatalf(`expected "alice" but got %#v`, out["sender"])
+	}
+	if out["count"] != int64(0) {
+		t.Fatalf(`expected 0 but got %#v`, out["count"])
+	}
+}
+
+func TestOverrideMissing(t *testing.T) {
+	_, err := starlighttest.Override(map[string]interface{}{}, map[string]interface{}{
+		"mail.Send": starlighttest.NewFake("Send"),
+	})
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+}
+
+func TestFakeModule(t *testing.T) {
+	get := starlighttest.NewFake("get", 5)
+	mod, err := starlighttest.FakeModule("store", map[string]interface{}{"get": get})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := starlight.Eval([]byte(`out = store.get("a")`), map[string]interface{}{"store": mod}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["out"] != int64(5) {
+		t.Fatalf("expected 5 but got %#v", out["out"])
+	}
+}
@@ -0,0 +1,211 @@
+package starlighttest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// FuzzToFrom runs a fuzz target that fills values of the same type as sample
+// from the fuzzer's input, converts them with convert.ToValue, and converts the
+// result back with convert.FromValue.  It fails if either conversion panics, or
+// if the round trip does not produce an equal Go value.  Values ToValue reports
+// as unsupported are skipped.  Call it from a FuzzXxx function after adding any
+// seeds of your own; the input is consumed a few bytes at a time to decide
+// lengths, nil-ness, and scalar values.
+func FuzzToFrom(f *testing.F, sample interface{}) {
+	typ := reflect.TypeOf(sample)
+	f.Add([]byte{})
+	f.Add([]byte{2, 'h', 'i', 3, 1, 2, 3, 4, 5, 6, 7, 8})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		in := reflect.New(typ).Elem()
+		fill(in, &data, 0)
+		orig := in.Interface()
+
+		var out interface{}
+		func() {
+			defer catch(t, "ToValue(%#v)", orig)
+			v, err := convert.ToValue(orig)
+			if err != nil {
+				t.Skip(err)
+			}
+			defer catch(t, "FromValue(%v)", v)
+			out = convert.FromValue(v)
+		}()
+
+		got := reflect.ValueOf(out)
+		if !got.IsValid() || !got.Type().ConvertibleTo(typ) {
+			t.Fatalf("round trip of %#v (%T) produced %#v (%T)", orig, orig, out, out)
+		}
+		if back := got.Convert(typ).Interface(); !reflect.DeepEqual(orig, back) {
+			t.Fatalf("round trip of %#v produced %#v", orig, back)
+		}
+	})
+}
+
+// FuzzFromTo runs a fuzz target that evaluates fuzzer-generated starlark
+// literal expressions (lists, tuples, dicts, strings, numbers and so on),
+// converts the value with convert.FromValue, back with convert.ToValue, and
+// once more with FromValue.  It fails if any conversion panics or errors, or if
+// the second Go value differs from the first.  Inputs that are not literal
+// expressions are skipped, so the target never runs arbitrary code.
+func FuzzFromTo(f *testing.F) {
+	f.Add(`None`)
+	f.Add(`[1, -2, "three", 4.5, True]`)
+	f.Add(`{"a": [1, 2], "b": {"c": 3}}`)
+	f.Fuzz(func(t *testing.T, src string) {
+		expr, err := syntax.ParseExpr("fuzz", src, 0)
+		if err != nil || !isLiteral(expr) {
+			t.Skip()
+		}
+		thread := &starlark.Thread{Name: "fuzz"}
+		thread.SetMaxExecutionSteps(1000)
+		v, err := starlark.EvalExpr(thread, expr, nil)
+		if err != nil {
+			t.Skip(err)
+		}
+
+		var first, second interface{}
+		func() {
+			defer catch(t, "FromValue(%v)", v)
+			first = convert.FromValue(v)
+		}()
+		var back starlark.Value
+		func() {
+			defer catch(t, "ToValue(%#v)", first)
+			back, err = convert.ToValue(first)
+		}()
+		if err != nil {
+			t.Fatalf("ToValue(%#v) of converted %s failed: %v", first, src, err)
+		}
+		func() {
+			defer catch(t, "FromValue(%v)", back)
+			second = convert.FromValue(back)
+		}()
+		if !reflect.DeepEqual(first, second) {
+			t.Fatalf("round trip of %s produced %#v, then %#v", src, first, second)
+		}
+	})
+}
+
+// catch turns a panic into a test failure describing the call that panicked.
+func catch(t *testing.T, format string, args ...interface{}) {
+	if r := recover(); r != nil {
+		t.Fatalf("%s panicked: %v", fmt.Sprintf(format, args...), r)
+	}
+}
+
+// isLiteral reports whether e only contains literals and literal containers.
+func isLiteral(e syntax.Expr) bool {
+	switch e := e.(type) {
+	case *syntax.Literal:
+		return true
+	case *syntax.Ident:
+		return e.Name == "None" || e.Name == "True" || e.Name == "False"
+	case *syntax.UnaryExpr:
+		return e.Op == syntax.MINUS && isLiteral(e.X)
+	case *syntax.ParenExpr:
+		return isLiteral(e.X)
+	case *syntax.ListExpr:
+		for _, x := range e.List {
+			if !isLiteral(x) {
+				return false
+			}
+		}
+		return true
+	case *syntax.TupleExpr:
+		for _, x := range e.List {
+			if !isLiteral(x) {
+				return false
+			}
+		}
+		return true
+	case *syntax.DictExpr:
+		for _, x := range e.List {
+			entry := x.(*syntax.DictEntry)
+			if !isLiteral(entry.Key) || !isLiteral(entry.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// maxFillDepth bounds recursive types like linked lists.
+const maxFillDepth = 8
+
+// fill sets v from the front of data, consuming what it uses.  Running out of
+// data produces zero values, non-nil pointers, and empty collections.
+func fill(v reflect.Value, data *[]byte, depth int) {
+	if depth > maxFillDepth {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(next(data, 1)&1 == 1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(next(data, v.Type().Size())))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(next(data, v.Type().Size()))
+	case reflect.Float32, reflect.Float64:
+		// built from integers so we never produce NaN, which never equals itself.
+		v.SetFloat(float64(int32(next(data, 4))) / float64(next(data, 1)+1))
+	case reflect.String:
+		n := int(next(data, 1) % 16)
+		b := make([]byte, 0, n)
+		for i := 0; i < n; i++ {
+			b = append(b, byte(next(data, 1)))
+		}
+		v.SetString(string(b))
+	case reflect.Slice:
+		n := int(next(data, 1) % 8)
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			fill(s.Index(i), data, depth+1)
+		}
+		v.Set(s)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fill(v.Index(i), data, depth+1)
+		}
+	case reflect.Map:
+		n := int(next(data, 1) % 8)
+		m := reflect.MakeMapWithSize(v.Type(), n)
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			fill(key, data, depth+1)
+			val := reflect.New(v.Type().Elem()).Elem()
+			fill(val, data, depth+1)
+			m.SetMapIndex(key, val)
+		}
+		v.Set(m)
+	case reflect.Ptr:
+		if next(data, 1)%4 == 3 {
+			return // leave nil
+		}
+		p := reflect.New(v.Type().Elem())
+		fill(p.Elem(), data, depth+1)
+		v.Set(p)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				fill(v.Field(i), data, depth+1)
+			}
+		}
+	}
+	// interfaces, funcs, and channels are left as their zero value.
+}
+
+// next consumes up to size bytes from data as a little endian integer.
+func next(data *[]byte, size uintptr) uint64 {
+	var buf [8]byte
+	n := copy(buf[:size], *data)
+	*data = (*data)[n:]
+	return binary.LittleEndian.Uint64(buf[:])
+}
@@ -0,0 +1,28 @@
+package starlighttest_test
+
+import (
+	"testing"
+
+	"github.com/starlight-go/starlight/starlighttest"
+)
+
+func FuzzPersonToFrom(f *testing.F) {
+	starlighttest.FuzzToFrom(f, person{})
+}
+
+func FuzzScalarsToFrom(f *testing.F) {
+	type scalars struct {
+		B   bool
+		I8  int8
+		I   int
+		U64 uint64
+		F   float64
+		S   string
+	}
+	starlighttest.FuzzToFrom(f, scalars{})
+}
+
+func FuzzLiteralsFromTo(f *testing.F) {
+	f.Add(`("a", [1, 2.0], {"b": (True, None)})`)
+	starlighttest.FuzzFromTo(f)
+}
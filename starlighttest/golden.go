@@ -0,0 +1,220 @@
+package starlighttest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/starlight-go/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+// Update makes Golden write the current snapshots to the golden files instead
+// of comparing against them.  Packages usually set it from a flag of their
+// own, e.g.
+//
+//	func init() {
+//		flag.BoolVar(&starlighttest.Update, "update", false, "rewrite golden files")
+//	}
+var Update bool
+
+// maxSnapshotDepth keeps Snapshot from recursing forever through cyclic Go
+// data, which is indistinguishable from very deep data from the outside.
+const maxSnapshotDepth = 32
+
+// Snapshot converts v with convert.ToValue and returns a canonical,
+// deterministic text representation of the resulting value tree, as seen by a
+// script.  Map and set entries and attributes are sorted, so the output is
+// stable between runs.  Callable attributes are listed but not called.
+func Snapshot(v interface{}) (string, error) {
+	val, err := convert.ToValue(v)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := snapshot(&buf, val, 0); err != nil {
+		return "", err
+	}
+	buf.WriteByte('\n')
+	return buf.String(), nil
+}
+
+func snapshot(buf *bytes.Buffer, v starlark.Value, depth int) error {
+	if depth > maxSnapshotDepth {
+		buf.WriteString("...")
+		return nil
+	}
+	indent := strings.Repeat("  ", depth+1)
+	closing := strings.Repeat("  ", depth)
+	switch v := v.(type) {
+	case starlark.NoneType, starlark.Bool, starlark.Int, starlark.Float, starlark.String, starlark.Bytes:
+		buf.WriteString(v.String())
+		return nil
+	case starlark.Callable:
+		fmt.Fprintf(buf, "<%s %s>", v.Type(), v.Name())
+		return nil
+	case starlark.IterableMapping:
+		items := v.Items()
+		entries := make([]string, 0, len(items))
+		for _, item := range items {
+			var b bytes.Buffer
+			if err := snapshot(&b, item[0], depth+1); err != nil {
+				return err
+			}
+			b.WriteString(": ")
+			if err := snapshot(&b, item[1], depth+1); err != nil {
+				return err
+			}
+			entries = append(entries, b.String())
+		}
+		sort.Strings(entries)
+		writeBlock(buf, v.Type(), "{", "}", entries, indent, closing)
+		return nil
+	case *starlark.Set:
+		var entries []string
+		it := v.Iterate()
+		defer it.Done()
+		var elem starlark.Value
+		for it.Next(&elem) {
+			var b bytes.Buffer
+			if err := snapshot(&b, elem, depth+1); err != nil {
+				return err
+			}
+			entries = append(entries, b.String())
+		}
+		sort.Strings(entries)
+		writeBlock(buf, v.Type(), "{", "}", entries, indent, closing)
+		return nil
+	case starlark.Indexable:
+		entries := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			var b bytes.Buffer
+			if err := snapshot(&b, v.Index(i), depth+1); err != nil {
+				return err
+			}
+			entries = append(entries, b.String())
+		}
+		writeBlock(buf, v.Type(), "[", "]", entries, indent, closing)
+		return nil
+	case starlark.HasAttrs:
+		names := v.AttrNames()
+		sort.Strings(names)
+		entries := make([]string, 0, len(names))
+		for _, name := range names {
+			attr, err := v.Attr(name)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %v", v.Type(), name, err)
+			}
+			if attr == nil {
+				continue
+			}
+			var b bytes.Buffer
+			b.WriteString(name)
+			b.WriteString(": ")
+			if err := snapshot(&b, attr, depth+1); err != nil {
+				return err
+			}
+			entries = append(entries, b.String())
+		}
+		writeBlock(buf, v.Type(), "{", "}", entries, indent, closing)
+		return nil
+	}
+	fmt.Fprintf(buf, "%s(%s)", v.Type(), v.String())
+	return nil
+}
+
+func writeBlock(buf *bytes.Buffer, typ, open, close string, entries []string, indent, closing string) {
+	buf.WriteString(typ)
+	buf.WriteByte(' ')
+	buf.WriteString(open)
+	if len(entries) == 0 {
+		buf.WriteString(close)
+		return
+	}
+	buf.WriteByte('\n')
+	for _, e := range entries {
+		buf.WriteString(indent)
+		buf.WriteString(e)
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(closing)
+	buf.WriteString(close)
+}
+
+// Golden compares the Snapshot of v against the contents of the golden file at
+// path, failing the test with a line diff if they differ.  If Update is set, it
+// writes the current snapshot to the golden file instead, creating any missing
+// directories.
+func Golden(t testing.TB, path string, v interface{}) {
+	t.Helper()
+	got, err := Snapshot(v)
+	if err != nil {
+		t.Fatalf("can't snapshot value: %v", err)
+	}
+	if Update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("can't read golden file (set Update to create it): %v", err)
+	}
+	if string(want) != got {
+		t.Errorf("snapshot does not match golden file %s (-want +got):\n%s", path, diff(string(want), got))
+	}
+}
+
+// diff returns a minimal line diff of a and b, based on their longest common
+// subsequence of lines.
+func diff(a, b string) string {
+	x := strings.Split(a, "\n")
+	y := strings.Split(b, "\n")
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var buf bytes.Buffer
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			buf.WriteString("  " + x[i] + "\n")
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			buf.WriteString("- " + x[i] + "\n")
+			i++
+		default:
+			buf.WriteString("+ " + y[j] + "\n")
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		buf.WriteString("- " + x[i] + "\n")
+	}
+	for ; j < len(y); j++ {
+		buf.WriteString("+ " + y[j] + "\n")
+	}
+	return buf.String()
+}
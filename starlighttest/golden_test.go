@@ -0,0 +1,55 @@
+package starlighttest_test
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/starlight-go/starlight/starlighttest"
+)
+
+func init() {
+	flag.BoolVar(&starlighttest.Update, "update", false, "rewrite golden files with the current output")
+}
+
+type address struct {
+	Street string
+	Number int
+}
+
+type person struct {
+	Name    string
+	Tags    []string
+	Scores  map[string]float64
+	Address address
+}
+
+func (p person) Greeting() string {
+	return "hi " + p.Name
+}
+
+func TestGolden(t *testing.T) {
+	p := person{
+		Name:    "bob",
+		Tags:    []string{"a", "b"},
+		Scores:  map[string]float64{"math": 1.5, "art": 2},
+		Address: address{Street: "oak", Number: 3},
+	}
+	starlighttest.Golden(t, "testdata/person.golden", p)
+}
+
+func TestSnapshotDeterministic(t *testing.T) {
+	m := map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+	first, err := starlighttest.Snapshot(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		s, err := starlighttest.Snapshot(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != first {
+			t.Fatalf("snapshot changed between runs:\n%s\n%s", first, s)
+		}
+	}
+}